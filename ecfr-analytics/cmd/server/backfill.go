@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"ecfr-analytics/internal/ecfr"
+	"ecfr-analytics/internal/metrics"
+	"ecfr-analytics/internal/store"
+)
+
+// The versioner API has no point-in-time content before this date.
+const earliestIssueDate = "2017-01-03"
+
+var errBackfillRunning = errors.New("backfill already running")
+
+type backfillOptions struct {
+	From    string
+	To      string
+	Cadence string
+	Titles  []int
+}
+
+func backfillOptionsFromQuery(q url.Values) (backfillOptions, error) {
+	opts := backfillOptions{From: q.Get("from"), To: q.Get("to"), Cadence: q.Get("cadence")}
+	for _, v := range splitList(q.Get("titles")) {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid title %q", v)
+		}
+		opts.Titles = append(opts.Titles, n)
+	}
+	return opts, opts.validate()
+}
+
+func (o *backfillOptions) validate() error {
+	if o.Cadence == "" {
+		o.Cadence = "monthly"
+	}
+	switch o.Cadence {
+	case "monthly", "quarterly", "amendment":
+	default:
+		return fmt.Errorf("invalid cadence %q (want monthly, quarterly or amendment)", o.Cadence)
+	}
+	if o.To == "" {
+		o.To = time.Now().Format("2006-01-02")
+	}
+	if o.From == "" {
+		return errors.New("from required")
+	}
+	if _, err := time.Parse("2006-01-02", o.From); err != nil {
+		return fmt.Errorf("invalid from %q (want YYYY-MM-DD)", o.From)
+	}
+	if _, err := time.Parse("2006-01-02", o.To); err != nil {
+		return fmt.Errorf("invalid to %q (want YYYY-MM-DD)", o.To)
+	}
+	if o.From < earliestIssueDate {
+		o.From = earliestIssueDate
+	}
+	if o.To < o.From {
+		if o.From == earliestIssueDate {
+			return fmt.Errorf("to must not be before %s, the earliest issue date", earliestIssueDate)
+		}
+		return errors.New("to must not be before from")
+	}
+	return nil
+}
+
+func backfillCommand(ctx context.Context, cli *ecfr.Client, st *store.Store, args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	from := fs.String("from", "", "first issue date (YYYY-MM-DD)")
+	to := fs.String("to", "", "last issue date (YYYY-MM-DD, default today)")
+	cadence := fs.String("cadence", "monthly", "monthly, quarterly or amendment")
+	titles := fs.String("titles", "", "comma-separated title numbers (default all)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	opts, err := backfillOptionsFromQuery(url.Values{
+		"from":    {*from},
+		"to":      {*to},
+		"cadence": {*cadence},
+		"titles":  {*titles},
+	})
+	if err != nil {
+		return err
+	}
+	result, err := recordRun(ctx, st, "backfill", func(run *store.RefreshRun) (map[string]any, error) {
+		return runBackfill(ctx, cli, st, opts, run, nil)
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("ECFR BACKFILL: done %v", result)
+	return nil
+}
+
+func runBackfill(ctx context.Context, cli *ecfr.Client, st *store.Store, opts backfillOptions, run *store.RefreshRun, progress progressFunc) (map[string]any, error) {
+	log.Printf("ECFR BACKFILL: %s to %s (%s)", opts.From, opts.To, opts.Cadence)
+	progress.report(phaseCatalog, 0, 0)
+	_, titles, err := syncCatalog(ctx, cli, st)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := map[int]bool{}
+	for _, n := range opts.Titles {
+		wanted[n] = true
+	}
+
+	var cadenceDates []string
+	if opts.Cadence != "amendment" {
+		cadenceDates = backfillDates(opts.From, opts.To, opts.Cadence)
+	}
+
+	var jobs []snapshotJob
+	// versionFailures are titles whose amendment dates could not be listed;
+	// they are recorded with the download failures, without a date.
+	versionFailures := []store.SnapshotFailure{}
+	asOf := map[string]bool{}
+	for _, t := range titles {
+		if t.Reserved || (len(wanted) > 0 && !wanted[t.Number]) {
+			continue
+		}
+		run.TitlesChecked++
+		dates := cadenceDates
+		if opts.Cadence == "amendment" {
+			dates, err = amendmentDates(ctx, cli, t.Number, opts.From, opts.To)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				log.Printf("ECFR BACKFILL: versions failed (title=%d): %v; skipping", t.Number, err)
+				versionFailures = append(versionFailures, store.SnapshotFailure{Title: t.Number, Error: "versions: " + err.Error()})
+				continue
+			}
+		}
+		for _, d := range dates {
+			if d > t.UpToDateAsOf {
+				continue
+			}
+			asOf[d] = true
+			exists, err := st.SnapshotExists(ctx, t.Number, d)
+			if err != nil {
+				return nil, err
+			}
+			if !exists {
+				jobs = append(jobs, snapshotJob{title: t.Number, date: d})
+			}
+		}
+	}
+
+	downloaded, failures := downloadSnapshots(ctx, cli, st, jobs, progress)
+	failures = append(versionFailures, failures...)
+	run.Downloaded = downloaded
+	run.Failures = failures
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	computeDates := make([]string, 0, len(asOf))
+	for d := range asOf {
+		computeDates = append(computeDates, d)
+	}
+	sort.Strings(computeDates)
+	reports := make(map[string]metrics.ReportSummary, len(computeDates))
+	for i, d := range computeDates {
+		progress.report(phaseCompute, i, len(computeDates))
+		report, err := metrics.ComputeAsOf(ctx, st, d)
+		if err != nil {
+			return nil, err
+		}
+		reports[d] = report.Summary
+	}
+	log.Printf("ECFR BACKFILL: computed metrics for %d dates", len(computeDates))
+	run.Report = reports
+
+	result := map[string]any{
+		"from":       opts.From,
+		"to":         opts.To,
+		"cadence":    opts.Cadence,
+		"titles":     run.TitlesChecked,
+		"dates":      len(computeDates),
+		"planned":    len(jobs),
+		"downloaded": downloaded,
+		"failures":   failures,
+		"reports":    reports,
+	}
+	if err := indexSearch(ctx, st, result, progress); err != nil {
+		return nil, err
+	}
+	if err := indexCitations(ctx, st, result, progress); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// backfillDates lists the dates from from to to at cadence, on from's day of
+// the month or the month's last day if it is shorter.
+func backfillDates(from, to, cadence string) []string {
+	start, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return nil
+	}
+	end, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		return nil
+	}
+	step := 1
+	if cadence == "quarterly" {
+		step = 3
+	}
+	var out []string
+	for i := 0; ; i += step {
+		d := time.Date(start.Year(), start.Month()+time.Month(i), 1, 0, 0, 0, 0, time.UTC)
+		d = d.AddDate(0, 0, min(start.Day(), daysIn(d))-1)
+		if d.After(end) {
+			break
+		}
+		out = append(out, d.Format("2006-01-02"))
+	}
+	return out
+}
+
+// daysIn is the number of days in d's month.
+func daysIn(d time.Time) int {
+	return time.Date(d.Year(), d.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func amendmentDates(ctx context.Context, cli *ecfr.Client, title int, from, to string) ([]string, error) {
+	versions, err := cli.GetTitleVersions(ctx, title, from, to)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var out []string
+	for _, v := range versions {
+		if v.Date == "" || v.Date < from || v.Date > to || seen[v.Date] {
+			continue
+		}
+		seen[v.Date] = true
+		out = append(out, v.Date)
+	}
+	sort.Strings(out)
+	return out, nil
+}
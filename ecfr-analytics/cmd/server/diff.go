@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"ecfr-analytics/internal/ecfr"
+	"ecfr-analytics/internal/store"
+)
+
+var errSnapshotNotFound = errors.New("snapshot not found")
+
+// diffTitleSnapshots resolves from/to to the stored snapshots on or before
+// each date (defaulting to the two most recent) and diffs them by section.
+// Both snapshots are streamed into per-section checksums; only the page of
+// changes from offset, at most limit long, is diffed word by word.
+func diffTitleSnapshots(ctx context.Context, st *store.Store, title int, from, to string, limit, offset int) (map[string]any, error) {
+	if to == "" {
+		to = "9999-12-31"
+	}
+	toDate, ok := st.SnapshotDateOnOrBefore(ctx, title, to)
+	if !ok {
+		return nil, fmt.Errorf("%w: title %d on or before %s", errSnapshotNotFound, title, to)
+	}
+	var fromDate string
+	if from == "" {
+		fromDate, ok = st.PreviousSnapshotDate(ctx, title, toDate)
+		if !ok {
+			return nil, fmt.Errorf("%w: title %d has no snapshot before %s", errSnapshotNotFound, title, toDate)
+		}
+	} else {
+		fromDate, ok = st.SnapshotDateOnOrBefore(ctx, title, from)
+		if !ok {
+			return nil, fmt.Errorf("%w: title %d on or before %s", errSnapshotNotFound, title, from)
+		}
+	}
+
+	var fromSums, toSums []ecfr.SectionSum
+	err := readSnapshot(ctx, st, title, fromDate, func(r io.Reader) (err error) {
+		fromSums, err = ecfr.SumSections(r)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = readSnapshot(ctx, st, title, toDate, func(r io.Reader) (err error) {
+		toSums, err = ecfr.SumSections(r)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	changes := ecfr.DiffSections(fromSums, toSums)
+
+	counts := map[string]int{ecfr.ChangeAdded: 0, ecfr.ChangeRemoved: 0, ecfr.ChangeModified: 0}
+	for _, c := range changes {
+		counts[c.Change]++
+	}
+	total := len(changes)
+	changes = changes[min(offset, total):min(offset+limit, total)]
+	if len(changes) > 0 {
+		keys := map[string]bool{}
+		for _, c := range changes {
+			keys[c.Key] = true
+		}
+		var fromText, toText map[string]string
+		err := readSnapshot(ctx, st, title, fromDate, func(r io.Reader) (err error) {
+			fromText, err = ecfr.SectionTexts(r, keys)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		err = readSnapshot(ctx, st, title, toDate, func(r io.Reader) (err error) {
+			toText, err = ecfr.SectionTexts(r, keys)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for i := range changes {
+			changes[i].Describe(fromText[changes[i].Key], toText[changes[i].Key])
+		}
+	}
+	return map[string]any{
+		"title":   title,
+		"from":    fromDate,
+		"to":      toDate,
+		"counts":  counts,
+		"total":   total,
+		"offset":  offset,
+		"limit":   limit,
+		"changes": changes,
+	}, nil
+}
+
+// readSnapshot streams a title's snapshot at date through read.
+func readSnapshot(ctx context.Context, st *store.Store, title int, date string, read func(io.Reader) error) error {
+	rc, err := st.OpenSnapshot(ctx, title, date)
+	if err != nil {
+		return fmt.Errorf("open title %d (%s): %w", title, date, err)
+	}
+	defer rc.Close()
+	if err := read(rc); err != nil {
+		return fmt.Errorf("parse title %d (%s): %w", title, date, err)
+	}
+	return nil
+}
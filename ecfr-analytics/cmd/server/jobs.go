@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"ecfr-analytics/internal/store"
+)
+
+const (
+	phaseQueued   = "queued"
+	phaseCatalog  = "catalog"
+	phaseDownload = "download"
+	phaseAmend    = "amendments"
+	phaseCompute  = "compute"
+	phaseIndex    = "index"
+	phaseCitation = "citations"
+	phaseDone     = "done"
+
+	maxKeptJobs = 20
+)
+
+type progressFunc func(phase string, done, total int)
+
+// runFunc does the work of a job, recording into run and reporting progress.
+type runFunc func(ctx context.Context, run *store.RefreshRun, progress progressFunc) (map[string]any, error)
+
+func (p progressFunc) report(phase string, done, total int) {
+	if p != nil {
+		p(phase, done, total)
+	}
+}
+
+type jobView struct {
+	ID         int64          `json:"id"`
+	Trigger    string         `json:"trigger"`
+	Status     string         `json:"status"`
+	Phase      string         `json:"phase"`
+	Done       int            `json:"done"`
+	Total      int            `json:"total"`
+	StartedAt  string         `json:"started_at"`
+	FinishedAt string         `json:"finished_at,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	Result     map[string]any `json:"result,omitempty"`
+}
+
+type refreshJob struct {
+	mu     sync.Mutex
+	view   jobView
+	subs   map[chan jobView]bool
+	doneCh chan struct{}
+	cancel context.CancelFunc
+}
+
+func (j *refreshJob) snapshot() jobView {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.view
+}
+
+func (j *refreshJob) update(fn func(v *jobView)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(&j.view)
+	for ch := range j.subs {
+		// Slow subscribers miss intermediate updates; they always get the
+		// final state when the channel closes.
+		select {
+		case ch <- j.view:
+		default:
+		}
+	}
+}
+
+func (j *refreshJob) finish(result map[string]any, err error) {
+	j.update(func(v *jobView) {
+		v.Phase = phaseDone
+		v.Status = runStatus(err)
+		if err != nil {
+			v.Error = err.Error()
+		}
+		v.Result = result
+		v.FinishedAt = time.Now().Format(time.RFC3339)
+	})
+	j.mu.Lock()
+	for ch := range j.subs {
+		close(ch)
+	}
+	j.subs = nil
+	j.mu.Unlock()
+	close(j.doneCh)
+}
+
+// finished reports whether the job has finished.
+func (j *refreshJob) finished() bool {
+	select {
+	case <-j.doneCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// subscribe returns a channel of progress updates that is closed once the job
+// finishes.
+func (j *refreshJob) subscribe() (<-chan jobView, func()) {
+	ch := make(chan jobView, 16)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.subs == nil {
+		close(ch)
+		return ch, func() {}
+	}
+	j.subs[ch] = true
+	return ch, func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if j.subs[ch] {
+			delete(j.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// refreshJobs runs at most one refresh at a time; start calls made while a
+// refresh is in flight join it instead of queueing another. Other tasks, such
+// as backfills, are tracked alongside so they can be watched and cancelled
+// the same way. Every job stops when ctx is done.
+type refreshJobs struct {
+	mu      sync.Mutex
+	ctx     context.Context
+	st      *store.Store
+	run     runFunc
+	current *refreshJob
+	jobs    map[int64]*refreshJob
+	order   []int64
+	wg      sync.WaitGroup
+}
+
+func newRefreshJobs(ctx context.Context, st *store.Store, run runFunc) *refreshJobs {
+	return &refreshJobs{ctx: ctx, st: st, run: run, jobs: map[int64]*refreshJob{}}
+}
+
+func (m *refreshJobs) start(trigger string) (*refreshJob, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.current != nil {
+		return m.current, true, nil
+	}
+	job, err := m.launch(trigger, m.run, func() {
+		m.mu.Lock()
+		m.current = nil
+		m.mu.Unlock()
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	m.current = job
+	return job, false, nil
+}
+
+// startTask runs fn as a job of its own, independent of the current refresh.
+func (m *refreshJobs) startTask(trigger string, fn runFunc) (*refreshJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.launch(trigger, fn, nil)
+}
+
+// launch records a run for trigger and runs fn in the background, calling
+// done (if set) just before the job finishes. m.mu must be held.
+func (m *refreshJobs) launch(trigger string, fn runFunc, done func()) (*refreshJob, error) {
+	if err := m.ctx.Err(); err != nil {
+		return nil, err
+	}
+	run, err := m.st.StartRefreshRun(context.Background(), trigger)
+	if err != nil {
+		return nil, err
+	}
+	job := &refreshJob{
+		view: jobView{
+			ID:        run.ID,
+			Trigger:   trigger,
+			Status:    store.RunRunning,
+			Phase:     phaseQueued,
+			StartedAt: run.StartedAt,
+		},
+		subs:   map[chan jobView]bool{},
+		doneCh: make(chan struct{}),
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	job.cancel = cancel
+	m.jobs[run.ID] = job
+	m.order = append(m.order, run.ID)
+	m.evict()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer cancel()
+		result, err := fn(ctx, run, func(phase string, done, total int) {
+			job.update(func(v *jobView) {
+				v.Phase = phase
+				v.Done = done
+				v.Total = total
+			})
+		})
+		result, err = finishRun(ctx, m.st, run, result, err)
+		switch runStatus(err) {
+		case store.RunCancelled:
+			log.Printf("%s run %d cancelled", trigger, run.ID)
+		case store.RunFailed:
+			log.Printf("%s run %d failed: %v", trigger, run.ID, err)
+		}
+
+		if done != nil {
+			done()
+		}
+		job.finish(result, err)
+	}()
+	return job, nil
+}
+
+// evict forgets the oldest finished jobs beyond maxKeptJobs. Running jobs are
+// always kept, so that they can be watched and cancelled, even if that
+// exceeds the limit. m.mu must be held.
+func (m *refreshJobs) evict() {
+	excess := len(m.order) - maxKeptJobs
+	kept := m.order[:0]
+	for _, id := range m.order {
+		if excess > 0 && m.jobs[id].finished() {
+			delete(m.jobs, id)
+			excess--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	m.order = kept
+}
+
+// wait blocks until every job has finished and recorded its run.
+func (m *refreshJobs) wait() {
+	m.wg.Wait()
+}
+
+func (m *refreshJobs) get(id int64) (*refreshJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	return j, ok
+}
+
+// cancel stops a running job. The job finishes asynchronously once its
+// workers have drained; ok is false if the job is unknown, running false if it
+// had already finished.
+func (m *refreshJobs) cancel(id int64) (view jobView, ok, running bool) {
+	job, ok := m.get(id)
+	if !ok {
+		return jobView{}, false, false
+	}
+	view = job.snapshot()
+	if view.Phase == phaseDone {
+		return view, true, false
+	}
+	job.cancel()
+	return view, true, true
+}
+
+// runAndWait starts (or joins) a refresh and blocks until it finishes.
+func (m *refreshJobs) runAndWait(trigger string) (jobView, error) {
+	job, _, err := m.start(trigger)
+	if err != nil {
+		return jobView{}, err
+	}
+	<-job.doneCh
+	return job.snapshot(), nil
+}
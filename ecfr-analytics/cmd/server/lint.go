@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"text/tabwriter"
+
+	"ecfr-analytics/internal/store"
+)
+
+// parseRefStatuses parses a comma-separated list of reference statuses; an
+// empty list selects store.DanglingStatuses.
+func parseRefStatuses(v string) ([]string, error) {
+	statuses := splitList(v)
+	for _, s := range statuses {
+		if !store.ValidRefStatus(s) {
+			return nil, fmt.Errorf("invalid status %q (want %s, %s, %s, %s or %s)", s,
+				store.RefOK, store.RefReserved, store.RefRemoved, store.RefMissing, store.RefUnchecked)
+		}
+	}
+	return statuses, nil
+}
+
+// lintCommand brings the citation graph up to date with the stored snapshots,
+// as far as they can be read, and prints the dangling reference report to
+// out, one reference per line, grouped by agency.
+func lintCommand(ctx context.Context, st *store.Store, out io.Writer, args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	agency := fs.String("agency", "", "only references in this agency's text (slug)")
+	status := fs.String("status", "", "comma-separated statuses (default reserved,removed,missing)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	statuses, err := parseRefStatuses(*status)
+	if err != nil {
+		return err
+	}
+	n, err := st.IndexCitations(ctx, nil)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		log.Printf("citation indexing incomplete: %v", err)
+	} else if n > 0 {
+		log.Printf("indexed citations of %d snapshots", n)
+	}
+	report, err := st.DanglingReferences(ctx, store.DanglingQuery{Agency: *agency, Statuses: statuses})
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	line := func(slug string, r store.DanglingReference) {
+		fmt.Fprintf(tw, "%s\t%d CFR %s\t%s\t%s\t%d\t%s\t%s\n",
+			slug, r.From.Title, r.From.Section, r.Citation, r.Status, r.Count, r.LastSeen, r.Heading)
+	}
+	fmt.Fprintln(tw, "AGENCY\tCITED IN\tCITES\tSTATUS\tCOUNT\tLAST SEEN\tHEADING")
+	for _, a := range report.Agencies {
+		for _, r := range a.References {
+			line(a.Slug, r)
+		}
+	}
+	for _, r := range report.Unowned {
+		line("-", r)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "\n%d ok, %d reserved, %d removed, %d missing, %d unchecked\n",
+		report.Summary[store.RefOK], report.Summary[store.RefReserved], report.Summary[store.RefRemoved],
+		report.Summary[store.RefMissing], report.Summary[store.RefUnchecked])
+	return err
+}
@@ -5,29 +5,59 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 
 	"ecfr-analytics/internal/ecfr"
+	"ecfr-analytics/internal/export"
 	"ecfr-analytics/internal/metrics"
 	"ecfr-analytics/internal/store"
 )
 
 type serverDeps struct {
-	refresh       func(ctx context.Context) (map[string]any, error)
-	listAgencies  func(ctx context.Context) ([]map[string]any, error)
-	latestMetrics func(ctx context.Context, metric string) ([]map[string]any, error)
-	getState      func(ctx context.Context, key string) (string, error)
+	startRefresh     func(trigger string) (jobView, bool, error)
+	getJob           func(id int64) (*refreshJob, bool)
+	cancelJob        func(id int64) (jobView, bool, bool)
+	listAgencies     func(ctx context.Context) ([]map[string]any, error)
+	metricCatalog    func() []metrics.MetricInfo
+	latestMetrics    func(ctx context.Context, metric, scope string) ([]map[string]any, error)
+	getState         func(ctx context.Context, key string) (string, error)
+	metricSeries     func(ctx context.Context, slug string, metrics []string, rng store.SeriesRange) (map[string][]map[string]any, error)
+	startBackfill    func(opts backfillOptions) (jobView, error)
+	exportMetrics    func(ctx context.Context, w io.Writer, format string, q export.Query) error
+	partRestrictions func(ctx context.Context, slug, date string) ([]metrics.PartRestrictions, error)
+	restrictionTerms func() []string
+	sectionAges      func(ctx context.Context, slug, date string, minYears float64) (*metrics.SectionAges, error)
+	sharedChapters   func(ctx context.Context, all bool) (*metrics.ChapterAttribution, error)
+	search           func(ctx context.Context, q store.SearchQuery) ([]store.SearchHit, error)
+	citations        func(ctx context.Context, q store.CitationQuery) ([]store.CitationEdge, error)
+	agencyCitations  func(ctx context.Context) ([]store.AgencyCitations, error)
+	danglingRefs     func(ctx context.Context, q store.DanglingQuery) (*store.DanglingReport, error)
+	partProvenance   func(ctx context.Context, title int, part string) (*store.PartProvenance, error)
+	titleDiff        func(ctx context.Context, title int, from, to string, limit, offset int) (map[string]any, error)
+	titleDates       func(ctx context.Context, title int) ([]string, error)
+	latestTitles     func(ctx context.Context, metric string) ([]map[string]any, error)
+	titleMetrics     func(ctx context.Context, title int, date string) (store.TitleMetrics, error)
+	chapterMetrics   func(ctx context.Context, title int, date string) (string, []map[string]any, error)
+	listRuns         func(ctx context.Context, limit int) ([]store.RefreshRun, error)
+	getRun           func(ctx context.Context, id int64) (store.RefreshRun, bool, error)
 }
 
 func main() {
@@ -35,123 +65,898 @@ func main() {
 	dataDir := getenv("DATA_DIR", "./data")
 	addr := getenv("ADDR", ":8080")
 	dailyHour := getenvInt("ECFR_DAILY_REFRESH_HOUR", 2)
+	if mode := os.Getenv("ECFR_ATTRIBUTION"); mode != "" {
+		if err := metrics.SetAttribution(mode); err != nil {
+			log.Fatal(err)
+		}
+	}
+	profile, err := ecfr.ParseTextProfile(os.Getenv("ECFR_TEXT_PROFILE"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "cancel" {
+		if err := cancelCommand(addr, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
 	if err := os.MkdirAll(filepath.Join(dataDir, "xml"), 0o755); err != nil {
 		log.Fatal(err)
 	}
 
-	db, err := sql.Open("sqlite3", filepath.Join(dataDir, "ecfr.sqlite")+"?_busy_timeout=5000&_foreign_keys=1")
+	// WAL lets refreshes write while exports stream from an open read.
+	db, err := sql.Open("sqlite3", filepath.Join(dataDir, "ecfr.sqlite")+"?_busy_timeout=5000&_foreign_keys=1&_journal_mode=WAL")
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer db.Close()
 
 	st := store.New(db, dataDir)
+	st.SetTextProfile(profile)
+	if terms := splitList(os.Getenv("ECFR_RESTRICTION_TERMS")); len(terms) > 0 {
+		st.SetRestrictionTerms(terms)
+	}
 	if err := st.InitSchema(); err != nil {
 		log.Fatal(err)
 	}
 
 	cli := ecfr.NewClient(baseURL, 120*time.Second)
+
+	if len(os.Args) > 1 && os.Args[1] == "backfill" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		err := backfillCommand(ctx, cli, st, os.Args[2:])
+		stop()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		err := lintCommand(ctx, st, os.Stdout, os.Args[2:])
+		stop()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if n, err := st.RemovePartialSnapshots(); err != nil {
+		log.Printf("removing partial downloads: %v", err)
+	} else if n > 0 {
+		log.Printf("removed %d partial downloads", n)
+	}
+	if n, err := st.FailInterruptedRuns(context.Background()); err != nil {
+		log.Printf("closing interrupted runs: %v", err)
+	} else if n > 0 {
+		log.Printf("marked %d interrupted runs as failed", n)
+	}
+	if !st.SearchAvailable() {
+		log.Printf("search disabled: %v", store.ErrSearchUnavailable)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	var refreshMu sync.Mutex
+	var backfillRunning atomic.Bool
+
+	jobs := newRefreshJobs(ctx, st, func(ctx context.Context, run *store.RefreshRun, progress progressFunc) (map[string]any, error) {
+		refreshMu.Lock()
+		defer refreshMu.Unlock()
+		// The timeout covers the refresh itself, not the wait for a backfill.
+		ctx, cancel := context.WithTimeout(ctx, 15*time.Minute)
+		defer cancel()
+		return refreshCurrent(ctx, cli, st, run, progress)
+	})
 
 	deps := serverDeps{
-		refresh: func(ctx context.Context) (map[string]any, error) {
-			refreshMu.Lock()
-			result, err := refreshCurrent(ctx, cli, st)
-			refreshMu.Unlock()
-			return result, err
+		startRefresh: func(trigger string) (jobView, bool, error) {
+			job, coalesced, err := jobs.start(trigger)
+			if err != nil {
+				return jobView{}, false, err
+			}
+			return job.snapshot(), coalesced, nil
 		},
+		getJob:    jobs.get,
+		cancelJob: jobs.cancel,
 		listAgencies: func(ctx context.Context) ([]map[string]any, error) {
 			return st.ListAgencies(ctx)
 		},
-		latestMetrics: func(ctx context.Context, metric string) ([]map[string]any, error) {
-			return st.LatestAgencyMetric(ctx, metric)
+		metricCatalog: metrics.Catalog,
+		latestMetrics: func(ctx context.Context, metric, scope string) ([]map[string]any, error) {
+			return st.LatestAgencyMetric(ctx, metric, scope)
 		},
 		getState: func(ctx context.Context, key string) (string, error) {
 			return st.GetState(ctx, key)
 		},
+		metricSeries: func(ctx context.Context, slug string, metrics []string, rng store.SeriesRange) (map[string][]map[string]any, error) {
+			return st.AgencyMetricsSeries(ctx, slug, metrics, rng)
+		},
+		exportMetrics: func(ctx context.Context, w io.Writer, format string, q export.Query) error {
+			return export.WriteAgencyMetrics(ctx, st, w, format, q)
+		},
+		partRestrictions: func(ctx context.Context, slug, date string) ([]metrics.PartRestrictions, error) {
+			return metrics.AgencyPartRestrictions(ctx, st, slug, date)
+		},
+		restrictionTerms: st.RestrictionTerms,
+		sectionAges: func(ctx context.Context, slug, date string, minYears float64) (*metrics.SectionAges, error) {
+			return metrics.AgencySectionAges(ctx, st, slug, date, minYears)
+		},
+		sharedChapters: func(ctx context.Context, all bool) (*metrics.ChapterAttribution, error) {
+			return metrics.SharedChapters(ctx, st, all)
+		},
+		search: func(ctx context.Context, q store.SearchQuery) ([]store.SearchHit, error) {
+			return st.Search(ctx, q)
+		},
+		citations: func(ctx context.Context, q store.CitationQuery) ([]store.CitationEdge, error) {
+			return st.Citations(ctx, q)
+		},
+		agencyCitations: func(ctx context.Context) ([]store.AgencyCitations, error) {
+			return st.AgencyCitationCounts(ctx)
+		},
+		danglingRefs: func(ctx context.Context, q store.DanglingQuery) (*store.DanglingReport, error) {
+			return st.DanglingReferences(ctx, q)
+		},
+		partProvenance: func(ctx context.Context, title int, part string) (*store.PartProvenance, error) {
+			return st.PartProvenance(ctx, title, part)
+		},
+		titleDiff: func(ctx context.Context, title int, from, to string, limit, offset int) (map[string]any, error) {
+			return diffTitleSnapshots(ctx, st, title, from, to, limit, offset)
+		},
+		titleDates: func(ctx context.Context, title int) ([]string, error) {
+			return st.SnapshotDates(ctx, title)
+		},
+		latestTitles: func(ctx context.Context, metric string) ([]map[string]any, error) {
+			return st.LatestTitleMetric(ctx, metric)
+		},
+		titleMetrics: func(ctx context.Context, title int, date string) (store.TitleMetrics, error) {
+			return st.TitleMetricsAsOf(ctx, title, date)
+		},
+		chapterMetrics: func(ctx context.Context, title int, date string) (string, []map[string]any, error) {
+			return st.ChapterMetricsAsOf(ctx, title, date)
+		},
+		listRuns: func(ctx context.Context, limit int) ([]store.RefreshRun, error) {
+			return st.ListRefreshRuns(ctx, limit)
+		},
+		getRun: func(ctx context.Context, id int64) (store.RefreshRun, bool, error) {
+			return st.GetRefreshRun(ctx, id)
+		},
+		startBackfill: func(opts backfillOptions) (jobView, error) {
+			if !backfillRunning.CompareAndSwap(false, true) {
+				return jobView{}, errBackfillRunning
+			}
+			job, err := jobs.startTask("backfill", func(ctx context.Context, run *store.RefreshRun, progress progressFunc) (map[string]any, error) {
+				defer backfillRunning.Store(false)
+				refreshMu.Lock()
+				defer refreshMu.Unlock()
+				return runBackfill(ctx, cli, st, opts, run, progress)
+			})
+			if err != nil {
+				backfillRunning.Store(false)
+				return jobView{}, err
+			}
+			return job.snapshot(), nil
+		},
 	}
 
 	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
+		if _, err := jobs.runAndWait("startup"); err != nil {
+			log.Printf("startup refresh failed: %v", err)
+		}
+	}()
+
+	go func() {
+		for {
+			next := nextDailyRun(time.Now(), dailyHour)
+			timer := time.NewTimer(time.Until(next))
+			<-timer.C
+			if _, err := jobs.runAndWait("daily"); err != nil {
+				log.Printf("daily refresh failed: %v", err)
+			}
+		}
+	}()
+
+	mux := newMux("./web", deps)
+
+	log.Printf("Server started")
+	log.Printf("Listening on %s", addr)
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           withCORS(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		log.Printf("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
-		_, err := deps.refresh(ctx)
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("shutdown: %v", err)
+		}
+	}()
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	// Cancelled jobs still record their runs before the database closes.
+	jobs.wait()
+}
+
+func newMux(webDir string, deps serverDeps) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.Dir(webDir)))
+
+	mux.HandleFunc("/api/health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true, "time": time.Now().Format(time.RFC3339)})
+	})
+
+	mux.HandleFunc("/api/refresh", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST required", http.StatusMethodNotAllowed)
+			return
+		}
+		job, coalesced, err := deps.startRefresh("manual")
 		if err != nil {
-			log.Printf("startup refresh failed: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/api/refresh/jobs/%d", job.ID))
+		writeJSON(w, http.StatusAccepted, map[string]any{"job": job, "coalesced": coalesced})
+	})
+
+	mux.HandleFunc("/api/refresh/jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+			if err != nil {
+				http.Error(w, "invalid job id", http.StatusBadRequest)
+				return
+			}
+			job, ok, running := deps.cancelJob(id)
+			if !ok {
+				http.Error(w, "job not found", http.StatusNotFound)
+				return
+			}
+			if !running {
+				http.Error(w, "job already finished", http.StatusConflict)
+				return
+			}
+			writeJSON(w, http.StatusAccepted, job)
+			return
+		}
+		job, ok := lookupJob(w, r, deps)
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, job.snapshot())
+	})
+
+	mux.HandleFunc("/api/refresh/jobs/{id}/events", func(w http.ResponseWriter, r *http.Request) {
+		job, ok := lookupJob(w, r, deps)
+		if !ok {
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		updates, unsubscribe := job.subscribe()
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		writeEvent(w, "progress", job.snapshot())
+		flusher.Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case v, ok := <-updates:
+				if !ok {
+					writeEvent(w, "done", job.snapshot())
+					flusher.Flush()
+					return
+				}
+				writeEvent(w, "progress", v)
+				flusher.Flush()
+			}
+		}
+	})
+
+	mux.HandleFunc("/api/refresh/runs", func(w http.ResponseWriter, r *http.Request) {
+		limit := 0
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		runs, err := deps.listRuns(r.Context(), limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, runs)
+	})
+
+	mux.HandleFunc("/api/refresh/runs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid run id", http.StatusBadRequest)
+			return
+		}
+		run, ok, err := deps.getRun(r.Context(), id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "run not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, run)
+	})
+
+	mux.HandleFunc("/api/backfill", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST required", http.StatusMethodNotAllowed)
+			return
+		}
+		opts, err := backfillOptionsFromQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		job, err := deps.startBackfill(opts)
+		if err != nil {
+			if errors.Is(err, errBackfillRunning) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/api/refresh/jobs/%d", job.ID))
+		writeJSON(w, http.StatusAccepted, map[string]any{
+			"job":     job,
+			"status":  "started",
+			"from":    opts.From,
+			"to":      opts.To,
+			"cadence": opts.Cadence,
+			"titles":  opts.Titles,
+		})
+	})
+
+	mux.HandleFunc("/api/agencies", func(w http.ResponseWriter, r *http.Request) {
+		ag, err := deps.listAgencies(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, ag)
+	})
+
+	mux.HandleFunc("/api/metrics", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, deps.metricCatalog())
+	})
+
+	mux.HandleFunc("/api/metrics/latest", func(w http.ResponseWriter, r *http.Request) {
+		metric := r.URL.Query().Get("metric")
+		if metric == "" {
+			metric = "word_count"
+		}
+		if name := unknownMetric(deps.metricCatalog(), []string{metric}); name != "" {
+			http.Error(w, "unknown metric "+name, http.StatusNotFound)
+			return
+		}
+		scope, err := parseScope(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rows, err := deps.latestMetrics(r.Context(), metric, scope)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, rows)
+	})
+
+	mux.HandleFunc("/api/agencies/{slug}/metrics/{metric}/series", func(w http.ResponseWriter, r *http.Request) {
+		rng, err := parseSeriesRange(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		metric := r.PathValue("metric")
+		if name := unknownMetric(deps.metricCatalog(), []string{metric}); name != "" {
+			http.Error(w, "unknown metric "+name, http.StatusNotFound)
+			return
+		}
+		series, err := deps.metricSeries(r.Context(), r.PathValue("slug"), []string{metric}, rng)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, series[metric])
+	})
+
+	mux.HandleFunc("/api/agencies/{slug}/series", func(w http.ResponseWriter, r *http.Request) {
+		rng, err := parseSeriesRange(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		metrics := splitList(r.URL.Query().Get("metrics"))
+		if len(metrics) == 0 {
+			http.Error(w, "metrics required", http.StatusBadRequest)
+			return
+		}
+		if name := unknownMetric(deps.metricCatalog(), metrics); name != "" {
+			http.Error(w, "unknown metric "+name, http.StatusNotFound)
+			return
+		}
+		series, err := deps.metricSeries(r.Context(), r.PathValue("slug"), metrics, rng)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"slug": r.PathValue("slug"), "series": series})
+	})
+
+	mux.HandleFunc("/api/export", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var names []string
+		seen := map[string]bool{}
+		for _, n := range splitList(q.Get("metrics")) {
+			if !seen[n] {
+				seen[n] = true
+				names = append(names, n)
+			}
+		}
+		if len(names) == 0 {
+			http.Error(w, "metrics required", http.StatusBadRequest)
+			return
+		}
+		if name := unknownMetric(deps.metricCatalog(), names); name != "" {
+			http.Error(w, "unknown metric "+name, http.StatusNotFound)
+			return
+		}
+		format := q.Get("format")
+		if format == "" {
+			format = export.FormatCSV
+		}
+		if !export.ValidFormat(format) {
+			http.Error(w, fmt.Sprintf("invalid format %q (want csv, jsonl or parquet)", format), http.StatusBadRequest)
+			return
+		}
+		layout := q.Get("layout")
+		if layout == "" {
+			layout = export.LayoutLong
+		}
+		if !export.ValidLayout(layout) {
+			http.Error(w, fmt.Sprintf("invalid layout %q (want long or wide)", layout), http.StatusBadRequest)
+			return
+		}
+		for _, d := range []string{q.Get("from"), q.Get("to")} {
+			if d == "" {
+				continue
+			}
+			if _, err := time.Parse("2006-01-02", d); err != nil {
+				http.Error(w, fmt.Sprintf("invalid date %q (want YYYY-MM-DD)", d), http.StatusBadRequest)
+				return
+			}
+		}
+		scope, err := parseScope(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		kinds := map[string]string{}
+		for _, m := range deps.metricCatalog() {
+			kinds[m.Name] = m.Kind
+		}
+		eq := export.Query{Layout: layout, Scope: scope, From: q.Get("from"), To: q.Get("to")}
+		for _, n := range names {
+			eq.Metrics = append(eq.Metrics, export.Metric{Name: n, Kind: kinds[n]})
+		}
+
+		w.Header().Set("Content-Type", export.ContentType(format))
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="agency-metrics.%s"`, format))
+		// The table is streamed, so an error after the first row can only be
+		// logged.
+		if err := deps.exportMetrics(r.Context(), w, format, eq); err != nil {
+			log.Printf("export %s: %v", r.URL.RawQuery, err)
+		}
+	})
+
+	mux.HandleFunc("/api/agencies/{slug}/restrictions", func(w http.ResponseWriter, r *http.Request) {
+		date := r.URL.Query().Get("date")
+		if date != "" {
+			if _, err := time.Parse("2006-01-02", date); err != nil {
+				http.Error(w, fmt.Sprintf("invalid date %q (want YYYY-MM-DD)", date), http.StatusBadRequest)
+				return
+			}
+		}
+		parts, err := deps.partRestrictions(r.Context(), r.PathValue("slug"), date)
+		if errors.Is(err, store.ErrUnknownAgency) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"slug":  r.PathValue("slug"),
+			"terms": deps.restrictionTerms(),
+			"parts": parts,
+		})
+	})
+
+	mux.HandleFunc("/api/agencies/{slug}/ages", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		date := q.Get("date")
+		if date != "" {
+			if _, err := time.Parse("2006-01-02", date); err != nil {
+				http.Error(w, fmt.Sprintf("invalid date %q (want YYYY-MM-DD)", date), http.StatusBadRequest)
+				return
+			}
+		}
+		minYears := 0.0
+		if v := q.Get("min_years"); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f < 0 {
+				http.Error(w, "invalid min_years", http.StatusBadRequest)
+				return
+			}
+			minYears = f
+		}
+		limit := 100
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			if n > 0 {
+				limit = min(n, 1000)
+			}
+		}
+		ages, err := deps.sectionAges(r.Context(), r.PathValue("slug"), date, minYears)
+		if errors.Is(err, store.ErrUnknownAgency) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sections := ages.Sections
+		if len(sections) > limit {
+			sections = sections[:limit]
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"slug":     r.PathValue("slug"),
+			"total":    len(ages.Sections),
+			"sections": sections,
+			"undated":  ages.Undated,
+		})
+	})
+
+	mux.HandleFunc("/api/shared_chapters", func(w http.ResponseWriter, r *http.Request) {
+		all := false
+		if v := r.URL.Query().Get("all"); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				http.Error(w, "invalid all", http.StatusBadRequest)
+				return
+			}
+			all = b
+		}
+		shared, err := deps.sharedChapters(r.Context(), all)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, shared)
+	})
+
+	mux.HandleFunc("/api/search", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		sq := store.SearchQuery{Query: q.Get("q"), Agency: q.Get("agency"), Date: q.Get("date")}
+		if v := q.Get("title"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "invalid title", http.StatusBadRequest)
+				return
+			}
+			sq.Title = n
+		}
+		if sq.Date != "" {
+			if _, err := time.Parse("2006-01-02", sq.Date); err != nil {
+				http.Error(w, fmt.Sprintf("invalid date %q (want YYYY-MM-DD)", sq.Date), http.StatusBadRequest)
+				return
+			}
+		}
+		for name, dst := range map[string]*int{"limit": &sq.Limit, "offset": &sq.Offset} {
+			v := q.Get(name)
+			if v == "" {
+				continue
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid "+name, http.StatusBadRequest)
+				return
+			}
+			*dst = n
+		}
+		if sq.Limit > 200 {
+			sq.Limit = 200
+		}
+		hits, err := deps.search(r.Context(), sq)
+		switch {
+		case errors.Is(err, store.ErrSearchUnavailable):
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		case errors.Is(err, store.ErrInvalidQuery):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, store.ErrUnknownAgency):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"query": sq.Query, "results": hits})
+	})
+
+	mux.HandleFunc("/api/citations", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var cq store.CitationQuery
+		// Parameters are checked in a fixed order so the first bad one is
+		// always the one reported.
+		for _, p := range []struct {
+			name string
+			dst  **ecfr.Citation
+		}{{"from", &cq.From}, {"to", &cq.To}} {
+			v := q.Get(p.name)
+			if v == "" {
+				continue
+			}
+			c, ok := ecfr.ParseCitation(v)
+			if !ok {
+				http.Error(w, fmt.Sprintf("invalid %s %q (want e.g. \"40 CFR 60.5\", \"40 CFR part 63\", \"40 CFR\" or \"42 U.S.C. 7411\")", p.name, v), http.StatusBadRequest)
+				return
+			}
+			*p.dst = &c
+		}
+		for _, p := range []struct {
+			name string
+			dst  *int
+		}{{"limit", &cq.Limit}, {"offset", &cq.Offset}} {
+			v := q.Get(p.name)
+			if v == "" {
+				continue
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid "+p.name, http.StatusBadRequest)
+				return
+			}
+			*p.dst = n
+		}
+		if cq.Limit > 1000 {
+			cq.Limit = 1000
+		}
+		edges, err := deps.citations(r.Context(), cq)
+		switch {
+		case errors.Is(err, store.ErrInvalidCitation):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"from": q.Get("from"), "to": q.Get("to"), "citations": edges})
+	})
+
+	mux.HandleFunc("/api/citations/agencies", func(w http.ResponseWriter, r *http.Request) {
+		counts, err := deps.agencyCitations(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, counts)
+	})
+
+	mux.HandleFunc("/api/lint/dangling-references", func(w http.ResponseWriter, r *http.Request) {
+		statuses, err := parseRefStatuses(r.URL.Query().Get("status"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		report, err := deps.danglingRefs(r.Context(), store.DanglingQuery{Agency: r.URL.Query().Get("agency"), Statuses: statuses})
+		switch {
+		case errors.Is(err, store.ErrUnknownAgency):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+	})
+
+	mux.HandleFunc("/api/titles", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		metric := q.Get("metric")
+		if metric == "" {
+			metric = "word_count"
+		}
+		if name := unknownMetric(deps.metricCatalog(), []string{metric}); name != "" {
+			http.Error(w, "unknown metric "+name, http.StatusNotFound)
+			return
+		}
+		order := q.Get("order")
+		if order == "" {
+			order = "desc"
+		}
+		if order != "desc" && order != "asc" && order != "title" {
+			http.Error(w, fmt.Sprintf("invalid order %q (want desc, asc or title)", order), http.StatusBadRequest)
+			return
+		}
+		rows, err := deps.latestTitles(r.Context(), metric)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rankRows(rows, func(r map[string]any) any { return r["value"] }, order)
+		cfr, err := deps.titleMetrics(r.Context(), store.WholeCFR, "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"metric": metric,
+			"cfr":    map[string]any{"date": cfr.Date, "value": cfr.Values[metric], "text_profile": cfr.TextProfile},
+			"titles": rows,
+		})
+	})
+
+	mux.HandleFunc("/api/titles/{n}/metrics", func(w http.ResponseWriter, r *http.Request) {
+		n, date, ok := titleAndDate(w, r)
+		if !ok {
+			return
+		}
+		tm, err := deps.titleMetrics(r.Context(), n, date)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if tm.Date == "" {
+			http.Error(w, fmt.Sprintf("no metrics for title %d", n), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"title": n, "date": tm.Date, "metrics": tm.Values, "text_profile": tm.TextProfile})
+	})
+
+	mux.HandleFunc("/api/titles/{n}/chapters", func(w http.ResponseWriter, r *http.Request) {
+		n, date, ok := titleAndDate(w, r)
+		if !ok {
 			return
 		}
-	}()
-
-	go func() {
-		for {
-			next := nextDailyRun(time.Now(), dailyHour)
-			timer := time.NewTimer(time.Until(next))
-			<-timer.C
-			ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
-			_, err := deps.refresh(ctx)
-			cancel()
-			if err != nil {
-				log.Printf("daily refresh failed: %v", err)
+		sortBy := r.URL.Query().Get("sort")
+		if sortBy != "" {
+			if name := unknownMetric(deps.metricCatalog(), []string{sortBy}); name != "" {
+				http.Error(w, "unknown metric "+name, http.StatusNotFound)
+				return
 			}
 		}
-	}()
-
-	mux := newMux("./web", deps)
-
-	log.Printf("Server started")
-	log.Printf("Listening on %s", addr)
-	srv := &http.Server{
-		Addr:              addr,
-		Handler:           withCORS(mux),
-		ReadHeaderTimeout: 10 * time.Second,
-	}
-	log.Fatal(srv.ListenAndServe())
-}
-
-func newMux(webDir string, deps serverDeps) *http.ServeMux {
-	mux := http.NewServeMux()
-	mux.Handle("/", http.FileServer(http.Dir(webDir)))
-
-	mux.HandleFunc("/api/health", func(w http.ResponseWriter, r *http.Request) {
-		writeJSON(w, http.StatusOK, map[string]any{"ok": true, "time": time.Now().Format(time.RFC3339)})
+		asOf, chapters, err := deps.chapterMetrics(r.Context(), n, date)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if asOf == "" {
+			http.Error(w, fmt.Sprintf("no metrics for title %d", n), http.StatusNotFound)
+			return
+		}
+		if sortBy != "" {
+			rankRows(chapters, func(r map[string]any) any { return r["metrics"].(map[string]any)[sortBy] }, "desc")
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"title": n, "date": asOf, "chapters": chapters})
 	})
 
-	mux.HandleFunc("/api/refresh", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "POST required", http.StatusMethodNotAllowed)
+	mux.HandleFunc("/api/titles/{n}/parts/{p}/provenance", func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(r.PathValue("n"))
+		if err != nil {
+			http.Error(w, "invalid title", http.StatusBadRequest)
 			return
 		}
-		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Minute)
-		defer cancel()
-
-		result, err := deps.refresh(ctx)
+		part := r.PathValue("p")
+		p, err := deps.partProvenance(r.Context(), n, part)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadGateway)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if p == nil {
+			http.Error(w, fmt.Sprintf("no part %s in title %d", part, n), http.StatusNotFound)
 			return
 		}
-		writeJSON(w, http.StatusOK, result)
+		writeJSON(w, http.StatusOK, p)
 	})
 
-	mux.HandleFunc("/api/agencies", func(w http.ResponseWriter, r *http.Request) {
-		ag, err := deps.listAgencies(r.Context())
+	mux.HandleFunc("/api/titles/{n}/snapshots", func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(r.PathValue("n"))
+		if err != nil {
+			http.Error(w, "invalid title", http.StatusBadRequest)
+			return
+		}
+		dates, err := deps.titleDates(r.Context(), n)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		writeJSON(w, http.StatusOK, ag)
+		writeJSON(w, http.StatusOK, map[string]any{"title": n, "dates": dates})
 	})
 
-	mux.HandleFunc("/api/metrics/latest", func(w http.ResponseWriter, r *http.Request) {
-		metric := r.URL.Query().Get("metric")
-		if metric == "" {
-			metric = "word_count"
+	mux.HandleFunc("/api/titles/{n}/diff", func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(r.PathValue("n"))
+		if err != nil {
+			http.Error(w, "invalid title", http.StatusBadRequest)
+			return
+		}
+		q := r.URL.Query()
+		for _, d := range []string{q.Get("from"), q.Get("to")} {
+			if d == "" {
+				continue
+			}
+			if _, err := time.Parse("2006-01-02", d); err != nil {
+				http.Error(w, fmt.Sprintf("invalid date %q (want YYYY-MM-DD)", d), http.StatusBadRequest)
+				return
+			}
+		}
+		if from, to := q.Get("from"), q.Get("to"); from != "" && to != "" && from > to {
+			http.Error(w, "from must not be after to", http.StatusBadRequest)
+			return
+		}
+		limit, offset := 100, 0
+		if v := q.Get("limit"); v != "" {
+			l, err := strconv.Atoi(v)
+			if err != nil || l < 0 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			if l > 0 {
+				limit = min(l, 1000)
+			}
+		}
+		if v := q.Get("offset"); v != "" {
+			o, err := strconv.Atoi(v)
+			if err != nil || o < 0 {
+				http.Error(w, "invalid offset", http.StatusBadRequest)
+				return
+			}
+			offset = o
+		}
+		diff, err := deps.titleDiff(r.Context(), n, q.Get("from"), q.Get("to"), limit, offset)
+		if errors.Is(err, errSnapshotNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
 		}
-		rows, err := deps.latestMetrics(r.Context(), metric)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		writeJSON(w, http.StatusOK, rows)
+		writeJSON(w, http.StatusOK, diff)
 	})
 
 	mux.HandleFunc("/api/state", func(w http.ResponseWriter, r *http.Request) {
@@ -171,11 +976,193 @@ func newMux(webDir string, deps serverDeps) *http.ServeMux {
 	return mux
 }
 
-func refreshCurrent(ctx context.Context, cli *ecfr.Client, st *store.Store) (map[string]any, error) {
+// recordRun wraps fn in a refresh_runs entry, marking it ok or failed when fn
+// returns.
+func recordRun(ctx context.Context, st *store.Store, trigger string, fn func(run *store.RefreshRun) (map[string]any, error)) (map[string]any, error) {
+	run, err := st.StartRefreshRun(ctx, trigger)
+	if err != nil {
+		return nil, err
+	}
+	result, err := fn(run)
+	return finishRun(ctx, st, run, result, err)
+}
+
+func finishRun(ctx context.Context, st *store.Store, run *store.RefreshRun, result map[string]any, err error) (map[string]any, error) {
+	run.Status = runStatus(err)
+	if err != nil {
+		run.Error = err.Error()
+	}
+	if ferr := st.FinishRefreshRun(context.WithoutCancel(ctx), run); ferr != nil {
+		log.Printf("record refresh run %d: %v", run.ID, ferr)
+	}
+	if result != nil {
+		result["run_id"] = run.ID
+	}
+	return result, err
+}
+
+func runStatus(err error) string {
+	switch {
+	case err == nil:
+		return store.RunOK
+	case errors.Is(err, context.Canceled):
+		return store.RunCancelled
+	default:
+		return store.RunFailed
+	}
+}
+
+func refreshCurrent(ctx context.Context, cli *ecfr.Client, st *store.Store, run *store.RefreshRun, progress progressFunc) (map[string]any, error) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	log.Printf("ECFR INGEST: starting download check")
+	progress.report(phaseCatalog, 0, 0)
+	agencies, titles, err := syncCatalog(ctx, cli, st)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]snapshotJob, 0, len(titles))
+	for _, t := range titles {
+		if t.Reserved {
+			continue
+		}
+		run.TitlesChecked++
+		date := t.UpToDateAsOf // string "YYYY-MM-DD"
+		exists, err := st.SnapshotExists(ctx, t.Number, date)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			jobs = append(jobs, snapshotJob{title: t.Number, date: date})
+		}
+	}
+
+	downloaded, failures := downloadSnapshots(ctx, cli, st, jobs, progress)
+	run.Downloaded = downloaded
+	run.Failures = failures
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	amended, amendErr := indexAmendments(ctx, cli, st, progress)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	progress.report(phaseCompute, 0, 0)
+	report, err := metrics.ComputeLatest(ctx, st)
+	if err != nil {
+		return nil, err
+	}
+	run.Report = report
+	log.Printf("ECFR INGEST: metrics computed (agencies ok=%d skipped=%d failed=%d partial=%d unresolved=%d, titles failed=%d)",
+		report.Summary.AgenciesOK, report.Summary.AgenciesSkipped, report.Summary.AgenciesFailed, report.Summary.AgenciesPartial,
+		report.Summary.AgenciesUnresolved, report.Summary.TitlesFailed)
+
+	computedAt := time.Now().Format(time.RFC3339)
+	if err := st.SetState(ctx, "last_refresh", computedAt); err != nil {
+		return nil, err
+	}
+	if b, err := json.Marshal(report); err == nil {
+		if err := st.SetState(ctx, "last_compute_report", string(b)); err != nil {
+			return nil, err
+		}
+	}
+
+	result := map[string]any{
+		"agencies":     len(agencies),
+		"titles":       len(titles),
+		"downloaded":   downloaded,
+		"failures":     failures,
+		"computed_at":  computedAt,
+		"last_refresh": computedAt,
+		"report":       report,
+		"amended":      amended,
+	}
+	if amendErr != nil {
+		result["amendments_error"] = amendErr.Error()
+	}
+	if err := indexSearch(ctx, st, result, progress); err != nil {
+		return nil, err
+	}
+	if err := indexCitations(ctx, st, result, progress); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// indexSearch brings the search index up to date with stored snapshots. A
+// failure is recorded in result rather than failing the run, since metrics
+// are already saved; the snapshots are retried on the next run.
+func indexSearch(ctx context.Context, st *store.Store, result map[string]any, progress progressFunc) error {
+	if !st.SearchAvailable() {
+		return nil
+	}
+	n, err := st.IndexPendingSections(ctx, func(done, total int) {
+		progress.report(phaseIndex, done, total)
+	})
+	result["indexed"] = n
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err != nil {
+		log.Printf("ECFR INGEST: search indexing failed: %v", err)
+		result["index_error"] = err.Error()
+	} else if n > 0 {
+		log.Printf("ECFR INGEST: indexed %d snapshots for search", n)
+	}
+	return nil
+}
+
+// indexCitations rebuilds the citation graph of every title whose latest
+// snapshot changed. Like indexSearch, a failure is recorded in result and the
+// titles are retried on the next run.
+func indexCitations(ctx context.Context, st *store.Store, result map[string]any, progress progressFunc) error {
+	n, err := st.IndexCitations(ctx, func(done, total int) {
+		progress.report(phaseCitation, done, total)
+	})
+	result["citations_indexed"] = n
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err != nil {
+		log.Printf("ECFR INGEST: citation indexing failed: %v", err)
+		result["citations_error"] = err.Error()
+	} else if n > 0 {
+		log.Printf("ECFR INGEST: extracted citations from %d titles", n)
+	}
+	return nil
+}
+
+// indexAmendments dates the sections of every title whose latest snapshot
+// changed from the versioner's history, before metrics are computed. Like
+// indexSearch, a failure is returned for the result rather than failing the
+// run; titles without history are dated from their notes and retried on the
+// next run.
+func indexAmendments(ctx context.Context, cli *ecfr.Client, st *store.Store, progress progressFunc) (int, error) {
+	versions := func(ctx context.Context, title int, date string) ([]ecfr.ContentVersion, error) {
+		return cli.GetTitleVersions(ctx, title, "", date)
+	}
+	n, err := st.IndexAmendments(ctx, versions, func(done, total int) {
+		progress.report(phaseAmend, done, total)
+	})
+	if ctx.Err() != nil {
+		return n, ctx.Err()
+	}
+	if err != nil {
+		log.Printf("ECFR INGEST: amendment dating failed: %v", err)
+	} else if n > 0 {
+		log.Printf("ECFR INGEST: dated sections of %d titles from version history", n)
+	}
+	return n, err
+}
+
+func syncCatalog(ctx context.Context, cli *ecfr.Client, st *store.Store) ([]ecfr.Agency, []ecfr.Title, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	var agencies []ecfr.Agency
 	var titles []ecfr.Title
 	errCh := make(chan error, 2)
@@ -210,29 +1197,18 @@ func refreshCurrent(ctx context.Context, cli *ecfr.Client, st *store.Store) (map
 	wg.Wait()
 	select {
 	case err := <-errCh:
-		return nil, err
+		return nil, nil, err
 	default:
 	}
+	return agencies, titles, nil
+}
 
-	type job struct {
-		title int
-		date  string
-	}
-	jobs := make([]job, 0, len(titles))
-	for _, t := range titles {
-		if t.Reserved {
-			continue
-		}
-		date := t.UpToDateAsOf // string "YYYY-MM-DD"
-		exists, err := st.SnapshotExists(ctx, t.Number, date)
-		if err != nil {
-			return nil, err
-		}
-		if !exists {
-			jobs = append(jobs, job{title: t.Number, date: date})
-		}
-	}
+type snapshotJob struct {
+	title int
+	date  string
+}
 
+func downloadSnapshots(ctx context.Context, cli *ecfr.Client, st *store.Store, jobs []snapshotJob, progress progressFunc) (int, []store.SnapshotFailure) {
 	workers := getenvInt("ECFR_DOWNLOAD_CONCURRENCY", 2)
 	if workers < 1 {
 		workers = 1
@@ -241,89 +1217,87 @@ func refreshCurrent(ctx context.Context, cli *ecfr.Client, st *store.Store) (map
 		workers = 8
 	}
 
-	var downloaded int64
+	failures := []store.SnapshotFailure{}
 	if len(jobs) == 0 {
 		log.Printf("ECFR INGEST: no new snapshots to download")
-	} else {
-		log.Printf("ECFR INGEST: downloading snapshots (%d jobs, %d workers)", len(jobs), workers)
-		jobCh := make(chan job)
-		errCh = make(chan error, workers)
-		wg = sync.WaitGroup{}
-		for i := 0; i < workers; i++ {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				for j := range jobCh {
-					if ctx.Err() != nil {
-						return
+		return 0, failures
+	}
+
+	var downloaded int64
+	// mu orders progress reports as well as guarding failures, so the
+	// finished count never goes backwards.
+	var mu sync.Mutex
+	finished := 0
+	progress.report(phaseDownload, 0, len(jobs))
+	log.Printf("ECFR INGEST: downloading snapshots (%d jobs, %d workers)", len(jobs), workers)
+	jobCh := make(chan snapshotJob)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobCh {
+				if ctx.Err() != nil {
+					return
+				}
+				var lastErr error
+				for attempt := 0; attempt < 3; attempt++ {
+					rc, err := cli.GetFullTitleXMLStream(ctx, j.date, j.title)
+					if err == nil {
+						err = st.SaveSnapshotFromReader(ctx, j.title, j.date, rc)
+						_ = rc.Close()
 					}
-					var lastErr error
-					for attempt := 0; attempt < 3; attempt++ {
-						rc, err := cli.GetFullTitleXMLStream(ctx, j.date, j.title)
-						if err == nil {
-							err = st.SaveSnapshotFromReader(ctx, j.title, j.date, rc)
-							_ = rc.Close()
-						}
-						if err == nil {
-							atomic.AddInt64(&downloaded, 1)
-							lastErr = nil
-							break
-						}
-						lastErr = err
-						if !isRetryableDownloadErr(err) || attempt == 2 {
-							break
-						}
-						delay := time.Duration(2<<attempt) * time.Second
-						jitter := time.Duration(time.Now().UnixNano()%500) * time.Millisecond
-						t := time.NewTimer(delay + jitter)
-						select {
-						case <-ctx.Done():
-							t.Stop()
-							return
-						case <-t.C:
-						}
+					if err == nil {
+						atomic.AddInt64(&downloaded, 1)
+						lastErr = nil
+						break
 					}
-					if lastErr != nil {
-						log.Printf("ECFR INGEST: download failed (title=%d date=%s): %v; continuing", j.title, j.date, lastErr)
-						continue
+					lastErr = err
+					if !isRetryableDownloadErr(err) || attempt == 2 {
+						break
+					}
+					delay := time.Duration(2<<attempt) * time.Second
+					jitter := time.Duration(time.Now().UnixNano()%500) * time.Millisecond
+					t := time.NewTimer(delay + jitter)
+					select {
+					case <-ctx.Done():
+						t.Stop()
+						return
+					case <-t.C:
 					}
 				}
-			}()
-		}
-	sendLoop:
-		for _, j := range jobs {
-			select {
-			case <-ctx.Done():
-				break sendLoop
-			case jobCh <- j:
+				if lastErr != nil {
+					log.Printf("ECFR INGEST: download failed (title=%d date=%s): %v; continuing", j.title, j.date, lastErr)
+				}
+				mu.Lock()
+				if lastErr != nil {
+					failures = append(failures, store.SnapshotFailure{Title: j.title, Date: j.date, Error: lastErr.Error()})
+				}
+				finished++
+				progress.report(phaseDownload, finished, len(jobs))
+				mu.Unlock()
 			}
-		}
-		close(jobCh)
-		wg.Wait()
-		log.Printf("ECFR INGEST: downloads complete (successfully downloaded=%d)", atomic.LoadInt64(&downloaded))
+		}()
+	}
+sendLoop:
+	for _, j := range jobs {
 		select {
-		case err := <-errCh:
-			log.Printf("ECFR INGEST: completed with download errors: %v", err)
-		default:
+		case <-ctx.Done():
+			break sendLoop
+		case jobCh <- j:
 		}
 	}
-
-	if err := metrics.ComputeLatest(ctx, st); err != nil {
-		return nil, err
-	}
-
-	computedAt := time.Now().Format(time.RFC3339)
-	if err := st.SetState(ctx, "last_refresh", computedAt); err != nil {
-		return nil, err
+	close(jobCh)
+	wg.Wait()
+	if ctx.Err() != nil {
+		if n, err := st.RemovePartialSnapshots(); err != nil {
+			log.Printf("ECFR INGEST: removing partial downloads: %v", err)
+		} else if n > 0 {
+			log.Printf("ECFR INGEST: removed %d partial downloads", n)
+		}
 	}
-
-	return map[string]any{
-		"agencies":     len(agencies),
-		"titles":       len(titles),
-		"downloaded":   int(atomic.LoadInt64(&downloaded)),
-		"computed_at":  computedAt,
-		"last_refresh": computedAt,
-	}, nil
+	log.Printf("ECFR INGEST: downloads complete (successfully downloaded=%d)", atomic.LoadInt64(&downloaded))
+	return int(atomic.LoadInt64(&downloaded)), failures
 }
 
 func nextDailyRun(now time.Time, hour int) time.Time {
@@ -353,6 +1327,166 @@ func getenvInt(k string, def int) int {
 	return def
 }
 
+func parseSeriesRange(r *http.Request) (store.SeriesRange, error) {
+	q := r.URL.Query()
+	rng := store.SeriesRange{From: q.Get("from"), To: q.Get("to")}
+	for _, d := range []string{rng.From, rng.To} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			return rng, fmt.Errorf("invalid date %q (want YYYY-MM-DD)", d)
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return rng, fmt.Errorf("invalid limit %q", v)
+		}
+		rng.Limit = n
+	}
+	scope, err := parseScope(r)
+	if err != nil {
+		return rng, err
+	}
+	rng.Scope = scope
+	if v := q.Get("profile"); v != "" {
+		p, err := ecfr.ParseTextProfile(v)
+		if err != nil {
+			return rng, err
+		}
+		rng.Profile = p.String()
+	}
+	return rng, nil
+}
+
+// parseScope reads ?scope=own|rollup, defaulting to own.
+func parseScope(r *http.Request) (string, error) {
+	scope := r.URL.Query().Get("scope")
+	if scope == "" {
+		return store.ScopeOwn, nil
+	}
+	if !store.ValidScope(scope) {
+		return "", fmt.Errorf("invalid scope %q (want %s or %s)", scope, store.ScopeOwn, store.ScopeRollup)
+	}
+	return scope, nil
+}
+
+// titleAndDate reads the {n} path value and an optional ?date=, writing a 400
+// if either is malformed.
+func titleAndDate(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	n, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil {
+		http.Error(w, "invalid title", http.StatusBadRequest)
+		return 0, "", false
+	}
+	date := r.URL.Query().Get("date")
+	if date != "" {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			http.Error(w, fmt.Sprintf("invalid date %q (want YYYY-MM-DD)", date), http.StatusBadRequest)
+			return 0, "", false
+		}
+	}
+	return n, date, true
+}
+
+// rankRows orders rows by the numeric value key returns, largest first for
+// "desc" and smallest first for "asc"; rows without a number keep their
+// order after the others. "title" leaves rows as they are.
+func rankRows(rows []map[string]any, key func(map[string]any) any, order string) {
+	if order == "title" {
+		return
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, aok := key(rows[i]).(float64)
+		b, bok := key(rows[j]).(float64)
+		switch {
+		case aok && bok && order == "asc":
+			return a < b
+		case aok && bok:
+			return a > b
+		}
+		return aok && !bok
+	})
+}
+
+// unknownMetric returns the first name not in the catalog, or "".
+func unknownMetric(catalog []metrics.MetricInfo, names []string) string {
+	known := make(map[string]bool, len(catalog))
+	for _, m := range catalog {
+		known[m.Name] = true
+	}
+	for _, n := range names {
+		if !known[n] {
+			return n
+		}
+	}
+	return ""
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func cancelCommand(addr string, args []string) error {
+	fs := flag.NewFlagSet("cancel", flag.ContinueOnError)
+	server := fs.String("server", "", "server base URL (default derived from ADDR)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: server cancel [-server URL] <job-id>")
+	}
+	base := *server
+	if base == "" {
+		host := addr
+		if strings.HasPrefix(host, ":") {
+			host = "localhost" + host
+		}
+		base = "http://" + host
+	}
+	req, err := http.NewRequest(http.MethodDelete, strings.TrimRight(base, "/")+"/api/refresh/jobs/"+url.PathEscape(fs.Arg(0)), nil)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+	if res.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("cancel job %s: status=%d body=%q", fs.Arg(0), res.StatusCode, strings.TrimSpace(string(b)))
+	}
+	log.Printf("cancel requested for job %s", fs.Arg(0))
+	return nil
+}
+
+func lookupJob(w http.ResponseWriter, r *http.Request, deps serverDeps) (*refreshJob, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid job id", http.StatusBadRequest)
+		return nil, false
+	}
+	job, ok := deps.getJob(id)
+	if !ok {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return nil, false
+	}
+	return job, true
+}
+
+func writeEvent(w http.ResponseWriter, event string, v any) {
+	b, _ := json.Marshal(v)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+}
+
 func writeJSON(w http.ResponseWriter, code int, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
@@ -362,7 +1496,7 @@ func writeJSON(w http.ResponseWriter, code int, v any) {
 func withCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,DELETE,OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
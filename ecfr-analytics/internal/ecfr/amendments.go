@@ -0,0 +1,128 @@
+package ecfr
+
+import "strings"
+
+// Sources of a section's last-amended date, best first.
+const (
+	// AmendedVersions is the versioner's history of the section.
+	AmendedVersions = "versions"
+	// AmendedCitation is the section's own CITA note.
+	AmendedCitation = "citation"
+	// AmendedSource is the SOURCE note of its subpart or part, for sections
+	// unchanged since the part was published.
+	AmendedSource = "source"
+)
+
+// SectionAmendment is when a section or appendix was last amended. Chapter
+// is its ChapterKey. LastAmended is YYYY-MM-DD, or empty if neither its
+// history nor its notes give a date; Basis names the source of the date.
+type SectionAmendment struct {
+	Type        string
+	Identifier  string
+	Chapter     string
+	Part        string
+	Heading     string
+	LastAmended string
+	Basis       string
+}
+
+// VersionKey identifies a section or appendix across content versions and
+// title structure: "SECTION 60.1", "APPENDIX Appendix A to Part 60".
+func VersionKey(typ, identifier string) string {
+	return strings.ToUpper(typ) + " " + identifier
+}
+
+// LastAmendedVersions reduces a title's content versions to the date each
+// section and appendix was last substantively amended, by VersionKey.
+// Versions on the first date of the history say nothing about when a section
+// was amended, since the versioner loaded every section then, and are left
+// out.
+func LastAmendedVersions(versions []ContentVersion) map[string]string {
+	first := ""
+	for _, v := range versions {
+		if d := versionDate(v); d != "" && (first == "" || d < first) {
+			first = d
+		}
+	}
+	out := map[string]string{}
+	for _, v := range versions {
+		typ := strings.ToUpper(v.Type)
+		if typ != "SECTION" && typ != "APPENDIX" || !v.Substantive {
+			continue
+		}
+		d := versionDate(v)
+		if d == "" || d == first {
+			continue
+		}
+		k := VersionKey(typ, v.Identifier)
+		if d > out[k] {
+			out[k] = d
+		}
+	}
+	return out
+}
+
+func versionDate(v ContentVersion) string {
+	if v.AmendmentDate != "" {
+		return v.AmendmentDate
+	}
+	return v.Date
+}
+
+// LastAmended dates every section and appendix in sections, a title's
+// ScanTitleStructure divisions, in order: the later of its latest version in
+// versions (from LastAmendedVersions) and the latest dated citation in its
+// CITA note, or else the latest dated citation in the SOURCE note of its
+// subpart or part. Reserved sections are left out.
+func LastAmended(sections []Section, versions map[string]string) []SectionAmendment {
+	sources := map[string]string{}
+	for _, s := range sections {
+		switch s.Type {
+		case "PART":
+			sources[s.Part] = s.Source
+		case "SUBPART":
+			sources[s.Part+"/"+s.Identifier] = s.Source
+		}
+	}
+	var out []SectionAmendment
+	for _, s := range sections {
+		if s.Type != "SECTION" && s.Type != "APPENDIX" || IsReserved(s.Heading) {
+			continue
+		}
+		a := SectionAmendment{
+			Type:       s.Type,
+			Identifier: s.Identifier,
+			Chapter:    ChapterKey(s.Subtitle, s.Chapter),
+			Part:       s.Part,
+			Heading:    s.Heading,
+		}
+		if d := versions[VersionKey(s.Type, s.Identifier)]; d != "" {
+			a.LastAmended, a.Basis = d, AmendedVersions
+		}
+		if d := latestFRDate(s.History); d > a.LastAmended {
+			a.LastAmended, a.Basis = d, AmendedCitation
+		}
+		if a.LastAmended == "" {
+			src := sources[s.Part+"/"+s.Subpart]
+			if s.Subpart == "" || src == "" {
+				src = sources[s.Part]
+			}
+			if d := latestFRDate(src); d != "" {
+				a.LastAmended, a.Basis = d, AmendedSource
+			}
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// latestFRDate is the latest date of the Federal Register citations in text.
+func latestFRDate(text string) string {
+	latest := ""
+	for _, c := range ParseFRCitations(text) {
+		if c.Date > latest {
+			latest = c.Date
+		}
+	}
+	return latest
+}
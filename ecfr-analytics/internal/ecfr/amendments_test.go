@@ -0,0 +1,84 @@
+package ecfr
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLastAmendedVersions(t *testing.T) {
+	versions := []ContentVersion{
+		{AmendmentDate: "2017-01-03", Identifier: "60.1", Type: "section", Substantive: true},
+		{AmendmentDate: "2017-01-03", Identifier: "60.2", Type: "section", Substantive: true},
+		{AmendmentDate: "2020-05-01", Identifier: "60.1", Type: "section", Substantive: true},
+		{AmendmentDate: "2019-02-01", Identifier: "60.1", Type: "section", Substantive: true},
+		{AmendmentDate: "2023-07-01", Identifier: "60.2", Type: "section", Substantive: false},
+		{AmendmentDate: "2021-03-04", Identifier: "Appendix A to Part 60", Type: "appendix", Substantive: true},
+		{AmendmentDate: "2022-01-01", Identifier: "60", Type: "part", Substantive: true},
+	}
+	got := LastAmendedVersions(versions)
+	want := map[string]string{
+		"SECTION 60.1":                   "2020-05-01",
+		"APPENDIX Appendix A to Part 60": "2021-03-04",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("%s: got %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestLastAmended(t *testing.T) {
+	xml := `
+<ECFR>
+<DIV3 N="I" TYPE="CHAPTER">
+<DIV5 N="60" TYPE="PART">
+<HEAD>PART 60—STANDARDS</HEAD>
+<SOURCE><HED>Source:</HED><PSPACE>36 FR 24877, Dec. 23, 1971, unless otherwise noted.</PSPACE></SOURCE>
+<DIV6 N="A" TYPE="SUBPART">
+<HEAD>Subpart A—General</HEAD>
+<SOURCE><HED>Source:</HED><PSPACE>40 FR 53346, Nov. 17, 1975.</PSPACE></SOURCE>
+<DIV8 N="60.1" TYPE="SECTION"><HEAD>§ 60.1 Applicability.</HEAD><P>Text.</P>
+<CITA TYPE="N">[40 FR 53346, Nov. 17, 1975, as amended at 65 FR 61744, Oct. 17, 2000]</CITA></DIV8>
+<DIV8 N="60.2" TYPE="SECTION"><HEAD>§ 60.2 Definitions.</HEAD><P>Text.</P></DIV8>
+</DIV6>
+<DIV8 N="60.3" TYPE="SECTION"><HEAD>§ 60.3 [Reserved]</HEAD></DIV8>
+<DIV8 N="60.4" TYPE="SECTION"><HEAD>§ 60.4 Address.</HEAD><P>Text.</P>
+<CITA TYPE="N">[44 FR 55173, Sept. 25, 1979]</CITA></DIV8>
+<DIV8 N="60.5" TYPE="SECTION"><HEAD>§ 60.5 Determination.</HEAD><P>Text.</P></DIV8>
+</DIV5>
+<DIV5 N="61" TYPE="PART">
+<HEAD>PART 61—HAZARDOUS</HEAD>
+<DIV8 N="61.1" TYPE="SECTION"><HEAD>§ 61.1 Applicability.</HEAD><P>Text.</P></DIV8>
+</DIV5>
+</DIV3>
+</ECFR>`
+	var sections []Section
+	err := ScanTitleStructure(strings.NewReader(xml), func(s Section) error {
+		sections = append(sections, s)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	versions := map[string]string{"SECTION 60.1": "1999-02-01", "SECTION 60.4": "2021-06-30"}
+	got := LastAmended(sections, versions)
+	want := []struct{ id, date, basis string }{
+		{"60.1", "2000-10-17", AmendedCitation},
+		{"60.2", "1975-11-17", AmendedSource},
+		{"60.4", "2021-06-30", AmendedVersions},
+		{"60.5", "1971-12-23", AmendedSource},
+		{"61.1", "", ""},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d sections, got %#v", len(want), got)
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Identifier != w.id || g.LastAmended != w.date || g.Basis != w.basis || g.Chapter != "I" {
+			t.Fatalf("section %d: got %#v, want %+v", i, g, w)
+		}
+	}
+}
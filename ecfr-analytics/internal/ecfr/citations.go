@@ -0,0 +1,237 @@
+package ecfr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CitationsVersion identifies how citations and the structure they are
+// resolved against are extracted. Bump it whenever ExtractCitations or
+// ScanTitleStructure changes so that stored citations are extracted again.
+const CitationsVersion = 6
+
+// Citation kinds.
+const (
+	CitationCFR = "cfr"
+	CitationUSC = "usc"
+)
+
+// Citation is a reference to the CFR or the U.S. Code. A CFR citation names a
+// part ("40 CFR part 63") or a section ("40 CFR 60.5", with Part "60"); a
+// U.S.C. citation names a section. Part and Section are empty when a whole
+// title is meant. Through is set for a range ("§§ 60.1 through 60.10") and
+// names its last part or section; Part and Section name its first.
+type Citation struct {
+	Kind    string `json:"kind"`
+	Title   int    `json:"title"`
+	Part    string `json:"part,omitempty"`
+	Section string `json:"section,omitempty"`
+	Through string `json:"through,omitempty"`
+}
+
+func (c Citation) String() string {
+	through := ""
+	if c.Through != "" {
+		through = " through " + c.Through
+	}
+	if c.Kind == CitationUSC {
+		return strings.TrimSpace(fmt.Sprintf("%d U.S.C. %s%s", c.Title, c.Section, through))
+	}
+	switch {
+	case c.Section != "":
+		return fmt.Sprintf("%d CFR %s%s", c.Title, c.Section, through)
+	case c.Part != "" && through != "":
+		return fmt.Sprintf("%d CFR parts %s%s", c.Title, c.Part, through)
+	case c.Part != "":
+		return fmt.Sprintf("%d CFR part %s", c.Title, c.Part)
+	}
+	return fmt.Sprintf("%d CFR", c.Title)
+}
+
+// Citation items: a CFR part ("63", "101-19") or section ("60.5",
+// "1910.1200a", "2610.0-8", "101-19.600"), or a U.S.C. section ("7411",
+// "552a", "300j-4"), each optionally followed by paragraph designations
+// ("(a)(1)") that are dropped.
+const (
+	cfrItem    = `\d+[A-Za-z]*(?:-\d+)?(?:\.\d+[A-Za-z0-9]*(?:-\d+)?)?(?:\([A-Za-z0-9]{1,4}\))*`
+	cfrSecItem = `\d+[A-Za-z]*(?:-\d+)?\.\d+[A-Za-z0-9]*(?:-\d+)?(?:\([A-Za-z0-9]{1,4}\))*`
+	uscItem    = `\d+[A-Za-z]*(?:-\d+[A-Za-z]*)?(?:\([A-Za-z0-9]{1,4}\))*`
+	listSep    = `(?:\s*,\s*(?:and\s+|or\s+)?|\s+(?:and|or|through)\s+)`
+)
+
+// citationList matches a list of items, each after the first optionally
+// preceded by prefix.
+func citationList(item, prefix string) string {
+	return `(` + item + `(?:` + listSep + prefix + item + `)*)`
+}
+
+// sectionSign matches "§", "§§", "Sec." or "Secs.".
+const sectionSign = `(?:§§?|Secs?\.)`
+
+// citationRe matches, in order of preference: "40 CFR [part|§] <list>",
+// "42 U.S.C. [§] <list>", "§[§] <section list>" and "part[s] <list> of this
+// chapter|subchapter|title". The last two cite the citing title. "CFR" may be
+// in any case, and "Sec." stands for "§".
+var citationRe = regexp.MustCompile(
+	`\b(\d{1,2})\s?(?i:C\.?\s?F\.?\s?R)\.?\s+(?:[Pp]arts?\s+|` + sectionSign + `\s*)?` + citationList(cfrItem, `(?:`+sectionSign+`\s*)?`) +
+		`|\b(\d{1,2})\s?U\.?\s?S\.?\s?C\.?\s+(?:` + sectionSign + `\s*)?` + citationList(uscItem, "") +
+		`|` + sectionSign + `\s*` + citationList(cfrSecItem, `(?:`+sectionSign+`\s*)?`) +
+		`|\b[Pp]arts?\s+` + citationList(`\d+[A-Za-z]?`, "") + `\s+of\s+this\s+(?:chapter|subchapter|title)\b`)
+
+var (
+	// citationItemRe matches list items and, to skip them, paragraph
+	// designations.
+	citationItemRe = regexp.MustCompile(`\([A-Za-z0-9]{1,4}\)|\d+[A-Za-z]*(?:[.-]\d+[A-Za-z0-9]*)*`)
+	// codeRe matches the code named after a title number.
+	codeRe = regexp.MustCompile(`^\s?(?:(?i:C\.?\s?F\.?\s?R)|U\.?\s?S\.?\s?C)\.?\s`)
+	// rangeRe matches a section range written with a hyphen ("76.51-76.70").
+	rangeRe = regexp.MustCompile(`^(\d+[A-Za-z]*(?:-\d+)?\.\d+[A-Za-z0-9]*)-(\d+[A-Za-z]*(?:-\d+)?\.\d+[A-Za-z0-9]*)`)
+	// throughRe matches the separator of a range in a list.
+	throughRe = regexp.MustCompile(`\bthrough\b`)
+	// elsewhereRe matches what may follow "§ 60.5" to place it in another
+	// title ("of title 5") or another document: a named act, code or treaty
+	// ("of the Act", "of the Clean Air Act", "of the U.S.C.") or an acronym
+	// ("of the ITAR"). Other prose ("§ 60.5, in the case of") leaves the
+	// citation in the citing title.
+	elsewhereRe = regexp.MustCompile(`^,?\s+(?:of|in)\s+(?:title\s+(\d{1,2})\b|the\s+` +
+		`(?:[A-Z][\w.'-]*,?\s+(?:(?:and|of|the)\s+)*){0,8}(?:Act|Code|U\.\s?S\.\s?C|Constitution|Convention|Treaty|Agreement)\b|` +
+		`the\s+[A-Z]{2,}\b)`)
+)
+
+// ExtractCitations returns the CFR and U.S.C. citations in text in order of
+// appearance, repeats included. Citations that do not name a title ("see
+// § 60.5", "part 63 of this chapter") are taken to be to title, the citing
+// title, unless followed by "of title 5"; sections of other documents ("§ 5
+// of the Act", "§ 126.18 of the ITAR") are skipped. A list ("§§ 60.5 and
+// 60.6", "40 CFR parts 60, 61 and 63") yields a citation per item and a
+// range ("§§ 60.1 through 60.10", "47 CFR 76.51-76.70") one citation with
+// Through set. Paragraph designations are dropped, so "40 CFR 60.5(a)(1)"
+// cites section 60.5.
+func ExtractCitations(text string, title int) []Citation {
+	var out []Citation
+	scanCitations(text, title, func(c Citation, _, _ int) {
+		out = append(out, c)
+	})
+	return out
+}
+
+var wholeTitleRe = regexp.MustCompile(`^(\d{1,2})\s?(?:(?i:C\.?\s?F\.?\s?R)|U\.?\s?S\.?\s?C)\.?$`)
+
+// ParseCitation parses s as exactly one citation: a CFR part or section, a
+// U.S.C. section, or a whole title ("40 CFR", "42 U.S.C."). Ranges are not
+// accepted.
+func ParseCitation(s string) (Citation, bool) {
+	s = strings.TrimSpace(s)
+	if m := wholeTitleRe.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		kind := CitationCFR
+		if strings.Contains(strings.ToUpper(s), "U") {
+			kind = CitationUSC
+		}
+		return Citation{Kind: kind, Title: n}, n > 0
+	}
+	var found []Citation
+	whole := false
+	scanCitations(s, 0, func(c Citation, start, end int) {
+		found = append(found, c)
+		whole = start == 0 && end == len(s)
+	})
+	if len(found) != 1 || !whole || found[0].Title == 0 || found[0].Through != "" {
+		return Citation{}, false
+	}
+	return found[0], true
+}
+
+// scanCitations calls fn with each citation in text and the bounds of the
+// match it came from. A list ends early at an item of a different shape from
+// its first ("40 CFR 60.5, 2 days" does not cite part 2) or one that is the
+// title of another citation ("§ 60.5 and 42 U.S.C. 7411"); scanning resumes
+// there. An item after "through" ends the range begun by the one before.
+func scanCitations(text string, title int, fn func(c Citation, start, end int)) {
+	for pos := 0; pos < len(text); {
+		m := citationRe.FindStringSubmatchIndex(text[pos:])
+		if m == nil {
+			return
+		}
+		for i := range m {
+			if m[i] >= 0 {
+				m[i] += pos
+			}
+		}
+		pos = m[1]
+		kind, t, g := CitationCFR, title, 0
+		switch {
+		case m[2] >= 0:
+			t, _ = strconv.Atoi(text[m[2]:m[3]])
+			g = 2
+		case m[6] >= 0:
+			kind = CitationUSC
+			t, _ = strconv.Atoi(text[m[6]:m[7]])
+			g = 4
+		case m[10] >= 0:
+			g = 5
+			if e := elsewhereRe.FindStringSubmatch(text[m[1]:]); e != nil {
+				if e[1] == "" {
+					continue
+				}
+				t, _ = strconv.Atoi(e[1])
+			}
+		default:
+			g = 6
+		}
+		if t < 1 {
+			continue
+		}
+		listStart, list := m[2*g], text[m[2*g]:m[2*g+1]]
+		section := false
+		n, prevEnd := 0, 0
+		// last is held back until the next item shows whether it begins a
+		// range.
+		var last *Citation
+		for _, im := range citationItemRe.FindAllStringIndex(list, -1) {
+			item := list[im[0]:im[1]]
+			if item[0] == '(' {
+				continue
+			}
+			if n > 0 && codeRe.MatchString(text[listStart+im[1]:]) {
+				pos = listStart + im[0]
+				break
+			}
+			c := Citation{Kind: kind, Title: t}
+			if r := rangeRe.FindStringSubmatch(text[listStart+im[0]:]); r != nil {
+				item, c.Through = r[1], r[2]
+			}
+			if kind == CitationUSC {
+				c.Section = item
+			} else {
+				part, _, isSection := strings.Cut(item, ".")
+				if n == 0 {
+					section = isSection
+				} else if isSection != section {
+					pos = listStart + im[0]
+					break
+				}
+				c.Part = part
+				if isSection {
+					c.Section = item
+				}
+			}
+			n++
+			through := last != nil && last.Through == "" && c.Through == "" && throughRe.MatchString(list[prevEnd:im[0]])
+			prevEnd = im[1]
+			if through {
+				last.Through = item
+				continue
+			}
+			if last != nil {
+				fn(*last, m[0], m[1])
+			}
+			last = &c
+		}
+		if last != nil {
+			fn(*last, m[0], m[1])
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package ecfr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractCitations(t *testing.T) {
+	cfr := func(title int, part, section string) Citation {
+		return Citation{Kind: CitationCFR, Title: title, Part: part, Section: section}
+	}
+	usc := func(title int, section string) Citation {
+		return Citation{Kind: CitationUSC, Title: title, Section: section}
+	}
+	through := func(c Citation, last string) Citation {
+		c.Through = last
+		return c
+	}
+	cases := []struct {
+		text string
+		want []Citation
+	}{
+		{"See § 60.5(a)(1) for details.", []Citation{cfr(40, "60", "60.5")}},
+		{"as required by §§ 60.5 and 60.6, and 2 days later", []Citation{cfr(40, "60", "60.5"), cfr(40, "60", "60.6")}},
+		{"subject to 40 CFR part 63, subpart A.", []Citation{cfr(40, "63", "")}},
+		{"under 40 CFR parts 60, 61, and 63", []Citation{cfr(40, "60", ""), cfr(40, "61", ""), cfr(40, "63", "")}},
+		{"in 5 CFR 2635.105, 2635.106.", []Citation{cfr(5, "2635", "2635.105"), cfr(5, "2635", "2635.106")}},
+		{"in 40 C.F.R. 60.5, 2 days", []Citation{cfr(40, "60", "60.5")}},
+		{"under section 111 of the Act (42 U.S.C. 7411(d)) and 5 U.S.C. 552a", []Citation{usc(42, "7411"), usc(5, "552a")}},
+		{"under 42 U.S.C. 7411, § 60.1(a) applies", []Citation{usc(42, "7411"), cfr(40, "60", "60.1")}},
+		{"per 42 U.S.C. 7411 and 40 CFR 60.5 and 42 U.S.C. 7412", []Citation{usc(42, "7411"), cfr(40, "60", "60.5"), usc(42, "7412")}},
+		{"pursuant to 42 U.S.C. 300j-4 or 300j-9", []Citation{usc(42, "300j-4"), usc(42, "300j-9")}},
+		{"in part 63 of this chapter", []Citation{cfr(40, "63", "")}},
+		{"see 41 CFR 101-19.600 and 43 CFR 2610.0-8", []Citation{cfr(41, "101-19", "101-19.600"), cfr(43, "2610", "2610.0-8")}},
+		{"Subpart D, 47 CFR 76.51-76.70.", []Citation{through(cfr(47, "76", "76.51"), "76.70")}},
+		{"as in §§ 60.1 through 60.10 and 60.12", []Citation{through(cfr(40, "60", "60.1"), "60.10"), cfr(40, "60", "60.12")}},
+		{"under 40 CFR parts 60 through 63", []Citation{through(cfr(40, "60", ""), "63")}},
+		{"see Sec. 60.5(b) and Secs. 60.6 and 60.7", []Citation{cfr(40, "60", "60.5"), cfr(40, "60", "60.6"), cfr(40, "60", "60.7")}},
+		{"Sec. 5 of the Act", nil},
+		{"under 40 cfr 60.5 and 29 Cfr part 1910", []Citation{cfr(40, "60", "60.5"), cfr(29, "1910", "")}},
+		{"under § 126.18 of the ITAR (22 CFR 126.18) and § 2.5 of title 5", []Citation{cfr(22, "126", "126.18"), cfr(5, "2", "2.5")}},
+		{"§ 60.5, in the case of a new source, and § 7 of the Clean Air Act", []Citation{cfr(40, "60", "60.5")}},
+		{"under § 60.5 of the Federal Food, Drug, and Cosmetic Act or § 60.6 of the Administrator", []Citation{cfr(40, "60", "60.6")}},
+		{"in 5 U.S.C. chapter 81 and 3 CFR, 1990 Comp.", nil},
+		{"this part applies to 25 facilities", nil},
+	}
+	for _, c := range cases {
+		if got := ExtractCitations(c.text, 40); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ExtractCitations(%q) = %v, want %v", c.text, got, c.want)
+		}
+	}
+}
+
+func TestParseCitation(t *testing.T) {
+	cases := []struct {
+		in   string
+		want Citation
+		ok   bool
+	}{
+		{"40 CFR 60.5", Citation{Kind: CitationCFR, Title: 40, Part: "60", Section: "60.5"}, true},
+		{" 40 CFR part 63 ", Citation{Kind: CitationCFR, Title: 40, Part: "63"}, true},
+		{"42 U.S.C. 7411", Citation{Kind: CitationUSC, Title: 42, Section: "7411"}, true},
+		{"40 CFR", Citation{Kind: CitationCFR, Title: 40}, true},
+		{"42 USC", Citation{Kind: CitationUSC, Title: 42}, true},
+		{"§ 60.5", Citation{}, false},
+		{"40 CFR 60.5 and 60.6", Citation{}, false},
+		{"40 CFR 60.1 through 60.10", Citation{}, false},
+		{"40 cfr 60.5", Citation{Kind: CitationCFR, Title: 40, Part: "60", Section: "60.5"}, true},
+		{"see 40 CFR 60.5", Citation{}, false},
+	}
+	for _, c := range cases {
+		got, ok := ParseCitation(c.in)
+		if got != c.want || ok != c.ok {
+			t.Errorf("ParseCitation(%q) = %v, %v; want %v, %v", c.in, got, ok, c.want, c.ok)
+		}
+	}
+	for _, s := range []string{"40 CFR 60.5", "40 CFR part 63", "42 U.S.C. 7411", "40 CFR"} {
+		c, _ := ParseCitation(s)
+		if c.String() != s {
+			t.Errorf("ParseCitation(%q).String() = %q", s, c.String())
+		}
+	}
+}
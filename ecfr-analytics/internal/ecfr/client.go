@@ -54,6 +54,27 @@ func (c *Client) GetAgencies(ctx context.Context) ([]Agency, error) {
 	return resp.Agencies, nil
 }
 
+func (c *Client) GetTitleVersions(ctx context.Context, title int, from, to string) ([]ContentVersion, error) {
+	q := url.Values{}
+	if from != "" {
+		q.Set("issue_date[gte]", from)
+	}
+	if to != "" {
+		q.Set("issue_date[lte]", to)
+	}
+	u := fmt.Sprintf("%s/api/versioner/v1/versions/title-%d.json", c.base, title)
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	var resp struct {
+		ContentVersions []ContentVersion `json:"content_versions"`
+	}
+	if err := c.getJSON(ctx, u, &resp); err != nil {
+		return nil, err
+	}
+	return resp.ContentVersions, nil
+}
+
 func (c *Client) GetFullTitleXML(ctx context.Context, date string, title int) ([]byte, error) {
 	u := fmt.Sprintf("%s/api/versioner/v1/full/%s/title-%d.xml", c.base, url.PathEscape(date), title)
 	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
@@ -24,6 +24,11 @@ func TestClientEndpoints(t *testing.T) {
 			body = `{"titles":[{"number":1,"name":"Title 1","up_to_date_as_of":"2025-01-02","reserved":false}]}`
 		case "/api/admin/v1/agencies.json":
 			body = `{"agencies":[{"name":"Agency","slug":"agency","cfr_references":[{"title":1,"chapter":"I"}]}]}`
+		case "/api/versioner/v1/versions/title-1.json":
+			if req.URL.Query().Get("issue_date[gte]") != "2025-01-01" {
+				t.Errorf("unexpected versions query: %s", req.URL.RawQuery)
+			}
+			body = `{"content_versions":[{"date":"2025-01-02","amendment_date":"2025-01-02","issue_date":"2025-01-02","identifier":"1.1","part":"1","type":"section","substantive":true,"removed":false}]}`
 		case "/api/versioner/v1/full/2025-01-02/title-1.xml":
 			body = `<ROOT><DIV1 TYPE="CHAPTER" N="I"><P>Hi</P></DIV1></ROOT>`
 		default:
@@ -59,6 +64,14 @@ func TestClientEndpoints(t *testing.T) {
 		t.Fatalf("unexpected agencies: %#v", agencies)
 	}
 
+	versions, err := cli.GetTitleVersions(ctx, 1, "2025-01-01", "2025-01-31")
+	if err != nil {
+		t.Fatalf("get versions: %v", err)
+	}
+	if len(versions) != 1 || versions[0].Date != "2025-01-02" || !versions[0].Substantive {
+		t.Fatalf("unexpected versions: %#v", versions)
+	}
+
 	xml, err := cli.GetFullTitleXML(ctx, "2025-01-02", 1)
 	if err != nil {
 		t.Fatalf("get xml: %v", err)
@@ -0,0 +1,316 @@
+package ecfr
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+
+	OpEqual  = "="
+	OpInsert = "+"
+	OpDelete = "-"
+)
+
+// Unchanged runs longer than twice this many words are elided in the middle.
+const diffContextWords = 12
+
+// Beyond this many edits a section is reported as a whole-text replacement
+// rather than a word-level diff, to bound time and memory.
+const maxDiffEdits = 1000
+
+type SectionChange struct {
+	Change       string   `json:"change"`
+	Key          string   `json:"-"`
+	Type         string   `json:"type"`
+	Identifier   string   `json:"identifier"`
+	Part         string   `json:"part,omitempty"`
+	Heading      string   `json:"heading"`
+	WordsAdded   int      `json:"words_added"`
+	WordsRemoved int      `json:"words_removed"`
+	Ops          []WordOp `json:"ops,omitempty"`
+}
+
+type WordOp struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// SectionSum identifies one section or appendix of a snapshot and digests its
+// words, so two snapshots can be compared without holding their text. Key is
+// the type and identifier, with repeats of an identifier numbered by
+// occurrence so they still pair up across snapshots.
+type SectionSum struct {
+	Key        string
+	Type       string
+	Identifier string
+	Part       string
+	Heading    string
+	Checksum   string
+}
+
+// sectionKeys numbers repeated section identifiers within one snapshot.
+type sectionKeys map[string]bool
+
+func (seen sectionKeys) key(typ, id string) string {
+	k := typ + ":" + id
+	for i := 2; seen[k]; i++ {
+		k = fmt.Sprintf("%s:%s#%d", typ, id, i)
+	}
+	seen[k] = true
+	return k
+}
+
+// sectionWords is a section's heading and text as words.
+func sectionWords(s Section) []string {
+	return strings.Fields(s.Heading + " " + s.Text)
+}
+
+// SumSections streams a title snapshot and digests its sections and
+// appendices in document order.
+func SumSections(r io.Reader) ([]SectionSum, error) {
+	seen := sectionKeys{}
+	var out []SectionSum
+	err := ScanTitleSections(r, func(s Section) error {
+		out = append(out, SectionSum{
+			Key:        seen.key(s.Type, s.Identifier),
+			Type:       s.Type,
+			Identifier: s.Identifier,
+			Part:       s.Part,
+			Heading:    s.Heading,
+			Checksum:   ChecksumHex(strings.Join(sectionWords(s), " ")),
+		})
+		return nil
+	})
+	return out, err
+}
+
+// SectionTexts streams a title snapshot and returns the words of the
+// sections whose keys are in keys, joined by single spaces.
+func SectionTexts(r io.Reader, keys map[string]bool) (map[string]string, error) {
+	seen := sectionKeys{}
+	out := map[string]string{}
+	err := ScanTitleSections(r, func(s Section) error {
+		if k := seen.key(s.Type, s.Identifier); keys[k] {
+			out[k] = strings.Join(sectionWords(s), " ")
+		}
+		return nil
+	})
+	return out, err
+}
+
+// DiffSections compares the section digests of two title snapshots, matching
+// them by key. Changes are returned in the order the sections appear in to,
+// followed by removed sections in from order. They carry no word counts or
+// ops until Describe is called with the sections' text.
+func DiffSections(from, to []SectionSum) []SectionChange {
+	fromIdx := make(map[string]SectionSum, len(from))
+	for _, s := range from {
+		fromIdx[s.Key] = s
+	}
+	toKeys := make(map[string]bool, len(to))
+	out := []SectionChange{}
+	for _, cur := range to {
+		toKeys[cur.Key] = true
+		prev, ok := fromIdx[cur.Key]
+		if ok && prev.Checksum == cur.Checksum {
+			continue
+		}
+		change := ChangeModified
+		if !ok {
+			change = ChangeAdded
+		}
+		out = append(out, SectionChange{Change: change, Key: cur.Key, Type: cur.Type, Identifier: cur.Identifier, Part: cur.Part, Heading: cur.Heading})
+	}
+	for _, prev := range from {
+		if toKeys[prev.Key] {
+			continue
+		}
+		out = append(out, SectionChange{Change: ChangeRemoved, Key: prev.Key, Type: prev.Type, Identifier: prev.Identifier, Part: prev.Part, Heading: prev.Heading})
+	}
+	return out
+}
+
+// Describe fills in c's word counts and ops from the section's text in the
+// from and to snapshots, as returned by SectionTexts.
+func (c *SectionChange) Describe(from, to string) {
+	a, b := strings.Fields(from), strings.Fields(to)
+	switch c.Change {
+	case ChangeAdded:
+		c.WordsAdded = len(b)
+		c.Ops = []WordOp{{Op: OpInsert, Text: strings.Join(b, " ")}}
+	case ChangeRemoved:
+		c.WordsRemoved = len(a)
+		c.Ops = []WordOp{{Op: OpDelete, Text: strings.Join(a, " ")}}
+	default:
+		c.Ops, c.WordsAdded, c.WordsRemoved = DiffWords(a, b)
+	}
+}
+
+// DiffWords returns the word-level edit script turning a into b, with runs of
+// the same operation merged and long unchanged runs elided.
+func DiffWords(a, b []string) (ops []WordOp, added, removed int) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var script []byte
+	midA := a[prefix : len(a)-suffix]
+	midB := b[prefix : len(b)-suffix]
+	mid, ok := myers(midA, midB)
+	if !ok {
+		mid = make([]byte, 0, len(midA)+len(midB))
+		for range midA {
+			mid = append(mid, '-')
+		}
+		for range midB {
+			mid = append(mid, '+')
+		}
+	}
+	for i := 0; i < prefix; i++ {
+		script = append(script, '=')
+	}
+	script = append(script, mid...)
+	for i := 0; i < suffix; i++ {
+		script = append(script, '=')
+	}
+
+	var run []string
+	runOp := byte(0)
+	flush := func() {
+		if len(run) == 0 {
+			return
+		}
+		op := WordOp{Op: string(runOp), Text: strings.Join(run, " ")}
+		if runOp == '=' && len(run) > 2*diffContextWords {
+			op.Text = strings.Join(run[:diffContextWords], " ") + " … " + strings.Join(run[len(run)-diffContextWords:], " ")
+		}
+		ops = append(ops, op)
+		run = run[:0]
+	}
+	i, j := 0, 0
+	for _, c := range script {
+		if c != runOp {
+			flush()
+			runOp = c
+		}
+		switch c {
+		case '=':
+			run = append(run, b[j])
+			i++
+			j++
+		case '-':
+			run = append(run, a[i])
+			i++
+			removed++
+		case '+':
+			run = append(run, b[j])
+			j++
+			added++
+		}
+	}
+	flush()
+	return ops, added, removed
+}
+
+// myers computes a shortest edit script of '=', '-' and '+' steps. It gives
+// up (ok=false) past maxDiffEdits edits.
+func myers(a, b []string) (script []byte, ok bool) {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		for range a {
+			script = append(script, '-')
+		}
+		for range b {
+			script = append(script, '+')
+		}
+		return script, true
+	}
+	maxD := n + m
+	if maxD > maxDiffEdits {
+		maxD = maxDiffEdits
+	}
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	// trace[d] holds v[-d-1..d+1] as it was before round d.
+	var trace [][]int
+	for d := 0; d <= maxD; d++ {
+		snap := make([]int, 2*d+3)
+		copy(snap, v[offset-d-1:offset+d+2])
+		trace = append(trace, snap)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, n, m), true
+			}
+		}
+	}
+	return nil, false
+}
+
+func backtrack(trace [][]int, n, m int) []byte {
+	var rev []byte
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		at := func(k int) int { return v[k+d+1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			rev = append(rev, '=')
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				rev = append(rev, '+')
+			} else {
+				rev = append(rev, '-')
+			}
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(rev)-1; i < j; i, j = i+1, j-1 {
+		rev[i], rev[j] = rev[j], rev[i]
+	}
+	return rev
+}
+
+func equalWords(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
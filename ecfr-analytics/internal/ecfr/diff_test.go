@@ -0,0 +1,115 @@
+package ecfr
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestDiffWords(t *testing.T) {
+	a := strings.Fields("the operator shall keep records for three years")
+	b := strings.Fields("the owner or operator must keep records for five years")
+	ops, added, removed := DiffWords(a, b)
+	if added != 4 || removed != 2 {
+		t.Fatalf("unexpected counts: +%d -%d (%#v)", added, removed, ops)
+	}
+	if applyOps(a, ops) != strings.Join(b, " ") {
+		t.Fatalf("ops do not rebuild target: %#v", ops)
+	}
+}
+
+func TestDiffWordsRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	vocab := []string{"a", "b", "c", "d", "e"}
+	for i := 0; i < 200; i++ {
+		a := make([]string, rng.Intn(30))
+		for j := range a {
+			a[j] = vocab[rng.Intn(len(vocab))]
+		}
+		b := make([]string, rng.Intn(30))
+		for j := range b {
+			b[j] = vocab[rng.Intn(len(vocab))]
+		}
+		ops, _, _ := DiffWords(a, b)
+		if got := applyOps(a, ops); got != strings.Join(b, " ") {
+			t.Fatalf("case %d: %v -> %v rebuilt %q", i, a, b, got)
+		}
+	}
+}
+
+// applyOps rebuilds the target text; it only works when no equal run was elided.
+func applyOps(a []string, ops []WordOp) string {
+	var out []string
+	for _, op := range ops {
+		if op.Op != OpDelete {
+			out = append(out, strings.Fields(op.Text)...)
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+func TestDiffSections(t *testing.T) {
+	fromXML := `
+<ECFR><DIV1 N="1" TYPE="TITLE"><DIV5 N="1" TYPE="PART">
+<DIV8 N="1.1" TYPE="SECTION"><HEAD>§ 1.1 Definitions.</HEAD><P>Agency means each authority.</P></DIV8>
+<DIV8 N="1.2" TYPE="SECTION"><HEAD>§ 1.2 Scope.</HEAD><P>This part applies.</P></DIV8>
+<DIV8 N="1.3" TYPE="SECTION"><HEAD>§ 1.3 Old.</HEAD><P>Removed text.</P></DIV8>
+</DIV5></DIV1></ECFR>`
+	toXML := `
+<ECFR><DIV1 N="1" TYPE="TITLE"><DIV5 N="1" TYPE="PART">
+<DIV8 N="1.1" TYPE="SECTION"><HEAD>§ 1.1 Definitions.</HEAD><P>Agency means every authority.</P></DIV8>
+<DIV8 N="1.2" TYPE="SECTION"><HEAD>§ 1.2 Scope.</HEAD><P>This part applies.</P></DIV8>
+<DIV8 N="1.4" TYPE="SECTION"><HEAD>§ 1.4 New.</HEAD><P>Added text here.</P></DIV8>
+</DIV5></DIV1></ECFR>`
+	from, err := SumSections(strings.NewReader(fromXML))
+	if err != nil {
+		t.Fatalf("sum from: %v", err)
+	}
+	to, err := SumSections(strings.NewReader(toXML))
+	if err != nil {
+		t.Fatalf("sum to: %v", err)
+	}
+
+	changes := DiffSections(from, to)
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 changes, got %#v", changes)
+	}
+	keys := map[string]bool{}
+	for _, c := range changes {
+		keys[c.Key] = true
+	}
+	fromText, err := SectionTexts(strings.NewReader(fromXML), keys)
+	if err != nil {
+		t.Fatalf("from text: %v", err)
+	}
+	toText, err := SectionTexts(strings.NewReader(toXML), keys)
+	if err != nil {
+		t.Fatalf("to text: %v", err)
+	}
+	if len(fromText) != 2 || len(toText) != 2 {
+		t.Fatalf("unexpected section texts: %#v %#v", fromText, toText)
+	}
+	for i := range changes {
+		changes[i].Describe(fromText[changes[i].Key], toText[changes[i].Key])
+	}
+	mod, add, rem := changes[0], changes[1], changes[2]
+	if mod.Change != ChangeModified || mod.Identifier != "1.1" || mod.Part != "1" || mod.WordsAdded != 1 || mod.WordsRemoved != 1 {
+		t.Fatalf("unexpected modified change: %#v", mod)
+	}
+	if add.Change != ChangeAdded || add.Identifier != "1.4" || add.WordsAdded != 6 {
+		t.Fatalf("unexpected added change: %#v", add)
+	}
+	if rem.Change != ChangeRemoved || rem.Identifier != "1.3" || rem.WordsRemoved != 5 {
+		t.Fatalf("unexpected removed change: %#v", rem)
+	}
+}
+
+func TestSumSectionsNumbersRepeats(t *testing.T) {
+	sums, err := SumSections(strings.NewReader(`<ECFR><DIV5 N="1" TYPE="PART">
+<DIV8 N="1.1" TYPE="SECTION"><P>One.</P></DIV8>
+<DIV8 N="1.1" TYPE="SECTION"><P>Two.</P></DIV8>
+</DIV5></ECFR>`))
+	if err != nil || len(sums) != 2 || sums[0].Key != "SECTION:1.1" || sums[1].Key != "SECTION:1.1#2" {
+		t.Fatalf("unexpected sums: %#v %v", sums, err)
+	}
+}
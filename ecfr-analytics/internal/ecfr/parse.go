@@ -1,11 +1,11 @@
 package ecfr
 
 import (
-	"bufio"
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/xml"
+	"hash"
 	"io"
 	"regexp"
 	"strings"
@@ -20,55 +20,183 @@ type ChapterAgg struct {
 var wsRe = regexp.MustCompile(`\s+`)
 
 func ParseTitleChapters(xmlBytes []byte) (map[string]string, error) {
-	dec := xml.NewDecoder(bytes.NewReader(xmlBytes))
-	dec.Strict = false
+	return ParseTitleChaptersReader(bytes.NewReader(xmlBytes))
+}
 
+// ParseTitleChaptersReader returns the text of every chapter in r, as
+// DefaultTextProfile counts it.
+func ParseTitleChaptersReader(r io.Reader) (map[string]string, error) {
 	chapters := map[string]*ChapterAgg{}
-	currentChapter := "UNKNOWN"
-	get := func(ch string) *ChapterAgg {
-		if a, ok := chapters[ch]; ok {
-			return a
+	err := walkTitleText(r, DefaultTextProfile, func(subtitle, chapter, _, s string) {
+		ch := ChapterKey(subtitle, chapter)
+		a, ok := chapters[ch]
+		if !ok {
+			a = &ChapterAgg{Chapter: ch}
+			chapters[ch] = a
 		}
-		a := &ChapterAgg{Chapter: ch}
-		chapters[ch] = a
-		return a
+		a.Text.WriteString(s)
+		a.Text.WriteByte(' ')
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]string, len(chapters))
+	for ch, a := range chapters {
+		out[ch] = wsRe.ReplaceAllString(a.Text.String(), " ")
+	}
+	return out, nil
+}
+
+// ChapterStats summarizes a chapter's text without retaining it. Checksum
+// equals ChecksumHex of the chapter's ParseTitleChapters text when counted
+// with DefaultTextProfile. Subtitle is the subtitle containing the chapter, if
+// any, and Position its place among the title's chapters in document order,
+// from 0.
+type ChapterStats struct {
+	Subtitle      string
+	Position      int
+	Words         int
+	Sentences     int
+	Syllables     int
+	Polysyllables int
+	Letters       int
+	Checksum      string
+}
+
+// ScanTitleChapters computes ChapterStats for every chapter in one streaming
+// pass over r, counting the text profile counts.
+func ScanTitleChapters(r io.Reader, profile *TextProfile) (map[string]ChapterStats, error) {
+	chapters, _, err := ScanTitleContent(r, profile, nil)
+	return chapters, err
+}
+
+// ScanTitleContent is ScanTitleChapters that also counts words and the
+// terms of m per part in the same pass, as ScanTitleParts does. Parts are
+// only counted, and otherwise nil, when m is set.
+func ScanTitleContent(r io.Reader, profile *TextProfile, m *RestrictionMatcher) (map[string]ChapterStats, []PartStats, error) {
+	type acc struct {
+		stats ChapterStats
+		sum   hash.Hash
+	}
+	chapters := map[string]*acc{}
+	var parts *partCounter
+	if m != nil {
+		parts = newPartCounter(m)
+	}
+	err := walkTitleText(r, profile, func(subtitle, chapter, part, s string) {
+		ch := ChapterKey(subtitle, chapter)
+		a, ok := chapters[ch]
+		if !ok {
+			a = &acc{stats: ChapterStats{Subtitle: subtitle, Position: len(chapters)}, sum: sha256.New()}
+			chapters[ch] = a
+		}
+		a.stats.Words += WordCount(s)
+		a.stats.Sentences += rawSentenceCount(s)
+		syl, poly, letters := textCounts(s)
+		a.stats.Syllables += syl
+		a.stats.Polysyllables += poly
+		a.stats.Letters += letters
+		_, _ = io.WriteString(a.sum, s)
+		_, _ = a.sum.Write([]byte{' '})
+		if parts != nil {
+			parts.add(ch, part, s)
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out := make(map[string]ChapterStats, len(chapters))
+	for ch, a := range chapters {
+		a.stats.Checksum = hex.EncodeToString(a.sum.Sum(nil))
+		out[ch] = a.stats
 	}
-	agg := get(currentChapter)
+	if parts == nil {
+		return out, nil, nil
+	}
+	return out, parts.result(), nil
+}
+
+// ChapterKey names the text ScanTitleChapters groups together: the chapter,
+// or for text directly under a subtitle SUBTITLE followed by its letter, or
+// UNKNOWN for text outside both.
+func ChapterKey(subtitle, chapter string) string {
+	switch {
+	case chapter != "":
+		return chapter
+	case subtitle != "":
+		return "SUBTITLE " + subtitle
+	}
+	return "UNKNOWN"
+}
 
+// walkTitleText calls fn with each run of text in r that profile counts and
+// the subtitle, chapter and part enclosing it ("" outside any). Chapters are
+// DIV1-DIV3 divisions.
+func walkTitleText(r io.Reader, profile *TextProfile, fn func(subtitle, chapter, part, text string)) error {
+	dec := xml.NewDecoder(r)
+	dec.Strict = false
+
+	var subtitle, chapter, part string
+	depth, subtitleDepth, chapterDepth, partDepth, skipDepth := 0, 0, 0, 0, 0
 	for {
 		tok, err := dec.Token()
 		if err == io.EOF {
-			break
+			return nil
 		}
 		if err != nil {
-			return nil, err
+			return err
 		}
 		switch t := tok.(type) {
 		case xml.StartElement:
-			if strings.EqualFold(t.Name.Local, "DIV1") || strings.EqualFold(t.Name.Local, "DIV2") || strings.EqualFold(t.Name.Local, "DIV3") {
-				typ := attr(t.Attr, "TYPE")
-				if strings.EqualFold(typ, "CHAPTER") {
-					n := attr(t.Attr, "N")
-					if n != "" {
-						currentChapter = n
-						agg = get(currentChapter)
-					}
+			depth++
+			name := strings.ToUpper(t.Name.Local)
+			if skipDepth == 0 && profile.Excludes(name) {
+				skipDepth = depth
+			}
+			if !strings.HasPrefix(name, "DIV") {
+				continue
+			}
+			n := attr(t.Attr, "N")
+			switch strings.ToUpper(attr(t.Attr, "TYPE")) {
+			case "SUBTITLE":
+				if n != "" {
+					subtitle, subtitleDepth = n, depth
+					chapter, chapterDepth, part, partDepth = "", 0, "", 0
 				}
+			case "CHAPTER":
+				if n != "" && (name == "DIV1" || name == "DIV2" || name == "DIV3") {
+					chapter, chapterDepth = n, depth
+					part, partDepth = "", 0
+				}
+			case "PART":
+				part, partDepth = n, depth
+			}
+		case xml.EndElement:
+			// An excluded division also ends its part, chapter or subtitle.
+			if depth == skipDepth {
+				skipDepth = 0
+			}
+			switch depth {
+			case partDepth:
+				part, partDepth = "", 0
+			case chapterDepth:
+				chapter, chapterDepth = "", 0
+			case subtitleDepth:
+				subtitle, subtitleDepth = "", 0
 			}
+			depth--
 		case xml.CharData:
-			s := normalizeText(string([]byte(t)))
-			if s != "" {
-				agg.Text.WriteString(s)
-				agg.Text.WriteByte(' ')
+			if skipDepth > 0 {
+				continue
+			}
+			s := normalizeText(string(t))
+			if s != "" && !profile.skipsText(s) {
+				fn(subtitle, chapter, part, s)
 			}
 		}
 	}
-
-	out := make(map[string]string, len(chapters))
-	for ch, a := range chapters {
-		out[ch] = wsRe.ReplaceAllString(a.Text.String(), " ")
-	}
-	return out, nil
 }
 
 func WordCount(s string) int {
@@ -93,40 +221,35 @@ func ChecksumHex(s string) string {
 }
 
 func FleschReadingEase(text string) float64 {
-	words := float64(max(1, WordCount(text)))
-	sentences := float64(max(1, countSentences(text)))
-	syllables := float64(max(1, countSyllables(text)))
-	return 206.835 - 1.015*(words/sentences) - 84.6*(syllables/words)
+	return FleschReadingEaseCounts(WordCount(text), countSentences(text), countSyllables(text))
+}
+
+func FleschReadingEaseCounts(words, sentences, syllables int) float64 {
+	w := float64(max(1, words))
+	sn := float64(max(1, sentences))
+	sy := float64(max(1, syllables))
+	return 206.835 - 1.015*(w/sn) - 84.6*(sy/w)
 }
 
 func countSentences(s string) int {
+	return max(1, rawSentenceCount(s))
+}
+
+// rawSentenceCount counts the sentence ends in s; unterminated text after the
+// last one is not counted, so text split across elements counts once.
+func rawSentenceCount(s string) int {
 	n := 0
-	sc := bufio.NewScanner(strings.NewReader(s))
-	sc.Split(bufio.ScanRunes)
-	for sc.Scan() {
-		switch sc.Text() {
-		case ".", "!", "?":
-			n++
-		}
-	}
-	return max(1, n)
+	sentenceEnds(s, func(int) { n++ })
+	return n
 }
 
 func countSyllables(s string) int {
-	s = strings.ToLower(s)
-	vowels := "aeiouy"
-	inVowel := false
-	n := 0
-	for _, r := range s {
-		isV := strings.ContainsRune(vowels, r)
-		if isV && !inVowel {
-			n++
-			inVowel = true
-		} else if !isV {
-			inVowel = false
-		}
-	}
-	return max(1, n)
+	return max(1, rawSyllableCount(s))
+}
+
+func rawSyllableCount(s string) int {
+	n, _, _ := textCounts(s)
+	return n
 }
 
 func normalizeText(s string) string {
@@ -1,12 +1,19 @@
 package ecfr
 
-import "testing"
+import (
+	"bytes"
+	"testing"
+)
 
 func TestParseTitleChapters(t *testing.T) {
 	xml := []byte(`
 <ROOT>
   <DIV1 TYPE="CHAPTER" N="I"><P>Alpha beta.</P></DIV1>
-  <DIV1 TYPE="CHAPTER" N="II"><P>Gamma delta.</P></DIV1>
+  <DIV1 TYPE="CHAPTER" N="II"><DIV5 TYPE="PART" N="5">
+    <AUTH><HED>Authority:</HED><PSPACE>5 U.S.C. 301.</PSPACE></AUTH>
+    <SOURCE><HED>Source:</HED><PSPACE>52 FR 31602, Aug. 21, 1987.</PSPACE></SOURCE>
+    <P>Gamma delta.</P>
+  </DIV5></DIV1>
 </ROOT>`)
 	chapters, err := ParseTitleChapters(xml)
 	if err != nil {
@@ -15,6 +22,68 @@ func TestParseTitleChapters(t *testing.T) {
 	if chapters["I"] == "" || chapters["II"] == "" {
 		t.Fatalf("expected chapter content, got: %#v", chapters)
 	}
+	if got := chapters["II"]; got != "Gamma delta. " {
+		t.Fatalf("expected authority and source notes to be skipped, got %q", got)
+	}
+}
+
+func TestScanTitleChaptersMatchesParse(t *testing.T) {
+	xml := []byte(`
+<ROOT>
+  <DIV1 TYPE="CHAPTER" N="I"><P>Alpha beta.</P><P>Audit   the records!</P></DIV1>
+  <DIV1 TYPE="CHAPTER" N="II"><P>Gamma delta.</P></DIV1>
+</ROOT>`)
+	text, err := ParseTitleChapters(xml)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	stats, err := ScanTitleChapters(bytes.NewReader(xml), DefaultTextProfile)
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if len(stats) != len(text) {
+		t.Fatalf("chapter sets differ: %#v vs %#v", stats, text)
+	}
+	for ch, txt := range text {
+		s := stats[ch]
+		if s.Checksum != ChecksumHex(txt) {
+			t.Fatalf("chapter %s checksum mismatch", ch)
+		}
+		if s.Words != WordCount(txt) || s.Sentences != countSentences(txt) || s.Syllables != countSyllables(txt) {
+			t.Fatalf("chapter %s counts mismatch: %#v", ch, s)
+		}
+	}
+	if FleschReadingEaseCounts(stats["I"].Words, stats["I"].Sentences, stats["I"].Syllables) != FleschReadingEase(text["I"]) {
+		t.Fatalf("readability from counts differs from text")
+	}
+}
+
+func TestScanTitleChaptersSubtitles(t *testing.T) {
+	xml := []byte(`
+<ROOT>
+  <DIV2 TYPE="SUBTITLE" N="A">
+    <HEAD>Subtitle A</HEAD>
+    <DIV5 TYPE="PART" N="1"><P>Loose part text.</P></DIV5>
+  </DIV2>
+  <DIV2 TYPE="SUBTITLE" N="B">
+    <DIV3 TYPE="CHAPTER" N="I"><P>Alpha beta.</P></DIV3>
+  </DIV2>
+  <DIV1 TYPE="CHAPTER" N="II"><P>Gamma delta.</P></DIV1>
+</ROOT>`)
+	stats, err := ScanTitleChapters(bytes.NewReader(xml), DefaultTextProfile)
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	want := map[string]string{"SUBTITLE A": "A", "I": "B", "II": ""}
+	if len(stats) != len(want) {
+		t.Fatalf("unexpected chapters: %#v", stats)
+	}
+	for k, sub := range want {
+		s, ok := stats[k]
+		if !ok || s.Subtitle != sub {
+			t.Fatalf("chapter %q: expected subtitle %q, got %#v", k, sub, s)
+		}
+	}
 }
 
 func TestWordCount(t *testing.T) {
@@ -0,0 +1,110 @@
+package ecfr
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// TextProfile decides which text of a title counts towards the text metrics:
+// the text of excluded elements, and of everything inside them, is skipped,
+// and so are "[Reserved]" placeholders if they are excluded. Profiles are
+// immutable.
+type TextProfile struct {
+	exclude  map[string]bool
+	reserved bool
+}
+
+// textGroups are the named element groups a profile rule may use.
+var textGroups = map[string][]string{
+	"headings":   {"HEAD", "HD1", "HD2", "HD3", "HD4", "HD5", "HD6", "HED", "HED1"},
+	"ednotes":    {"EDNOTE", "EFFDNOT"},
+	"toc":        {"CFRTOC", "PTHD", "CHAPTI", "SECHD"},
+	"footnotes":  {"FTNT", "EFTNT", "FTREF"},
+	"citations":  {"CITA", "SECAUTH", "PARAUTH", "APPRO"},
+	"provenance": {"AUTH", "SOURCE"},
+}
+
+// reservedRule is the rule name for "[Reserved]" placeholders, which are text
+// rather than elements.
+const reservedRule = "reserved"
+
+// DefaultTextProfile counts everything but authority and source notes.
+var DefaultTextProfile = &TextProfile{exclude: map[string]bool{"AUTH": true, "SOURCE": true}}
+
+var (
+	elementNameRe = regexp.MustCompile(`^[A-Z][A-Z0-9]*$`)
+	// placeholderRe matches a run of text that only marks its division or
+	// paragraph as reserved: "§ 60.3 [Reserved]", "(b) [Reserved]".
+	placeholderRe = regexp.MustCompile(`(?i)^[^\[\]]{0,60}\[reserved\]\.?$`)
+)
+
+// ParseTextProfile applies a comma-separated list of rules, in order, to
+// DefaultTextProfile. "-x" excludes and "+x" includes x, which is a group
+// (headings, ednotes, toc, footnotes, citations, provenance), reserved for
+// "[Reserved]" placeholders, or an element name ("EXTRACT"); "all" includes
+// everything. An empty spec is DefaultTextProfile.
+func ParseTextProfile(spec string) (*TextProfile, error) {
+	p := &TextProfile{exclude: map[string]bool{}, reserved: DefaultTextProfile.reserved}
+	for el := range DefaultTextProfile.exclude {
+		p.exclude[el] = true
+	}
+	for _, rule := range strings.Split(spec, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		if strings.EqualFold(rule, "all") {
+			p.exclude, p.reserved = map[string]bool{}, false
+			continue
+		}
+		if rule[0] != '-' && rule[0] != '+' {
+			return nil, fmt.Errorf("invalid text profile rule %q (want -name or +name)", rule)
+		}
+		exclude, name := rule[0] == '-', strings.TrimSpace(rule[1:])
+		if strings.EqualFold(name, reservedRule) {
+			p.reserved = exclude
+			continue
+		}
+		elements := textGroups[strings.ToLower(name)]
+		if elements == nil {
+			if !elementNameRe.MatchString(strings.ToUpper(name)) {
+				return nil, fmt.Errorf("invalid text profile rule %q: unknown group or element %q", rule, name)
+			}
+			elements = []string{strings.ToUpper(name)}
+		}
+		for _, el := range elements {
+			if exclude {
+				p.exclude[el] = true
+			} else {
+				delete(p.exclude, el)
+			}
+		}
+	}
+	return p, nil
+}
+
+// String renders p as the rules that rebuild it from "all", excluded elements
+// sorted, so equal profiles render the same: "all,-AUTH,-SOURCE".
+func (p *TextProfile) String() string {
+	rules := make([]string, 0, len(p.exclude)+2)
+	for el := range p.exclude {
+		rules = append(rules, "-"+el)
+	}
+	sort.Strings(rules)
+	if p.reserved {
+		rules = append(rules, "-"+reservedRule)
+	}
+	return strings.Join(append([]string{"all"}, rules...), ",")
+}
+
+// Excludes reports whether p skips the text of element name.
+func (p *TextProfile) Excludes(name string) bool {
+	return p.exclude[strings.ToUpper(name)]
+}
+
+// skipsText reports whether p skips a normalized run of text on its own.
+func (p *TextProfile) skipsText(s string) bool {
+	return p.reserved && placeholderRe.MatchString(s)
+}
@@ -0,0 +1,93 @@
+package ecfr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTextProfile(t *testing.T) {
+	cases := []struct {
+		spec, want string
+	}{
+		{"", "all,-AUTH,-SOURCE"},
+		{"+provenance", "all"},
+		{"-ednotes, -reserved", "all,-AUTH,-EDNOTE,-EFFDNOT,-SOURCE,-reserved"},
+		{"all,-extract,-CITA", "all,-CITA,-EXTRACT"},
+		{"-headings,+HED", "all,-AUTH,-HD1,-HD2,-HD3,-HD4,-HD5,-HD6,-HEAD,-HED1,-SOURCE"},
+	}
+	for _, c := range cases {
+		p, err := ParseTextProfile(c.spec)
+		if err != nil {
+			t.Fatalf("ParseTextProfile(%q): %v", c.spec, err)
+		}
+		if got := p.String(); got != c.want {
+			t.Errorf("ParseTextProfile(%q) = %q, want %q", c.spec, got, c.want)
+		}
+		again, err := ParseTextProfile(p.String())
+		if err != nil || again.String() != p.String() {
+			t.Errorf("%q does not round-trip: %v %v", p.String(), again, err)
+		}
+	}
+	if DefaultTextProfile.String() != "all,-AUTH,-SOURCE" {
+		t.Fatalf("unexpected default profile %q", DefaultTextProfile)
+	}
+	for _, spec := range []string{"ednotes", "-nope!", "+"} {
+		if _, err := ParseTextProfile(spec); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
+
+func TestScanTitleChaptersProfile(t *testing.T) {
+	xml := `
+<ROOT><DIV3 TYPE="CHAPTER" N="I"><DIV5 TYPE="PART" N="1">
+  <HEAD>PART 1—GENERAL</HEAD>
+  <EDNOTE><HED>Editorial Note:</HED><PSPACE>Nomenclature changes appear at 78 FR 34247.</PSPACE></EDNOTE>
+  <DIV8 TYPE="SECTION" N="1.1"><HEAD>§ 1.1 Scope.</HEAD><P>Owners must file reports.</P><P>(b) [Reserved]</P>
+    <CITA>[52 FR 31602, Aug. 21, 1987]</CITA></DIV8>
+  <DIV8 TYPE="SECTION" N="1.2"><HEAD>§ 1.2 [Reserved]</HEAD></DIV8>
+</DIV5></DIV3></ROOT>`
+	words := func(spec string) int {
+		p, err := ParseTextProfile(spec)
+		if err != nil {
+			t.Fatalf("profile %q: %v", spec, err)
+		}
+		stats, err := ScanTitleChapters(strings.NewReader(xml), p)
+		if err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		return stats["I"].Words
+	}
+	full := words("")
+	for spec, removed := range map[string]int{
+		"-headings":  WordCount("PART 1—GENERAL Editorial Note: § 1.1 Scope. § 1.2 [Reserved]"),
+		"-ednotes":   WordCount("Editorial Note: Nomenclature changes appear at 78 FR 34247."),
+		"-citations": WordCount("[52 FR 31602, Aug. 21, 1987]"),
+		"-reserved":  WordCount("(b) [Reserved] § 1.2 [Reserved]"),
+	} {
+		if got := words(spec); got != full-removed {
+			t.Errorf("%s: got %d words, want %d", spec, got, full-removed)
+		}
+	}
+}
+
+func TestScanTitleContentExcludedPart(t *testing.T) {
+	xml := `
+<ROOT><DIV3 TYPE="CHAPTER" N="I">
+  <DIV5 TYPE="PART" N="1"><P>Owners shall file.</P></DIV5>
+  <P>Chapter text must follow.</P>
+</DIV3></ROOT>`
+	p, err := ParseTextProfile("-DIV5")
+	if err != nil {
+		t.Fatalf("profile: %v", err)
+	}
+	_, parts, err := ScanTitleContent(strings.NewReader(xml), p, NewRestrictionMatcher(DefaultRestrictionTerms))
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	want := []PartStats{{Chapter: "I", Part: "", Words: 4, Restrictions: 1}}
+	if !reflect.DeepEqual(parts, want) {
+		t.Fatalf("text after an excluded part should be outside any part: got %#v, want %#v", parts, want)
+	}
+}
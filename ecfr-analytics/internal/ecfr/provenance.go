@@ -0,0 +1,69 @@
+package ecfr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// FRCitation is a Federal Register citation such as "52 FR 31602, Aug. 21,
+// 1987". Page is the first page cited; Date is YYYY-MM-DD, or empty if the
+// citation gives none.
+type FRCitation struct {
+	Volume int    `json:"volume"`
+	Page   int    `json:"page"`
+	Date   string `json:"date,omitempty"`
+}
+
+func (c FRCitation) String() string {
+	return fmt.Sprintf("%d FR %d", c.Volume, c.Page)
+}
+
+var (
+	// frRe matches "52 FR 31602", further pages and an optional date, as in
+	// "51 FR 22888, 22896, June 23, 1986".
+	frRe = regexp.MustCompile(`\b(\d{1,3})\s+FR\s+(\d{1,6})(?:,\s*\d{1,6}\b)*(?:,?\s+((?:Jan|Feb|Mar|Apr|May|June?|July?|Aug|Sept?|Oct|Nov|Dec)[a-z]*\.?)\s+(\d{1,2}),\s*(\d{4}))?`)
+	// publicLawRe matches "Pub. L. 104-134" and "Pub. L. No. 104-134".
+	publicLawRe = regexp.MustCompile(`\bPub\.\s*L\.\s*(?:No\.\s*)?(\d{1,3}-\d{1,4})\b`)
+)
+
+// ParseFRCitations returns the Federal Register citations in text, such as a
+// SOURCE note or a section's amendment citation, in order of appearance.
+func ParseFRCitations(text string) []FRCitation {
+	var out []FRCitation
+	for _, m := range frRe.FindAllStringSubmatch(text, -1) {
+		c := FRCitation{}
+		c.Volume, _ = strconv.Atoi(m[1])
+		c.Page, _ = strconv.Atoi(m[2])
+		if m[3] != "" {
+			if d, err := time.Parse("Jan 2 2006", m[3][:3]+" "+m[4]+" "+m[5]); err == nil {
+				c.Date = d.Format("2006-01-02")
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// ParseAuthority returns the statutes an AUTH note cites: its U.S. Code
+// citations, each once, and its public laws ("104-134"), each once, in order
+// of appearance. title is the title the note belongs to, used as for
+// ExtractCitations.
+func ParseAuthority(text string, title int) (statutes []Citation, publicLaws []string) {
+	seen := map[Citation]bool{}
+	for _, c := range ExtractCitations(text, title) {
+		if c.Kind == CitationUSC && !seen[c] {
+			seen[c] = true
+			statutes = append(statutes, c)
+		}
+	}
+	laws := map[string]bool{}
+	for _, m := range publicLawRe.FindAllStringSubmatch(text, -1) {
+		if !laws[m[1]] {
+			laws[m[1]] = true
+			publicLaws = append(publicLaws, m[1])
+		}
+	}
+	return statutes, publicLaws
+}
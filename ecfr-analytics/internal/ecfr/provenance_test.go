@@ -0,0 +1,44 @@
+package ecfr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFRCitations(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []FRCitation
+	}{
+		{"52 FR 31602, Aug. 21, 1987, unless otherwise noted.", []FRCitation{{52, 31602, "1987-08-21"}}},
+		{"Docket No. 27783, 61 FR 54004, Oct. 16, 1996, unless otherwise noted.", []FRCitation{{61, 54004, "1996-10-16"}}},
+		{"51 FR 22888, 22896, June 23, 1986, unless otherwise noted.", []FRCitation{{51, 22888, "1986-06-23"}}},
+		{"44 FR 41794, July 18, 1979, unless otherwise noted. Redesignated at 50 FR 50301, Dec. 10, 1985.",
+			[]FRCitation{{44, 41794, "1979-07-18"}, {50, 50301, "1985-12-10"}}},
+		{"87 FR 54328, Sept. 6, 2022 unless otherwise noted.", []FRCitation{{87, 54328, "2022-09-06"}}},
+		{"See 79 FR 75739.", []FRCitation{{79, 75739, ""}}},
+		{"No citation here.", nil},
+	}
+	for _, c := range cases {
+		if got := ParseFRCitations(c.in); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseFRCitations(%q) = %+v, want %+v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestParseAuthority(t *testing.T) {
+	text := "Atomic Energy Act of 1954, secs. 161, 191 (42 U.S.C. 2201, 2241); Administrative Procedure Act (5 U.S.C. 552, 553); " +
+		"42 U.S.C. 2201 note. Section 2.205(j) also issued under Sec. 31001(s), Pub. L. 104-134, 110 Stat. 1321-373 (28 U.S.C. 2461 note); Pub. L. No. 104-134."
+	statutes, laws := ParseAuthority(text, 10)
+	var got []string
+	for _, c := range statutes {
+		got = append(got, c.String())
+	}
+	want := []string{"42 U.S.C. 2201", "42 U.S.C. 2241", "5 U.S.C. 552", "5 U.S.C. 553", "28 U.S.C. 2461"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("statutes: got %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(laws, []string{"104-134"}) {
+		t.Fatalf("public laws: got %v", laws)
+	}
+}
@@ -0,0 +1,203 @@
+package ecfr
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// TextStatsVersion identifies how ChapterStats are counted. Bump it whenever
+// word, sentence, syllable or letter counting, the text counted, or what
+// ChapterStats records changes so that stored stats are recomputed.
+const TextStatsVersion = 7
+
+// syllableExceptions holds common words the suffix rules in Syllables get
+// wrong.
+var syllableExceptions = map[string]int{
+	"ambiguous":     4,
+	"area":          3,
+	"biennial":      4,
+	"being":         2,
+	"business":      2,
+	"businesses":    3,
+	"create":        2,
+	"created":       3,
+	"creates":       2,
+	"every":         2,
+	"idea":          3,
+	"ideas":         3,
+	"nuclear":       3,
+	"poem":          2,
+	"quiet":         2,
+	"science":       2,
+	"society":       4,
+	"video":         3,
+	"cooperate":     4,
+	"cooperative":   5,
+	"coordinate":    4,
+	"coordinated":   5,
+	"preexisting":   4,
+	"reenter":       3,
+	"reentry":       3,
+	"reevaluate":    5,
+	"reimburse":     3,
+	"reimbursed":    3,
+	"reimbursement": 4,
+	"reinstate":     3,
+	"reissue":       3,
+}
+
+// Syllables estimates the syllables in one word: vowel groups, less a silent
+// final e and silent -ed/-es endings, plus vowel pairs that are usually split
+// (ia, io, iu, ua, uo), with an exception dictionary on top. Every word has at
+// least one syllable, including numbers.
+func Syllables(word string) int {
+	w := strings.ToLower(word)
+	if n, ok := syllableExceptions[w]; ok {
+		return n
+	}
+	letters := []rune{}
+	for _, r := range w {
+		if r >= 'a' && r <= 'z' {
+			letters = append(letters, r)
+		}
+	}
+	if len(letters) <= 3 {
+		return 1
+	}
+
+	n := len(letters)
+	consonantL := func(i int) bool { // letters[i] is l after a consonant
+		return i > 0 && letters[i] == 'l' && !isVowel(letters, i-1)
+	}
+	switch {
+	case strings.HasSuffix(w, "ed") && n >= 4:
+		prev := letters[n-3]
+		if prev != 't' && prev != 'd' && !consonantL(n-3) {
+			letters = letters[:n-2]
+		}
+	case strings.HasSuffix(w, "es") && n >= 4:
+		tail := string(letters[:n-2])
+		sibilant := strings.HasSuffix(tail, "s") || strings.HasSuffix(tail, "x") || strings.HasSuffix(tail, "z") ||
+			strings.HasSuffix(tail, "ch") || strings.HasSuffix(tail, "sh") || strings.HasSuffix(tail, "g") || strings.HasSuffix(tail, "c")
+		if !sibilant && !consonantL(n-3) {
+			letters = letters[:n-2]
+		}
+	case letters[n-1] == 'e' && !isVowel(letters, n-2) && !consonantL(n-2):
+		letters = letters[:n-1]
+	}
+
+	count := 0
+	for i := 0; i < len(letters); i++ {
+		if !isVowel(letters, i) {
+			continue
+		}
+		if i == 0 || !isVowel(letters, i-1) {
+			count++
+			continue
+		}
+		if splitVowelPair(letters, i) {
+			count++
+		}
+	}
+	// A silent e kept inside a derived word (state-ment, safe-ly).
+	for _, suf := range []string{"ments", "ment", "ness", "fully", "ful", "less", "ly"} {
+		stem := len(letters) - len(suf)
+		if stem >= 3 && string(letters[stem:]) == suf && letters[stem-1] == 'e' && !isVowel(letters, stem-2) {
+			count--
+			break
+		}
+	}
+	return max(1, count)
+}
+
+// isVowel treats y as a consonant at the start of a word or before a vowel
+// (be-yond), and u as one after q, or after g before a vowel (guar-an-tee).
+func isVowel(w []rune, i int) bool {
+	beforeVowel := i+1 < len(w) && strings.ContainsRune("aeiou", w[i+1])
+	switch w[i] {
+	case 'a', 'e', 'i', 'o':
+		return true
+	case 'u':
+		return i == 0 || (w[i-1] != 'q' && (w[i-1] != 'g' || !beforeVowel))
+	case 'y':
+		return i > 0 && !beforeVowel
+	}
+	return false
+}
+
+// splitVowelPair reports whether w[i-1:i+1] is a vowel pair that is usually
+// two syllables (ma-te-ri-al, ac-tu-al) rather than one (na-tion, so-cial).
+func splitVowelPair(w []rune, i int) bool {
+	pair := string(w[i-1 : i+1])
+	switch pair {
+	case "ua", "uo":
+		return true
+	case "ia", "io", "iu":
+		if i < 2 {
+			return true
+		}
+		switch w[i-2] {
+		case 't', 's', 'c', 'g', 'x':
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// textCounts tallies the per-word counts readability formulas need.
+func textCounts(s string) (syllables, polysyllables, letters int) {
+	for _, tok := range strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		n := Syllables(tok)
+		syllables += n
+		if n >= 3 {
+			polysyllables++
+		}
+		for range tok {
+			letters++
+		}
+	}
+	return syllables, polysyllables, letters
+}
+
+// FleschKincaidGradeCounts is the Flesch–Kincaid grade level.
+func FleschKincaidGradeCounts(words, sentences, syllables int) float64 {
+	w := float64(max(1, words))
+	sn := float64(max(1, sentences))
+	sy := float64(max(1, syllables))
+	return 0.39*(w/sn) + 11.8*(sy/w) - 15.59
+}
+
+// GunningFogCounts is the Gunning fog index. Complex words are approximated
+// by words of three or more syllables.
+func GunningFogCounts(words, sentences, complexWords int) float64 {
+	w := float64(max(1, words))
+	sn := float64(max(1, sentences))
+	return 0.4 * (w/sn + 100*float64(complexWords)/w)
+}
+
+// SMOGCounts is the SMOG grade, normalized to a 30-sentence sample.
+func SMOGCounts(sentences, polysyllables int) float64 {
+	sn := float64(max(1, sentences))
+	return 1.0430*math.Sqrt(float64(polysyllables)*30/sn) + 3.1291
+}
+
+// ColemanLiauCounts is the Coleman–Liau index; letters counts letters and
+// digits.
+func ColemanLiauCounts(letters, words, sentences int) float64 {
+	w := float64(max(1, words))
+	l := float64(letters) / w * 100
+	s := float64(max(1, sentences)) / w * 100
+	return 0.0588*l - 0.296*s - 15.8
+}
+
+// AutomatedReadabilityIndexCounts is the ARI; characters counts letters and
+// digits.
+func AutomatedReadabilityIndexCounts(characters, words, sentences int) float64 {
+	w := float64(max(1, words))
+	sn := float64(max(1, sentences))
+	return 4.71*(float64(characters)/w) + 0.5*(w/sn) - 21.43
+}
@@ -0,0 +1,57 @@
+package ecfr
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSyllables(t *testing.T) {
+	cases := map[string]int{
+		"a": 1, "the": 1, "CFR": 1, "1234": 1,
+		"table": 2, "tables": 2, "filed": 1, "used": 1, "settled": 2, "required": 2, "submitted": 3,
+		"boxes": 2, "charges": 2, "agencies": 3, "statement": 2, "management": 3, "payable": 3,
+		"period": 3, "nation": 2, "social": 2, "material": 4, "actual": 3, "quality": 3, "continue": 3,
+		"beyond": 2, "language": 2, "requirements": 3, "recordkeeping": 4,
+		"area": 3, "business": 2, "Reimbursement": 4,
+	}
+	for word, want := range cases {
+		if got := Syllables(word); got != want {
+			t.Errorf("Syllables(%q) = %d, want %d", word, got, want)
+		}
+	}
+}
+
+func TestTextCounts(t *testing.T) {
+	syl, poly, letters := textCounts("The agencies filed 12 tables.")
+	if syl != 1+3+1+1+2 || poly != 1 || letters != len("Theagenciesfiled12tables") {
+		t.Fatalf("textCounts = %d, %d, %d", syl, poly, letters)
+	}
+	text := "The agencies filed tables. Each one is required."
+	if got, want := rawSyllableCount(text), 12; got != want {
+		t.Fatalf("rawSyllableCount = %d, want %d", got, want)
+	}
+}
+
+func TestGradeFormulas(t *testing.T) {
+	cases := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"flesch-kincaid", FleschKincaidGradeCounts(100, 5, 150), 9.91},
+		{"gunning fog", GunningFogCounts(100, 5, 10), 12},
+		{"smog", SMOGCounts(30, 4), 5.2151},
+		{"coleman-liau", ColemanLiauCounts(500, 100, 5), 12.12},
+		{"ari", AutomatedReadabilityIndexCounts(500, 100, 5), 12.12},
+	}
+	for _, c := range cases {
+		if math.Abs(c.got-c.want) > 1e-9 {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+	for _, v := range []float64{FleschKincaidGradeCounts(0, 0, 0), GunningFogCounts(0, 0, 0), SMOGCounts(0, 0), ColemanLiauCounts(0, 0, 0), AutomatedReadabilityIndexCounts(0, 0, 0)} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			t.Fatalf("empty text should not produce %v", v)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package ecfr
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// DefaultRestrictionTerms are the words and phrases that impose an obligation
+// or prohibition, following the usual regulatory-restriction counts.
+var DefaultRestrictionTerms = []string{"shall", "must", "may not", "required", "prohibited"}
+
+// RestrictionMatcher counts case-insensitive, whole-word occurrences of a set
+// of terms. Multi-word terms match across any whitespace or punctuation, and
+// overlapping matches are counted once, preferring the longest term.
+type RestrictionMatcher struct {
+	terms  []string
+	byHead map[string][][]string
+	maxLen int
+}
+
+func NewRestrictionMatcher(terms []string) *RestrictionMatcher {
+	m := &RestrictionMatcher{byHead: map[string][][]string{}}
+	seen := map[string]bool{}
+	for _, t := range terms {
+		words := tokenize(t)
+		if len(words) == 0 {
+			continue
+		}
+		norm := strings.Join(words, " ")
+		if seen[norm] {
+			continue
+		}
+		seen[norm] = true
+		m.terms = append(m.terms, norm)
+		m.byHead[words[0]] = append(m.byHead[words[0]], words)
+		m.maxLen = max(m.maxLen, len(words))
+	}
+	sort.Strings(m.terms)
+	for _, phrases := range m.byHead {
+		sort.SliceStable(phrases, func(i, j int) bool { return len(phrases[i]) > len(phrases[j]) })
+	}
+	return m
+}
+
+// Terms returns the normalized terms, sorted.
+func (m *RestrictionMatcher) Terms() []string {
+	return append([]string(nil), m.terms...)
+}
+
+// Key identifies the term set, so cached counts can be invalidated when it
+// changes.
+func (m *RestrictionMatcher) Key() string {
+	return ChecksumHex(strings.Join(m.terms, "\n"))[:16]
+}
+
+func (m *RestrictionMatcher) Count(text string) int {
+	c := m.counter()
+	c.feed(text)
+	return c.flush()
+}
+
+func (m *RestrictionMatcher) counter() *restrictionCounter {
+	return &restrictionCounter{m: m}
+}
+
+// restrictionCounter matches over a stream of text chunks, holding back enough
+// trailing words that a phrase split across chunks is still found.
+type restrictionCounter struct {
+	m       *RestrictionMatcher
+	pending []string
+	n       int
+}
+
+func (c *restrictionCounter) feed(text string) {
+	c.pending = append(c.pending, tokenize(text)...)
+	c.consume(c.m.maxLen)
+}
+
+func (c *restrictionCounter) flush() int {
+	c.consume(1)
+	c.pending = c.pending[:0]
+	return c.n
+}
+
+// consume matches at every position that still has at least lookahead words
+// after it (including itself).
+func (c *restrictionCounter) consume(lookahead int) {
+	i := 0
+	for len(c.pending)-i >= max(1, lookahead) {
+		step := 1
+		for _, p := range c.m.byHead[c.pending[i]] {
+			if len(p) <= len(c.pending)-i && equalWords(p, c.pending[i:i+len(p)]) {
+				c.n++
+				step = len(p)
+				break
+			}
+		}
+		i += step
+	}
+	c.pending = append(c.pending[:0], c.pending[i:]...)
+}
+
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// PartStats summarizes one part of a title. Text inside a chapter but outside
+// any part is reported with an empty Part.
+type PartStats struct {
+	Chapter      string `json:"chapter"`
+	Part         string `json:"part"`
+	Words        int    `json:"words"`
+	Restrictions int    `json:"restrictions"`
+}
+
+// ScanTitleParts counts words and restriction terms per part in one streaming
+// pass over r. Chapters are attributed and text counted as in
+// ScanTitleChapters, so part counts add up to chapter counts for the same
+// profile.
+func ScanTitleParts(r io.Reader, m *RestrictionMatcher, profile *TextProfile) ([]PartStats, error) {
+	_, parts, err := ScanTitleContent(r, profile, m)
+	return parts, err
+}
+
+// partCounter accumulates PartStats over a title's text.
+type partCounter struct {
+	m     *RestrictionMatcher
+	parts map[[2]string]*partAcc
+}
+
+type partAcc struct {
+	stats   PartStats
+	counter *restrictionCounter
+}
+
+func newPartCounter(m *RestrictionMatcher) *partCounter {
+	return &partCounter{m: m, parts: map[[2]string]*partAcc{}}
+}
+
+func (c *partCounter) add(chapter, part, s string) {
+	k := [2]string{chapter, part}
+	a, ok := c.parts[k]
+	if !ok {
+		a = &partAcc{stats: PartStats{Chapter: chapter, Part: part}, counter: c.m.counter()}
+		c.parts[k] = a
+	}
+	a.stats.Words += WordCount(s)
+	a.counter.feed(s)
+}
+
+// result returns the counts sorted by chapter and part.
+func (c *partCounter) result() []PartStats {
+	out := make([]PartStats, 0, len(c.parts))
+	for _, a := range c.parts {
+		a.stats.Restrictions = a.counter.flush()
+		out = append(out, a.stats)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Chapter != out[j].Chapter {
+			return out[i].Chapter < out[j].Chapter
+		}
+		return out[i].Part < out[j].Part
+	})
+	return out
+}
@@ -0,0 +1,82 @@
+package ecfr
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRestrictionMatcherCount(t *testing.T) {
+	m := NewRestrictionMatcher(DefaultRestrictionTerms)
+	cases := []struct {
+		text string
+		want int
+	}{
+		{"The applicant shall file; it must pay.", 2},
+		{"SHALL, Must, and Required.", 3},
+		{"Marshall mustard is not requirement-free.", 0},
+		{"An agency may not act and may\nnot delay.", 2},
+		{"You may notify us.", 0},
+		{"Dumping is prohibited unless required.", 2},
+	}
+	for _, c := range cases {
+		if got := m.Count(c.text); got != c.want {
+			t.Fatalf("Count(%q) = %d, want %d", c.text, got, c.want)
+		}
+	}
+
+	overlap := NewRestrictionMatcher([]string{"shall", "shall not", " Shall  not "})
+	if got := overlap.Terms(); len(got) != 2 {
+		t.Fatalf("expected duplicate terms to collapse: %v", got)
+	}
+	if got := overlap.Count("It shall not and shall."); got != 2 {
+		t.Fatalf("expected longest match to win, got %d", got)
+	}
+	if overlap.Key() == m.Key() {
+		t.Fatalf("different term sets should have different keys")
+	}
+}
+
+func TestScanTitleParts(t *testing.T) {
+	xml := `<ECFR><DIV1 N="1" TYPE="TITLE">
+<DIV3 N="I" TYPE="CHAPTER"><HEAD>CHAPTER I</HEAD>
+<DIV5 N="1" TYPE="PART"><P>Each person shall comply. A person may</P><P>not appeal.</P></DIV5>
+<DIV5 N="2" TYPE="PART"><P>No rules here.</P></DIV5>
+<P>Chapter note must be read.</P>
+</DIV3>
+<DIV3 N="II" TYPE="CHAPTER"><DIV5 N="200" TYPE="PART"><P>Filing is required.</P></DIV5></DIV3>
+</DIV1></ECFR>`
+	parts, err := ScanTitleParts(strings.NewReader(xml), NewRestrictionMatcher(DefaultRestrictionTerms), DefaultTextProfile)
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	want := []PartStats{
+		{Chapter: "I", Part: "", Words: 7, Restrictions: 1},
+		{Chapter: "I", Part: "1", Words: 9, Restrictions: 2},
+		{Chapter: "I", Part: "2", Words: 3, Restrictions: 0},
+		{Chapter: "II", Part: "200", Words: 3, Restrictions: 1},
+	}
+	if len(parts) != len(want) {
+		t.Fatalf("expected %d parts, got %#v", len(want), parts)
+	}
+	for i := range want {
+		if parts[i] != want[i] {
+			t.Fatalf("part %d: got %#v, want %#v", i, parts[i], want[i])
+		}
+	}
+
+	chapters, err := ScanTitleChapters(strings.NewReader(xml), DefaultTextProfile)
+	if err != nil {
+		t.Fatalf("scan chapters: %v", err)
+	}
+	for ch, cs := range chapters {
+		words := 0
+		for _, p := range parts {
+			if p.Chapter == ch {
+				words += p.Words
+			}
+		}
+		if words != cs.Words {
+			t.Fatalf("chapter %s: parts have %d words, chapter has %d", ch, words, cs.Words)
+		}
+	}
+}
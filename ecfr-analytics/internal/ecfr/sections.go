@@ -0,0 +1,220 @@
+package ecfr
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// Section is one SECTION or APPENDIX division together with the subtitle,
+// chapter and part it sits in. Subpart is only set by ScanTitleStructure.
+// History is a section's CITA note, its Federal Register history, which is
+// also part of Text. Authority and Source are the AUTH and SOURCE notes of a
+// part or subpart from ScanTitleStructure, without their "Authority:" and
+// "Source:" headings.
+type Section struct {
+	Type       string
+	Identifier string
+	Subtitle   string
+	Chapter    string
+	Part       string
+	Subpart    string
+	Heading    string
+	Text       string
+	History    string
+	Authority  string
+	Source     string
+}
+
+// ScanTitleSections streams r and calls fn for every section and appendix in
+// document order, without building the whole title tree.
+func ScanTitleSections(r io.Reader, fn func(Section) error) error {
+	return scanTitle(r, false, fn)
+}
+
+// ScanTitleStructure is ScanTitleSections that also calls fn for every part
+// and subpart, after the divisions within it, with Type "PART" or "SUBPART",
+// its number as Identifier, its heading and notes, and no Text.
+func ScanTitleStructure(r io.Reader, fn func(Section) error) error {
+	return scanTitle(r, true, fn)
+}
+
+func scanTitle(r io.Reader, structure bool, fn func(Section) error) error {
+	dec := xml.NewDecoder(r)
+	dec.Strict = false
+
+	type frame struct {
+		name     string
+		div      bool
+		subtitle string
+		chapter  string
+		part     string
+	}
+	var stack []frame
+	var subtitle, chapter, part string
+
+	// divs holds the open parts and subparts, innermost last.
+	type division struct {
+		sec          Section
+		depth        int
+		head         strings.Builder
+		auth, source strings.Builder
+	}
+	var divs []*division
+	// note is the AUTH or SOURCE note being read, ending at noteDepth.
+	var note *strings.Builder
+	noteDepth := 0
+
+	var cur *Section
+	curDepth := 0
+	headDepth := 0
+	citaDepth := 0
+	var head, body, hist strings.Builder
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := strings.ToUpper(t.Name.Local)
+			f := frame{name: name, subtitle: subtitle, chapter: chapter, part: part}
+			if strings.HasPrefix(name, "DIV") {
+				if typ := strings.ToUpper(attr(t.Attr, "TYPE")); typ != "" {
+					f.div = true
+					n := attr(t.Attr, "N")
+					switch typ {
+					case "SUBTITLE":
+						// Subtitles and chapters are recognized as
+						// walkTitleText does, so sections fall in the
+						// chapters their text is counted under.
+						if n != "" {
+							subtitle, chapter, part = n, "", ""
+						}
+					case "CHAPTER":
+						if n != "" && (name == "DIV1" || name == "DIV2" || name == "DIV3") {
+							chapter, part = n, ""
+						}
+					case "PART", "SUBPART":
+						if typ == "PART" {
+							part = n
+						}
+						if structure && cur == nil {
+							divs = append(divs, &division{
+								sec:   Section{Type: typ, Identifier: n, Subtitle: subtitle, Chapter: chapter, Part: part},
+								depth: len(stack) + 1,
+							})
+						}
+					case "SECTION", "APPENDIX":
+						if cur == nil {
+							cur = &Section{Type: typ, Identifier: n, Subtitle: subtitle, Chapter: chapter, Part: part}
+							for i := len(divs) - 1; i >= 0; i-- {
+								if divs[i].sec.Type == "SUBPART" {
+									cur.Subpart = divs[i].sec.Identifier
+									break
+								}
+							}
+							curDepth = len(stack) + 1
+							head.Reset()
+							body.Reset()
+							hist.Reset()
+						}
+					}
+				}
+			}
+			if (name == "AUTH" || name == "SOURCE") && note == nil && cur == nil && len(divs) > 0 {
+				d := divs[len(divs)-1]
+				note, noteDepth = &d.auth, len(stack)+1
+				if name == "SOURCE" {
+					note = &d.source
+				}
+			}
+			if name == "CITA" && cur != nil && citaDepth == 0 {
+				citaDepth = len(stack) + 1
+			}
+			if name == "HEAD" && headDepth == 0 {
+				if cur != nil && len(stack) == curDepth {
+					headDepth = len(stack) + 1
+				} else if cur == nil && len(divs) > 0 && len(stack) == divs[len(divs)-1].depth {
+					headDepth = len(stack) + 1
+				}
+			}
+			stack = append(stack, f)
+		case xml.EndElement:
+			if len(stack) == 0 {
+				continue
+			}
+			if headDepth == len(stack) {
+				headDepth = 0
+			}
+			if noteDepth == len(stack) {
+				note, noteDepth = nil, 0
+			}
+			if citaDepth == len(stack) {
+				citaDepth = 0
+			}
+			if cur != nil && curDepth == len(stack) {
+				cur.Heading = head.String()
+				cur.Text = body.String()
+				cur.History = hist.String()
+				if err := fn(*cur); err != nil {
+					return err
+				}
+				cur = nil
+			}
+			if n := len(divs); n > 0 && divs[n-1].depth == len(stack) {
+				d := divs[n-1]
+				divs = divs[:n-1]
+				d.sec.Heading = d.head.String()
+				d.sec.Authority = d.auth.String()
+				d.sec.Source = d.source.String()
+				if err := fn(d.sec); err != nil {
+					return err
+				}
+			}
+			f := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if f.div {
+				subtitle, chapter, part = f.subtitle, f.chapter, f.part
+			}
+		case xml.CharData:
+			var b *strings.Builder
+			switch {
+			case cur != nil && headDepth > 0:
+				b = &head
+			case cur != nil:
+				b = &body
+			case len(divs) > 0 && headDepth > 0:
+				b = &divs[len(divs)-1].head
+			case note != nil && stack[len(stack)-1].name != "HED":
+				b = note
+			default:
+				continue
+			}
+			s := normalizeText(string(t))
+			if s == "" {
+				continue
+			}
+			if b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(s)
+			if b == &body && citaDepth > 0 {
+				if hist.Len() > 0 {
+					hist.WriteByte(' ')
+				}
+				hist.WriteString(s)
+			}
+		}
+	}
+}
+
+// IsReserved reports whether a heading marks its division as reserved, as
+// in "§ 60.3 [Reserved]" or "PART 61 [RESERVED]".
+func IsReserved(heading string) bool {
+	return strings.Contains(strings.ToLower(heading), "[reserved]")
+}
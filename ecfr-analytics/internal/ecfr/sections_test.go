@@ -0,0 +1,110 @@
+package ecfr
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScanTitleSections(t *testing.T) {
+	xml := `
+<ECFR>
+<DIV1 N="40" TYPE="TITLE">
+<DIV2 N="A" TYPE="SUBTITLE">
+<DIV3 N="I" TYPE="CHAPTER">
+<DIV5 N="1" TYPE="PART">
+<HEAD>PART 1—GENERAL</HEAD>
+<DIV8 N="1.1" TYPE="SECTION">
+<HEAD>§ 1.1   Recordkeeping.</HEAD>
+<P>Keep records.</P>
+<EXTRACT><HEAD>Not a heading</HEAD></EXTRACT>
+</DIV8>
+</DIV5>
+<DIV9 N="Appendix A to Part 1" TYPE="APPENDIX">
+<HEAD>Appendix A to Part 1—Forms</HEAD>
+<P>Form text.</P>
+</DIV9>
+</DIV3>
+</DIV2>
+<DIV3 N="II" TYPE="CHAPTER">
+<DIV5 N="200" TYPE="PART">
+<DIV8 N="200.1" TYPE="SECTION"><P>Scope.</P></DIV8>
+</DIV5>
+</DIV3>
+</DIV1>
+</ECFR>`
+	var got []Section
+	err := ScanTitleSections(strings.NewReader(xml), func(s Section) error {
+		got = append(got, s)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	want := []Section{
+		{Type: "SECTION", Identifier: "1.1", Subtitle: "A", Chapter: "I", Part: "1", Heading: "§ 1.1 Recordkeeping.", Text: "Keep records. Not a heading"},
+		{Type: "APPENDIX", Identifier: "Appendix A to Part 1", Subtitle: "A", Chapter: "I", Heading: "Appendix A to Part 1—Forms", Text: "Form text."},
+		{Type: "SECTION", Identifier: "200.1", Chapter: "II", Part: "200", Text: "Scope."},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d sections, got %d: %#v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("section %d: got %#v, want %#v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestScanTitleStructure(t *testing.T) {
+	xml := `
+<ECFR>
+<DIV1 N="40" TYPE="TITLE">
+<DIV3 N="I" TYPE="CHAPTER">
+<DIV5 N="60" TYPE="PART">
+<HEAD>PART 60—STANDARDS</HEAD>
+<AUTH><HED>Authority:</HED><PSPACE>42 U.S.C. 7401
+ et seq.</PSPACE></AUTH>
+<SOURCE><HED>Source:</HED><PSPACE>36 FR 24877, Dec. 23, 1971, unless otherwise noted.</PSPACE></SOURCE>
+<DIV6 N="A" TYPE="SUBPART">
+<HEAD>Subpart A—General</HEAD>
+<SOURCE><HED>Source:</HED><PSPACE>40 FR 53346, Nov. 17, 1975.</PSPACE></SOURCE>
+<DIV8 N="60.1" TYPE="SECTION"><HEAD>§ 60.1 Applicability.</HEAD><P>Text.</P>
+<CITA TYPE="N">[40 FR 53346, Nov. 17, 1975, as amended at 65 FR 61744,
+ Oct. 17, 2000]</CITA></DIV8>
+</DIV6>
+<DIV8 N="60.3" TYPE="SECTION"><HEAD>§ 60.3 [Reserved]</HEAD></DIV8>
+</DIV5>
+<DIV5 N="61" TYPE="PART"><HEAD>PART 61 [RESERVED]</HEAD></DIV5>
+</DIV3>
+</DIV1>
+</ECFR>`
+	var got []Section
+	err := ScanTitleStructure(strings.NewReader(xml), func(s Section) error {
+		got = append(got, s)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	want := []Section{
+		{Type: "SECTION", Identifier: "60.1", Chapter: "I", Part: "60", Subpart: "A", Heading: "§ 60.1 Applicability.",
+			Text:    "Text. [40 FR 53346, Nov. 17, 1975, as amended at 65 FR 61744, Oct. 17, 2000]",
+			History: "[40 FR 53346, Nov. 17, 1975, as amended at 65 FR 61744, Oct. 17, 2000]"},
+		{Type: "SUBPART", Identifier: "A", Chapter: "I", Part: "60", Heading: "Subpart A—General", Source: "40 FR 53346, Nov. 17, 1975."},
+		{Type: "SECTION", Identifier: "60.3", Chapter: "I", Part: "60", Heading: "§ 60.3 [Reserved]"},
+		{Type: "PART", Identifier: "60", Chapter: "I", Part: "60", Heading: "PART 60—STANDARDS",
+			Authority: "42 U.S.C. 7401 et seq.", Source: "36 FR 24877, Dec. 23, 1971, unless otherwise noted."},
+		{Type: "PART", Identifier: "61", Chapter: "I", Part: "61", Heading: "PART 61 [RESERVED]"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d divisions, got %d: %#v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("division %d: got %#v, want %#v", i, got[i], want[i])
+		}
+	}
+	if IsReserved(got[0].Heading) || !IsReserved(got[2].Heading) || !IsReserved(got[4].Heading) {
+		t.Fatalf("unexpected IsReserved results")
+	}
+}
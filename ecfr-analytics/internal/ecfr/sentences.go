@@ -0,0 +1,140 @@
+package ecfr
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// abbreviations never end a sentence: the next word continues it
+// ("e.g., Form", "Pub. L.", "Docket No. FAA", "U.S. Department").
+var abbreviations = map[string]bool{
+	"e.g": true, "i.e": true, "u.s": true, "cf": true, "viz": true, "v": true, "vs": true,
+	"mr": true, "mrs": true, "ms": true, "dr": true,
+	"no": true, "nos": true, "sec": true, "secs": true, "pt": true, "pts": true, "subpt": true,
+	"ch": true, "chap": true, "par": true, "para": true, "pars": true, "app": true,
+	"fig": true, "figs": true, "vol": true, "art": true, "pub": true, "fed": true, "reg": true,
+}
+
+// citationAbbreviations end a sentence unless a number follows, as in
+// "42 U.S.C. 7401", "80 Stat. 378" and "Mar. 27, 1975".
+var citationAbbreviations = map[string]bool{
+	"stat": true, "seq": true, "etc": true, "inc": true, "co": true, "corp": true, "ltd": true,
+	"jan": true, "feb": true, "mar": true, "apr": true, "aug": true, "sep": true, "sept": true,
+	"oct": true, "nov": true, "dec": true,
+}
+
+// SplitSentences splits text into sentences. A period ends a sentence only
+// when it is not part of a number or citation ("40 CFR 60.5", "U.S.C."), a
+// known abbreviation ("e.g.", "No."), or a paragraph enumerator opening the
+// sentence ("1.", "A.", "II."), and the next word does not start in lower
+// case. Text after the last sentence end is returned as a final sentence.
+func SplitSentences(text string) []string {
+	var out []string
+	start := 0
+	sentenceEnds(text, func(end int) {
+		if s := strings.TrimSpace(text[start:end]); s != "" {
+			out = append(out, s)
+		}
+		start = end
+	})
+	if s := strings.TrimSpace(text[start:]); s != "" {
+		out = append(out, s)
+	}
+	return out
+}
+
+// sentenceEnds calls fn with the offset just past each sentence end in s,
+// including any closing quotes or brackets.
+func sentenceEnds(s string, fn func(end int)) {
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '.' && c != '!' && c != '?' {
+			continue
+		}
+		j := i + 1
+		for j < len(s) && (s[j] == '.' || s[j] == '!' || s[j] == '?') {
+			j++
+		}
+		end := j
+		for end < len(s) {
+			r, size := utf8.DecodeRuneInString(s[end:])
+			if !strings.ContainsRune(`)]"'”’`, r) {
+				break
+			}
+			end += size
+		}
+		if isSentenceEnd(s, start, i, j, end) {
+			fn(end)
+			start = end
+		}
+		i = end - 1
+	}
+}
+
+// isSentenceEnd decides whether the terminators s[i:j], followed by closers up
+// to end, end the sentence that began at start.
+func isSentenceEnd(s string, start, i, j, end int) bool {
+	next, _ := utf8.DecodeRuneInString(s[end:])
+	if end == j && end < len(s) && (unicode.IsLetter(next) || unicode.IsDigit(next)) {
+		return false // 60.5, U.S.C, e.g
+	}
+	rest := strings.TrimLeftFunc(s[end:], unicode.IsSpace)
+	next, _ = utf8.DecodeRuneInString(rest)
+	if rest != "" && (unicode.IsLower(next) || strings.ContainsRune(",;:", next)) {
+		return false
+	}
+	if s[i] != '.' {
+		return true
+	}
+
+	k := i
+	for k > start && (isWordByte(s[k-1]) || s[k-1] == '.') {
+		k--
+	}
+	word := strings.ToLower(s[k:i])
+	switch {
+	case word == "":
+		return true
+	case strings.TrimSpace(s[start:k]) == "" && isEnumerator(word):
+		return false
+	case abbreviations[word]:
+		return false
+	case citationAbbreviations[word] || len(word) == 1 || isInitialism(word):
+		return rest == "" || !unicode.IsDigit(next)
+	}
+	return true
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// isEnumerator reports whether w is a paragraph marker such as "1", "1.2",
+// "a" or "xiv".
+func isEnumerator(w string) bool {
+	if len(w) == 1 {
+		return true
+	}
+	if strings.Trim(w, "0123456789.") == "" {
+		return len(w) <= 6
+	}
+	w = strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(w, "x"), "x"), "x")
+	switch w {
+	case "", "i", "ii", "iii", "iv", "v", "vi", "vii", "viii", "ix":
+		return true
+	}
+	return false
+}
+
+// isInitialism reports whether w is dotted single letters such as "u.s" or
+// "d.c".
+func isInitialism(w string) bool {
+	for _, part := range strings.Split(w, ".") {
+		if len(part) != 1 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package ecfr
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitSentencesCorpus(t *testing.T) {
+	data, err := os.ReadFile("testdata/sentences.txt")
+	if err != nil {
+		t.Fatalf("read corpus: %v", err)
+	}
+	var paragraphs [][]string
+	var cur []string
+	for _, line := range strings.Split(string(data)+"\n", "\n") {
+		switch {
+		case strings.HasPrefix(line, "#"):
+		case strings.TrimSpace(line) == "":
+			if len(cur) > 0 {
+				paragraphs = append(paragraphs, cur)
+				cur = nil
+			}
+		default:
+			cur = append(cur, line)
+		}
+	}
+	if len(paragraphs) < 20 {
+		t.Fatalf("corpus too small: %d paragraphs", len(paragraphs))
+	}
+	for _, want := range paragraphs {
+		text := strings.Join(want, " ")
+		if got := SplitSentences(text); !reflect.DeepEqual(got, want) {
+			t.Errorf("SplitSentences(%q)\n got: %q\nwant: %q", text, got, want)
+		}
+	}
+}
+
+func TestSentenceCount(t *testing.T) {
+	cases := []struct {
+		text string
+		want int
+	}{
+		{"See 40 CFR 60.5 and 42 U.S.C. 7401 et seq. for details.", 1},
+		{"It is due at 10 a.m. on Monday. Pay it!", 2},
+		{"Is it due? Yes.", 2},
+		{"Send it to Washington, D.C. Each office replies.", 2},
+		{"Wait... Then go.", 2},
+		{"Apply under paragraph (a)(1)(i) of this section", 0},
+		{"Items, etc. The rest.", 2},
+	}
+	for _, c := range cases {
+		if got := rawSentenceCount(c.text); got != c.want {
+			t.Errorf("rawSentenceCount(%q) = %d, want %d (%q)", c.text, got, c.want, SplitSentences(c.text))
+		}
+	}
+}
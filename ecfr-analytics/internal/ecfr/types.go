@@ -8,16 +8,44 @@ type Title struct {
 }
 
 type Agency struct {
-	Name          string        `json:"name"`
-	Slug          string        `json:"slug"`
-	Children      []Agency      `json:"children"`
-	CFRReferences []CFRRef      `json:"cfr_references"`
-	DisplayName   string        `json:"display_name"`
-	ShortName     string        `json:"short_name"`
+	Name          string   `json:"name"`
+	Slug          string   `json:"slug"`
+	Children      []Agency `json:"children"`
+	CFRReferences []CFRRef `json:"cfr_references"`
+	DisplayName   string   `json:"display_name"`
+	ShortName     string   `json:"short_name"`
 }
 
 type CFRRef struct {
-	Title   int    `json:"title"`
-	Chapter string `json:"chapter,omitempty"`
+	Title    int    `json:"title"`
+	Chapter  string `json:"chapter,omitempty"`
 	Subtitle string `json:"subtitle,omitempty"`
 }
+
+// Covers reports whether r refers to text in the given chapter of a title
+// and subtitle: r's chapter, everything in r's subtitle, or for a whole-title
+// reference everything in the title.
+func (r CFRRef) Covers(title int, subtitle, chapter string) bool {
+	switch {
+	case r.Title != title:
+		return false
+	case r.Chapter != "":
+		return r.Chapter == chapter
+	case r.Subtitle != "":
+		return r.Subtitle == subtitle
+	}
+	return true
+}
+
+type ContentVersion struct {
+	Date          string `json:"date"`
+	AmendmentDate string `json:"amendment_date"`
+	IssueDate     string `json:"issue_date"`
+	Identifier    string `json:"identifier"`
+	Name          string `json:"name"`
+	Part          string `json:"part"`
+	Subpart       string `json:"subpart"`
+	Type          string `json:"type"`
+	Substantive   bool   `json:"substantive"`
+	Removed       bool   `json:"removed"`
+}
@@ -0,0 +1,24 @@
+package ecfr
+
+import "testing"
+
+func TestCFRRefCovers(t *testing.T) {
+	cases := []struct {
+		ref               CFRRef
+		subtitle, chapter string
+		want              bool
+	}{
+		{CFRRef{Title: 40, Chapter: "I"}, "", "I", true},
+		{CFRRef{Title: 40, Chapter: "I"}, "", "II", false},
+		{CFRRef{Title: 41, Chapter: "I"}, "", "I", false},
+		{CFRRef{Title: 40, Subtitle: "A"}, "A", "I", true},
+		{CFRRef{Title: 40, Subtitle: "A"}, "B", "I", false},
+		{CFRRef{Title: 40, Subtitle: "A", Chapter: "I"}, "B", "I", true},
+		{CFRRef{Title: 40}, "B", "", true},
+	}
+	for _, tc := range cases {
+		if got := tc.ref.Covers(40, tc.subtitle, tc.chapter); got != tc.want {
+			t.Fatalf("%#v covers %q/%q = %v, want %v", tc.ref, tc.subtitle, tc.chapter, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package export
+
+import (
+	"context"
+	"io"
+
+	"ecfr-analytics/internal/metrics"
+	"ecfr-analytics/internal/store"
+)
+
+// Layouts of an agency metrics export. LayoutLong has one row per agency,
+// date and metric; LayoutWide one row per agency and date with a column per
+// metric. Both end with the text profile the values were computed with.
+const (
+	LayoutLong = "long"
+	LayoutWide = "wide"
+)
+
+func ValidLayout(l string) bool { return l == LayoutLong || l == LayoutWide }
+
+// Metric is an exported metric and the kind of its values.
+type Metric struct {
+	Name string
+	Kind string
+}
+
+type Query struct {
+	Metrics []Metric
+	Layout  string
+	// Scope, From and To are as in store.ExportQuery.
+	Scope string
+	From  string
+	To    string
+}
+
+// WriteAgencyMetrics streams the agency metric values selected by q from st
+// to w as a format table, ordered by agency slug and date. Rows are written
+// as they are read, so a failure part way leaves w with a truncated table.
+func WriteAgencyMetrics(ctx context.Context, st *store.Store, w io.Writer, format string, q Query) error {
+	names := make([]string, len(q.Metrics))
+	for i, m := range q.Metrics {
+		names[i] = m.Name
+	}
+	sq := store.ExportQuery{Metrics: names, Scope: q.Scope, From: q.From, To: q.To}
+	if q.Layout == LayoutWide {
+		return writeWide(ctx, st, w, format, q.Metrics, sq)
+	}
+	return writeLong(ctx, st, w, format, q.Metrics, sq)
+}
+
+func writeLong(ctx context.Context, st *store.Store, w io.Writer, format string, ms []Metric, sq store.ExportQuery) error {
+	hasNum, hasText := false, false
+	for _, m := range ms {
+		hasNum = hasNum || m.Kind == metrics.KindNumber
+		hasText = hasText || m.Kind == metrics.KindText
+	}
+	cols := []Column{{"slug", metrics.KindText}, {"name", metrics.KindText}, {"date", metrics.KindText}, {"metric", metrics.KindText}}
+	if hasNum {
+		cols = append(cols, Column{"value", metrics.KindNumber})
+	}
+	if hasText {
+		cols = append(cols, Column{"value_text", metrics.KindText})
+	}
+	cols = append(cols, Column{"text_profile", metrics.KindText}, Column{"attribution", metrics.KindText})
+	tw, err := NewTableWriter(format, w, cols)
+	if err != nil {
+		return err
+	}
+	row := make([]any, len(cols))
+	err = st.EachAgencyMetric(ctx, sq, func(r store.MetricRow) error {
+		row = append(row[:0], r.Slug, r.Name, r.Date, r.Metric)
+		if hasNum {
+			row = append(row, numValue(r))
+		}
+		if hasText {
+			row = append(row, textValue(r))
+		}
+		row = append(row, r.TextProfile, r.Attribution)
+		return tw.WriteRow(row)
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func writeWide(ctx context.Context, st *store.Store, w io.Writer, format string, ms []Metric, sq store.ExportQuery) error {
+	cols := []Column{{"slug", metrics.KindText}, {"name", metrics.KindText}, {"date", metrics.KindText}}
+	index := make(map[string]int, len(ms))
+	for _, m := range ms {
+		index[m.Name] = len(cols)
+		cols = append(cols, Column{m.Name, m.Kind})
+	}
+	last := len(cols)
+	cols = append(cols, Column{"text_profile", metrics.KindText}, Column{"attribution", metrics.KindText})
+	tw, err := NewTableWriter(format, w, cols)
+	if err != nil {
+		return err
+	}
+	row := make([]any, len(cols))
+	pending := false
+	err = st.EachAgencyMetric(ctx, sq, func(r store.MetricRow) error {
+		if pending && (row[0] != r.Slug || row[2] != r.Date) {
+			if err := tw.WriteRow(row); err != nil {
+				return err
+			}
+			pending = false
+		}
+		if !pending {
+			clear(row)
+			row[0], row[1], row[2], row[last], row[last+1] = r.Slug, r.Name, r.Date, r.TextProfile, r.Attribution
+			pending = true
+		}
+		i := index[r.Metric]
+		if cols[i].Kind == metrics.KindNumber {
+			row[i] = numValue(r)
+		} else {
+			row[i] = textValue(r)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if pending {
+		if err := tw.WriteRow(row); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func numValue(r store.MetricRow) any {
+	if r.Num == nil {
+		return nil
+	}
+	return *r.Num
+}
+
+func textValue(r store.MetricRow) any {
+	if r.Text == nil {
+		return nil
+	}
+	return *r.Text
+}
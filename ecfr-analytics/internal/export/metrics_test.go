@@ -0,0 +1,86 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"ecfr-analytics/internal/ecfr"
+	"ecfr-analytics/internal/metrics"
+	"ecfr-analytics/internal/store"
+)
+
+func TestWriteAgencyMetrics(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.sqlite")+"?_busy_timeout=5000&_foreign_keys=1")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	st := store.New(db, dir)
+	if err := st.InitSchema(); err != nil {
+		t.Fatalf("init schema: %v", err)
+	}
+	ctx := context.Background()
+	if err := st.UpsertAgencies(ctx, []ecfr.Agency{{Name: "Agency A", Slug: "a"}, {Name: "Agency B", Slug: "b"}}); err != nil {
+		t.Fatalf("upsert agencies: %v", err)
+	}
+	num := func(v float64) *float64 { return &v }
+	sum := "abc"
+	puts := []struct {
+		slug, date, metric string
+		num                *float64
+		text               *string
+	}{
+		{"a", "2025-01-01", "word_count", num(10), nil},
+		{"a", "2025-01-01", "checksum", nil, &sum},
+		{"a", "2025-02-01", "word_count", num(12), nil},
+		{"b", "2025-01-01", "word_count", num(7), nil},
+		{"b", "2025-01-01", "readability", num(40), nil},
+	}
+	for _, p := range puts {
+		if err := st.PutAgencyMetric(ctx, p.slug, p.date, p.metric, store.ScopeOwn, "full", p.num, p.text); err != nil {
+			t.Fatalf("put metric: %v", err)
+		}
+	}
+	ms := []Metric{{"word_count", metrics.KindNumber}, {"checksum", metrics.KindText}}
+
+	cases := []struct {
+		layout, from string
+		want         string
+	}{
+		{LayoutLong, "", "slug,name,date,metric,value,value_text,text_profile,attribution\n" +
+			"a,Agency A,2025-01-01,checksum,,abc,\"all,-AUTH,-SOURCE\",full\n" +
+			"a,Agency A,2025-01-01,word_count,10,,\"all,-AUTH,-SOURCE\",full\n" +
+			"a,Agency A,2025-02-01,word_count,12,,\"all,-AUTH,-SOURCE\",full\n" +
+			"b,Agency B,2025-01-01,word_count,7,,\"all,-AUTH,-SOURCE\",full\n"},
+		{LayoutWide, "", "slug,name,date,word_count,checksum,text_profile,attribution\n" +
+			"a,Agency A,2025-01-01,10,abc,\"all,-AUTH,-SOURCE\",full\n" +
+			"a,Agency A,2025-02-01,12,,\"all,-AUTH,-SOURCE\",full\n" +
+			"b,Agency B,2025-01-01,7,,\"all,-AUTH,-SOURCE\",full\n"},
+		{LayoutWide, "2025-01-15", "slug,name,date,word_count,checksum,text_profile,attribution\n" +
+			"a,Agency A,2025-02-01,12,,\"all,-AUTH,-SOURCE\",full\n"},
+	}
+	for _, tc := range cases {
+		var buf bytes.Buffer
+		q := Query{Metrics: ms, Layout: tc.layout, From: tc.from}
+		if err := WriteAgencyMetrics(ctx, st, &buf, FormatCSV, q); err != nil {
+			t.Fatalf("%s: export: %v", tc.layout, err)
+		}
+		if buf.String() != tc.want {
+			t.Fatalf("%s from %q: got\n%s\nwant\n%s", tc.layout, tc.from, buf.String(), tc.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteAgencyMetrics(ctx, st, &buf, FormatParquet, Query{Metrics: ms, Layout: LayoutWide}); err != nil {
+		t.Fatalf("parquet export: %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("PAR1")) || !bytes.HasSuffix(buf.Bytes(), []byte("PAR1")) {
+		t.Fatalf("not a parquet file")
+	}
+}
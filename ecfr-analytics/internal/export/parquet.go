@@ -0,0 +1,311 @@
+package export
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"ecfr-analytics/internal/metrics"
+)
+
+// parquetRowGroupSize bounds how many rows are buffered before a row group is
+// written out.
+const parquetRowGroupSize = 10000
+
+// Parquet enum values (parquet.thrift) used by parquetWriter.
+const (
+	pqTypeDouble    = 5
+	pqTypeByteArray = 6
+	pqOptional      = 1
+	pqUTF8          = 0
+	pqPlain         = 0
+	pqRLE           = 3
+	pqUncompressed  = 0
+	pqDataPage      = 0
+)
+
+// parquetWriter writes a Parquet file with every column optional, PLAIN
+// encoded and uncompressed: one data page per column per row group, then the
+// footer. Only the current row group is held in memory.
+type parquetWriter struct {
+	w      io.Writer
+	cols   []Column
+	bufs   []pqColumnBuf
+	rows   int
+	offset int64
+	groups []pqRowGroup
+	total  int64
+}
+
+type pqColumnBuf struct {
+	values []byte
+	levels []byte
+}
+
+type pqRowGroup struct {
+	rows   int
+	chunks []pqChunk
+}
+
+type pqChunk struct {
+	offset int64
+	size   int64
+	values int
+}
+
+func newParquetWriter(w io.Writer, cols []Column) (*parquetWriter, error) {
+	for _, c := range cols {
+		if c.Kind != metrics.KindText && c.Kind != metrics.KindNumber {
+			return nil, fmt.Errorf("column %s: unknown kind %q", c.Name, c.Kind)
+		}
+	}
+	p := &parquetWriter{w: w, cols: cols, bufs: make([]pqColumnBuf, len(cols))}
+	if err := p.write([]byte("PAR1")); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *parquetWriter) write(b []byte) error {
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	return err
+}
+
+func (p *parquetWriter) WriteRow(vals []any) error {
+	for i, v := range vals {
+		b := &p.bufs[i]
+		if v == nil {
+			b.levels = append(b.levels, 0)
+			continue
+		}
+		b.levels = append(b.levels, 1)
+		switch p.cols[i].Kind {
+		case metrics.KindNumber:
+			f, ok := v.(float64)
+			if !ok {
+				return fmt.Errorf("column %s: want float64, got %T", p.cols[i].Name, v)
+			}
+			b.values = binary.LittleEndian.AppendUint64(b.values, math.Float64bits(f))
+		case metrics.KindText:
+			s, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("column %s: want string, got %T", p.cols[i].Name, v)
+			}
+			b.values = binary.LittleEndian.AppendUint32(b.values, uint32(len(s)))
+			b.values = append(b.values, s...)
+		}
+	}
+	p.rows++
+	if p.rows >= parquetRowGroupSize {
+		return p.flush()
+	}
+	return nil
+}
+
+// flush writes the buffered rows as a row group.
+func (p *parquetWriter) flush() error {
+	if p.rows == 0 {
+		return nil
+	}
+	g := pqRowGroup{rows: p.rows}
+	for i := range p.bufs {
+		b := &p.bufs[i]
+		levels := encodeLevels(b.levels)
+		data := binary.LittleEndian.AppendUint32(nil, uint32(len(levels)))
+		data = append(append(data, levels...), b.values...)
+
+		var h thriftWriter
+		h.i32(1, pqDataPage)
+		h.i32(2, int32(len(data)))
+		h.i32(3, int32(len(data)))
+		h.structBegin(5)
+		h.i32(1, int32(p.rows))
+		h.i32(2, pqPlain)
+		h.i32(3, pqRLE)
+		h.i32(4, pqRLE)
+		h.structEnd()
+		h.stop()
+
+		c := pqChunk{offset: p.offset, size: int64(len(h.buf) + len(data)), values: p.rows}
+		if err := p.write(h.buf); err != nil {
+			return err
+		}
+		if err := p.write(data); err != nil {
+			return err
+		}
+		g.chunks = append(g.chunks, c)
+		b.values, b.levels = b.values[:0], b.levels[:0]
+	}
+	p.groups = append(p.groups, g)
+	p.total += int64(p.rows)
+	p.rows = 0
+	return nil
+}
+
+func (p *parquetWriter) Close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+	var t thriftWriter
+	t.i32(1, 1)
+	t.listBegin(2, thriftStruct, len(p.cols)+1)
+	t.elemBegin()
+	t.str(4, "schema")
+	t.i32(5, int32(len(p.cols)))
+	t.structEnd()
+	for _, c := range p.cols {
+		t.elemBegin()
+		t.i32(1, pqType(c))
+		t.i32(3, pqOptional)
+		t.str(4, c.Name)
+		if c.Kind == metrics.KindText {
+			t.i32(6, pqUTF8)
+		}
+		t.structEnd()
+	}
+	t.i64(3, p.total)
+	t.listBegin(4, thriftStruct, len(p.groups))
+	for _, g := range p.groups {
+		t.elemBegin()
+		t.listBegin(1, thriftStruct, len(g.chunks))
+		var size int64
+		for i, ch := range g.chunks {
+			size += ch.size
+			t.elemBegin()
+			t.i64(2, ch.offset)
+			t.structBegin(3)
+			t.i32(1, pqType(p.cols[i]))
+			t.listBegin(2, thriftI32, 2)
+			t.varint(zigzag(pqPlain))
+			t.varint(zigzag(pqRLE))
+			t.listBegin(3, thriftBinary, 1)
+			t.binary([]byte(p.cols[i].Name))
+			t.i32(4, pqUncompressed)
+			t.i64(5, int64(ch.values))
+			t.i64(6, ch.size)
+			t.i64(7, ch.size)
+			t.i64(9, ch.offset)
+			t.structEnd()
+			t.structEnd()
+		}
+		t.i64(2, size)
+		t.i64(3, int64(g.rows))
+		t.structEnd()
+	}
+	t.str(6, "ecfr-analytics")
+	t.stop()
+
+	footer := binary.LittleEndian.AppendUint32(t.buf, uint32(len(t.buf)))
+	return p.write(append(footer, "PAR1"...))
+}
+
+func pqType(c Column) int32 {
+	if c.Kind == metrics.KindNumber {
+		return pqTypeDouble
+	}
+	return pqTypeByteArray
+}
+
+// encodeLevels encodes definition levels of bit width 1 as RLE runs of the
+// RLE/bit-packing hybrid encoding.
+func encodeLevels(levels []byte) []byte {
+	var out []byte
+	for i := 0; i < len(levels); {
+		j := i
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		out = binary.AppendUvarint(out, uint64(j-i)<<1)
+		out = append(out, levels[i])
+		i = j
+	}
+	return out
+}
+
+// Thrift compact protocol type codes.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs in the Thrift compact protocol, which Parquet
+// uses for page headers and the footer.
+type thriftWriter struct {
+	buf  []byte
+	last []int16
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	if len(t.last) == 0 {
+		t.last = append(t.last, 0)
+	}
+	last := &t.last[len(t.last)-1]
+	if d := id - *last; d > 0 && d <= 15 {
+		t.buf = append(t.buf, byte(d)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.varint(zigzag(int64(id)))
+	}
+	*last = id
+}
+
+func (t *thriftWriter) varint(v uint64) { t.buf = binary.AppendUvarint(t.buf, v) }
+
+func zigzag(v int64) uint64 { return uint64((v << 1) ^ (v >> 63)) }
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(zigzag(v))
+}
+
+func (t *thriftWriter) binary(b []byte) {
+	t.varint(uint64(len(b)))
+	t.buf = append(t.buf, b...)
+}
+
+func (t *thriftWriter) str(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.binary([]byte(s))
+}
+
+func (t *thriftWriter) listBegin(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|elem)
+		return
+	}
+	t.buf = append(t.buf, 0xf0|elem)
+	t.varint(uint64(n))
+}
+
+// structBegin starts a struct-valued field; elemBegin starts a struct list
+// element. Both are ended by structEnd.
+func (t *thriftWriter) structBegin(id int16) {
+	t.field(id, thriftStruct)
+	t.elemBegin()
+}
+
+func (t *thriftWriter) elemBegin() {
+	if len(t.last) == 0 {
+		t.last = append(t.last, 0)
+	}
+	t.last = append(t.last, 0)
+}
+
+func (t *thriftWriter) structEnd() {
+	t.buf = append(t.buf, 0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+// stop ends the top-level struct.
+func (t *thriftWriter) stop() { t.buf = append(t.buf, 0) }
@@ -0,0 +1,171 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+
+	"ecfr-analytics/internal/metrics"
+)
+
+func TestParquetRoundTrip(t *testing.T) {
+	cols := []Column{{"slug", metrics.KindText}, {"value", metrics.KindNumber}}
+	var buf bytes.Buffer
+	pw, err := newParquetWriter(&buf, cols)
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	n := parquetRowGroupSize + 3
+	for i := 0; i < n; i++ {
+		var v any
+		if i%3 != 0 {
+			v = float64(i)
+		}
+		if err := pw.WriteRow([]any{fmt.Sprintf("agency-%d", i), v}); err != nil {
+			t.Fatalf("write row: %v", err)
+		}
+	}
+	if err := pw.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	b := buf.Bytes()
+	if string(b[:4]) != "PAR1" || string(b[len(b)-4:]) != "PAR1" {
+		t.Fatalf("missing magic")
+	}
+	flen := int(binary.LittleEndian.Uint32(b[len(b)-8:]))
+	r := &thriftReader{b: b[len(b)-8-flen : len(b)-8]}
+	meta := r.readStruct()
+	if r.pos != flen {
+		t.Fatalf("footer decoded %d of %d bytes", r.pos, flen)
+	}
+	if meta[3] != int64(n) {
+		t.Fatalf("num_rows = %v, want %d", meta[3], n)
+	}
+	schema := meta[2].([]any)
+	if len(schema) != 3 || string(schema[1].(map[int16]any)[4].([]byte)) != "slug" {
+		t.Fatalf("unexpected schema: %#v", schema)
+	}
+	groups := meta[4].([]any)
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 row groups, got %d", len(groups))
+	}
+
+	// Read back the value column and check nulls and values.
+	row := 0
+	for _, g := range groups {
+		chunk := g.(map[int16]any)[1].([]any)[1].(map[int16]any)[3].(map[int16]any)
+		off := int(chunk[9].(int64))
+		hr := &thriftReader{b: b[off:]}
+		hdr := hr.readStruct()
+		data := b[off+hr.pos : off+hr.pos+int(hdr[3].(int64))]
+		count := int(hdr[5].(map[int16]any)[1].(int64))
+		llen := int(binary.LittleEndian.Uint32(data))
+		levels := decodeLevels(t, data[4:4+llen], count)
+		vals := data[4+llen:]
+		for _, l := range levels {
+			want := row%3 != 0
+			if (l == 1) != want {
+				t.Fatalf("row %d: level %d", row, l)
+			}
+			if l == 1 {
+				v := math.Float64frombits(binary.LittleEndian.Uint64(vals))
+				vals = vals[8:]
+				if v != float64(row) {
+					t.Fatalf("row %d: value %v", row, v)
+				}
+			}
+			row++
+		}
+		if len(vals) != 0 {
+			t.Fatalf("%d bytes of values left over", len(vals))
+		}
+	}
+	if row != n {
+		t.Fatalf("read %d rows, want %d", row, n)
+	}
+}
+
+func decodeLevels(t *testing.T, b []byte, count int) []byte {
+	t.Helper()
+	var out []byte
+	for len(b) > 0 {
+		h, k := binary.Uvarint(b)
+		if h&1 != 0 {
+			t.Fatalf("unexpected bit-packed run")
+		}
+		for i := uint64(0); i < h>>1; i++ {
+			out = append(out, b[k])
+		}
+		b = b[k+1:]
+	}
+	if len(out) != count {
+		t.Fatalf("decoded %d levels, want %d", len(out), count)
+	}
+	return out
+}
+
+// thriftReader decodes the compact protocol subset parquetWriter emits.
+// Integers decode as int64, binaries as []byte, structs as maps by field id.
+type thriftReader struct {
+	b   []byte
+	pos int
+}
+
+func (r *thriftReader) varint() uint64 {
+	v, n := binary.Uvarint(r.b[r.pos:])
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) readStruct() map[int16]any {
+	out := map[int16]any{}
+	var last int16
+	for {
+		h := r.b[r.pos]
+		r.pos++
+		if h == 0 {
+			return out
+		}
+		id := last + int16(h>>4)
+		if h>>4 == 0 {
+			id = int16(r.zigzag())
+		}
+		last = id
+		out[id] = r.readValue(h & 0x0f)
+	}
+}
+
+func (r *thriftReader) readValue(typ byte) any {
+	switch typ {
+	case thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		n := int(r.varint())
+		v := r.b[r.pos : r.pos+n]
+		r.pos += n
+		return v
+	case thriftStruct:
+		return r.readStruct()
+	case thriftList:
+		h := r.b[r.pos]
+		r.pos++
+		n := int(h >> 4)
+		if n == 15 {
+			n = int(r.varint())
+		}
+		out := make([]any, n)
+		for i := range out {
+			out[i] = r.readValue(h & 0x0f)
+		}
+		return out
+	}
+	panic(fmt.Sprintf("unexpected thrift type %d", typ))
+}
@@ -0,0 +1,138 @@
+// Package export writes tables of metric values as CSV, JSON Lines or
+// Parquet, one row at a time.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	FormatCSV     = "csv"
+	FormatJSONL   = "jsonl"
+	FormatParquet = "parquet"
+)
+
+func ValidFormat(f string) bool { return f == FormatCSV || f == FormatJSONL || f == FormatParquet }
+
+// ContentType is the media type of a format.
+func ContentType(format string) string {
+	switch format {
+	case FormatJSONL:
+		return "application/x-ndjson"
+	case FormatParquet:
+		return "application/vnd.apache.parquet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Column is a table column. Its Kind is a metric kind: a metrics.KindText
+// column holds strings, a metrics.KindNumber column float64s; either may hold
+// nil.
+type Column struct {
+	Name string
+	Kind string
+}
+
+// TableWriter writes rows of values in column order. Close flushes anything
+// buffered and ends the table; it does not close the underlying writer.
+type TableWriter interface {
+	WriteRow(vals []any) error
+	Close() error
+}
+
+// NewTableWriter returns a TableWriter for format over w.
+func NewTableWriter(format string, w io.Writer, cols []Column) (TableWriter, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, cols)
+	case FormatJSONL:
+		return &jsonlWriter{enc: json.NewEncoder(w), cols: cols}, nil
+	case FormatParquet:
+		return newParquetWriter(w, cols)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+type csvWriter struct {
+	w   *csv.Writer
+	rec []string
+}
+
+func newCSVWriter(w io.Writer, cols []Column) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w), rec: make([]string, len(cols))}
+	for i, c := range cols {
+		cw.rec[i] = c.Name
+	}
+	if err := cw.w.Write(cw.rec); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (c *csvWriter) WriteRow(vals []any) error {
+	for i, v := range vals {
+		switch v := v.(type) {
+		case nil:
+			c.rec[i] = ""
+		case float64:
+			c.rec[i] = strconv.FormatFloat(v, 'g', -1, 64)
+		case string:
+			c.rec[i] = v
+		default:
+			c.rec[i] = fmt.Sprint(v)
+		}
+	}
+	return c.w.Write(c.rec)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonlWriter writes each row as one JSON object keyed by column name, in
+// column order.
+type jsonlWriter struct {
+	enc  *json.Encoder
+	cols []Column
+}
+
+func (j *jsonlWriter) WriteRow(vals []any) error {
+	obj := make(orderedObject, len(vals))
+	for i, v := range vals {
+		obj[i] = field{j.cols[i].Name, v}
+	}
+	return j.enc.Encode(obj)
+}
+
+func (j *jsonlWriter) Close() error { return nil }
+
+type field struct {
+	key string
+	val any
+}
+
+type orderedObject []field
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	b := []byte{'{'}
+	for i, f := range o {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		k, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(f.val)
+		if err != nil {
+			return nil, err
+		}
+		b = append(append(append(b, k...), ':'), v...)
+	}
+	return append(b, '}'), nil
+}
@@ -0,0 +1,39 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+
+	"ecfr-analytics/internal/metrics"
+)
+
+func TestCSVAndJSONL(t *testing.T) {
+	cols := []Column{{"slug", metrics.KindText}, {"word_count", metrics.KindNumber}, {"checksum", metrics.KindText}}
+	rows := [][]any{{"a", 12.0, "x,y"}, {"b", nil, nil}}
+
+	cases := map[string]string{
+		FormatCSV:   "slug,word_count,checksum\na,12,\"x,y\"\nb,,\n",
+		FormatJSONL: `{"slug":"a","word_count":12,"checksum":"x,y"}` + "\n" + `{"slug":"b","word_count":null,"checksum":null}` + "\n",
+	}
+	for format, want := range cases {
+		var buf bytes.Buffer
+		tw, err := NewTableWriter(format, &buf, cols)
+		if err != nil {
+			t.Fatalf("%s: new writer: %v", format, err)
+		}
+		for _, r := range rows {
+			if err := tw.WriteRow(r); err != nil {
+				t.Fatalf("%s: write: %v", format, err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatalf("%s: close: %v", format, err)
+		}
+		if buf.String() != want {
+			t.Fatalf("%s: got\n%s\nwant\n%s", format, buf.String(), want)
+		}
+	}
+	if _, err := NewTableWriter("xlsx", &bytes.Buffer{}, cols); err == nil {
+		t.Fatalf("expected unknown format to fail")
+	}
+}
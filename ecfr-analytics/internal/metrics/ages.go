@@ -0,0 +1,219 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"ecfr-analytics/internal/ecfr"
+	"ecfr-analytics/internal/store"
+)
+
+// amendmentCache is chapterStatsCache for the last-amended dates of each
+// snapshot's sections, grouped by chapter. When index is set, as during a
+// computation, snapshots the refresh has not dated with the versioner's
+// history are dated from their notes on first use; otherwise they stay
+// undated. A snapshot that is not dated has no ages.
+type amendmentCache struct {
+	st    *store.Store
+	index bool
+	m     map[titleKey]map[string][]ecfr.SectionAmendment
+	errs  map[titleKey]error
+}
+
+func newAmendmentCache(st *store.Store, index bool) *amendmentCache {
+	return &amendmentCache{
+		st:    st,
+		index: index,
+		m:     map[titleKey]map[string][]ecfr.SectionAmendment{},
+		errs:  map[titleKey]error{},
+	}
+}
+
+// chapter returns the dated sections of one chapter of a snapshot. dated is
+// false if the snapshot has not been dated.
+func (c *amendmentCache) chapter(ctx context.Context, title int, date, chapter string) (sections []ecfr.SectionAmendment, dated bool, err error) {
+	k := titleKey{Title: title, Date: date}
+	if err, ok := c.errs[k]; ok {
+		return nil, false, err
+	}
+	chapters, ok := c.m[k]
+	if !ok {
+		amended, err := c.load(ctx, title, date)
+		if err != nil {
+			err = fmt.Errorf("load section ages: %w", err)
+			c.errs[k] = err
+			return nil, false, err
+		}
+		if amended != nil {
+			chapters = map[string][]ecfr.SectionAmendment{}
+			for _, a := range amended {
+				if a.LastAmended != "" {
+					chapters[a.Chapter] = append(chapters[a.Chapter], a)
+				}
+			}
+		}
+		c.m[k] = chapters
+	}
+	return chapters[chapter], chapters != nil, nil
+}
+
+func (c *amendmentCache) load(ctx context.Context, title int, date string) ([]ecfr.SectionAmendment, error) {
+	amended, err := c.st.SectionAmendments(ctx, title, date)
+	if err != nil || amended != nil || !c.index {
+		return amended, err
+	}
+	if err := c.st.IndexTitleAmendments(ctx, title, date, nil); err != nil {
+		return nil, err
+	}
+	return c.st.SectionAmendments(ctx, title, date)
+}
+
+// lastAmended lists the last-amended dates of amended.
+func lastAmended(amended []ecfr.SectionAmendment) []string {
+	out := make([]string, len(amended))
+	for i, a := range amended {
+		out[i] = a.LastAmended
+	}
+	return out
+}
+
+// ageYears is the time from one YYYY-MM-DD date to another in years, or
+// false if either does not parse.
+func ageYears(from, to string) (float64, bool) {
+	f, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return 0, false
+	}
+	t, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		return 0, false
+	}
+	return t.Sub(f).Hours() / 24 / 365.2425, true
+}
+
+// percentile is the p-th percentile (0-100) of sorted values, interpolating
+// between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	r := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(r))
+	if lo >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lo] + (sorted[lo+1]-sorted[lo])*(r-float64(lo))
+}
+
+// SectionAge is a dated section or appendix of a title snapshot and its age
+// at the snapshot's date. Basis says where LastAmended comes from: the
+// versioner's amendment history or the section's notes.
+type SectionAge struct {
+	Title       int     `json:"title"`
+	Chapter     string  `json:"chapter"`
+	Part        string  `json:"part"`
+	Type        string  `json:"type"`
+	Section     string  `json:"section"`
+	Heading     string  `json:"heading"`
+	Date        string  `json:"date"`
+	LastAmended string  `json:"last_amended"`
+	Basis       string  `json:"basis"`
+	AgeYears    float64 `json:"age_years"`
+}
+
+// UndatedSnapshot is a title snapshot whose sections have not been dated.
+type UndatedSnapshot struct {
+	Title int    `json:"title"`
+	Date  string `json:"date"`
+}
+
+// SectionAges is an agency's dated sections and appendices, and the
+// referenced snapshots that have none because they are not dated yet.
+type SectionAges struct {
+	Sections []SectionAge
+	Undated  []UndatedSnapshot
+}
+
+// AgencySectionAges lists the dated sections and appendices in an agency's
+// referenced chapters that are at least minYears old, oldest first. date
+// selects each title's snapshot on or before it; empty means the current
+// snapshots. Snapshots are not dated here; those a refresh has not dated are
+// listed as undated.
+func AgencySectionAges(ctx context.Context, st *store.Store, slug, date string, minYears float64) (*SectionAges, error) {
+	agencies, err := loadAgencies(ctx, st)
+	if err != nil {
+		return nil, err
+	}
+	var agency *agencyRecord
+	for i := range agencies {
+		if agencies[i].Slug == slug {
+			agency = &agencies[i]
+			break
+		}
+	}
+	if agency == nil {
+		return nil, fmt.Errorf("%w: %s", store.ErrUnknownAgency, slug)
+	}
+
+	titles, err := loadTitles(ctx, st)
+	if err != nil {
+		return nil, err
+	}
+	titleDates := currentTitleDates(titles)
+	if date != "" {
+		titleDates = titleDatesAsOf(ctx, st, titles, date)
+	}
+
+	cache := newChapterStatsCache(st)
+	ages := newAmendmentCache(st, false)
+	out := &SectionAges{Sections: []SectionAge{}, Undated: []UndatedSnapshot{}}
+	seen := map[string]bool{}
+	undated := map[titleKey]bool{}
+	for _, ref := range agency.Raw.CFRReferences {
+		td := titleDates[ref.Title]
+		if td == "" {
+			continue
+		}
+		chMap, err := cache.get(ctx, ref.Title, td)
+		if err != nil {
+			continue
+		}
+		for _, k := range resolveRef(ref, chMap) {
+			if seen[refKey(ref.Title, k)] {
+				continue
+			}
+			seen[refKey(ref.Title, k)] = true
+			sections, dated, err := ages.chapter(ctx, ref.Title, td, k)
+			if err != nil {
+				return nil, fmt.Errorf("title %d: %w", ref.Title, err)
+			}
+			if tk := (titleKey{Title: ref.Title, Date: td}); !dated && !undated[tk] {
+				undated[tk] = true
+				out.Undated = append(out.Undated, UndatedSnapshot{Title: ref.Title, Date: td})
+			}
+			for _, a := range sections {
+				age, ok := ageYears(a.LastAmended, td)
+				if !ok || age < minYears {
+					continue
+				}
+				out.Sections = append(out.Sections, SectionAge{
+					Title:       ref.Title,
+					Chapter:     a.Chapter,
+					Part:        a.Part,
+					Type:        a.Type,
+					Section:     a.Identifier,
+					Heading:     a.Heading,
+					Date:        td,
+					LastAmended: a.LastAmended,
+					Basis:       a.Basis,
+					AgeYears:    age,
+				})
+			}
+		}
+	}
+	sort.SliceStable(out.Sections, func(i, j int) bool { return out.Sections[i].AgeYears > out.Sections[j].AgeYears })
+	return out, nil
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"testing"
+
+	"ecfr-analytics/internal/ecfr"
+	"ecfr-analytics/internal/store"
+)
+
+func TestPercentile(t *testing.T) {
+	vals := []float64{1, 2, 3, 4}
+	cases := map[float64]float64{0: 1, 50: 2.5, 90: 3.7, 100: 4}
+	for p, want := range cases {
+		if got := percentile(vals, p); math.Abs(got-want) > 1e-9 {
+			t.Fatalf("percentile %v = %v, want %v", p, got, want)
+		}
+	}
+	if got := percentile([]float64{7}, 90); got != 7 {
+		t.Fatalf("single value percentile = %v", got)
+	}
+}
+
+func TestSectionAgeMetrics(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	agencies := []ecfr.Agency{
+		{Name: "Agency One", Slug: "one", CFRReferences: []ecfr.CFRRef{{Title: 1, Chapter: "I"}}},
+		{Name: "Agency Two", Slug: "two", CFRReferences: []ecfr.CFRRef{{Title: 1, Chapter: "II"}}},
+	}
+	if err := st.UpsertAgencies(ctx, agencies); err != nil {
+		t.Fatalf("upsert agencies: %v", err)
+	}
+	if err := st.UpsertTitles(ctx, []ecfr.Title{{Number: 1, Name: "Title 1", UpToDateAsOf: "2025-01-01"}}); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	xml := []byte(`<ECFR><DIV1 N="1" TYPE="TITLE">
+<DIV3 N="I" TYPE="CHAPTER"><DIV5 N="1" TYPE="PART"><HEAD>PART 1—GENERAL</HEAD>
+<SOURCE><HED>Source:</HED><PSPACE>50 FR 100, Jan. 1, 1985, unless otherwise noted.</PSPACE></SOURCE>
+<DIV8 N="1.1" TYPE="SECTION"><HEAD>§ 1.1 Scope.</HEAD><P>Scope.</P></DIV8>
+<DIV8 N="1.2" TYPE="SECTION"><HEAD>§ 1.2 Filing.</HEAD><P>Filing.</P>
+<CITA TYPE="N">[50 FR 100, Jan. 1, 1985, as amended at 80 FR 200, Jan. 1, 2015]</CITA></DIV8>
+<DIV8 N="1.3" TYPE="SECTION"><HEAD>§ 1.3 Fees.</HEAD><P>Fees.</P>
+<CITA TYPE="N">[85 FR 300, Jan. 1, 2020]</CITA></DIV8>
+<DIV8 N="1.4" TYPE="SECTION"><HEAD>§ 1.4 [Reserved]</HEAD></DIV8>
+</DIV5></DIV3>
+<DIV3 N="II" TYPE="CHAPTER"><DIV5 N="2" TYPE="PART"><HEAD>PART 2—OTHER</HEAD>
+<DIV8 N="2.1" TYPE="SECTION"><HEAD>§ 2.1 Undated.</HEAD><P>Undated.</P></DIV8>
+</DIV5></DIV3>
+</DIV1></ECFR>`)
+	if err := st.SaveSnapshotFromReader(ctx, 1, "2025-01-01", bytes.NewReader(xml)); err != nil {
+		t.Fatalf("save snapshot: %v", err)
+	}
+	undated, err := AgencySectionAges(ctx, st, "one", "", 0)
+	if err != nil {
+		t.Fatalf("undated agency ages: %v", err)
+	}
+	if len(undated.Sections) != 0 || len(undated.Undated) != 1 || undated.Undated[0] != (UndatedSnapshot{Title: 1, Date: "2025-01-01"}) {
+		t.Fatalf("expected an undated snapshot and no ages, got %#v", undated)
+	}
+	if amended, err := st.SectionAmendments(ctx, 1, "2025-01-01"); err != nil || amended != nil {
+		t.Fatalf("expected reading ages not to date the snapshot, got %v, %v", amended, err)
+	}
+	if _, err := ComputeLatest(ctx, st); err != nil {
+		t.Fatalf("compute latest: %v", err)
+	}
+
+	rows, err := st.LatestAgencyMetric(ctx, "median_section_age", store.ScopeOwn)
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("latest median age: %#v %v", rows, err)
+	}
+	for _, r := range rows {
+		switch r["slug"] {
+		case "one":
+			if v := r["value"].(float64); math.Abs(v-10) > 0.01 {
+				t.Fatalf("expected a median age of 10 years, got %v", v)
+			}
+		case "two":
+			if r["value"] != nil {
+				t.Fatalf("expected no age without dated sections, got %v", r["value"])
+			}
+		}
+	}
+	tm, err := st.TitleMetricsAsOf(ctx, 1, "")
+	if err != nil {
+		t.Fatalf("title metrics: %v", err)
+	}
+	if v := tm.Values["p90_section_age"].(float64); math.Abs(v-34) > 0.01 {
+		t.Fatalf("expected a 90th percentile age of 34 years, got %v", v)
+	}
+
+	ages, err := AgencySectionAges(ctx, st, "one", "", 8)
+	if err != nil {
+		t.Fatalf("agency ages: %v", err)
+	}
+	got := ages.Sections
+	if len(got) != 2 || got[0].Section != "1.1" || got[0].Basis != ecfr.AmendedSource || got[1].Section != "1.2" || got[1].LastAmended != "2015-01-01" || len(ages.Undated) != 0 {
+		t.Fatalf("unexpected agency ages: %#v", ages)
+	}
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"ecfr-analytics/internal/store"
+)
+
+// computeTitle computes and stores every registered metric for a whole title
+// snapshot and for each of its chapters, independently of agency references.
+// It returns the title's chapters for the CFR-wide totals.
+func computeTitle(ctx context.Context, st *store.Store, cache *chapterStatsCache, partCache *partStatsCache, ages *amendmentCache, title int, date string) ([]AgencyChapter, error) {
+	chMap, err := cache.get(ctx, title, date)
+	if err != nil {
+		return nil, err
+	}
+	parts, err := partCache.get(ctx, title, date)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(chMap))
+	for k := range chMap {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if pi, pj := chMap[keys[i]].Position, chMap[keys[j]].Position; pi != pj {
+			return pi < pj
+		}
+		return keys[i] < keys[j]
+	})
+
+	name := fmt.Sprintf("Title %d", title)
+	text := &AgencyText{Name: name, Date: date}
+	chapters := make([]store.ChapterValues, 0, len(keys))
+	for _, k := range keys {
+		amended, _, err := ages.chapter(ctx, title, date, k)
+		if err != nil {
+			return nil, err
+		}
+		c := AgencyChapter{Title: title, Chapter: k, Date: date, Stats: chMap[k], Parts: parts, Share: 1,
+			Amended: lastAmended(amended)}
+		text.Chapters = append(text.Chapters, c)
+		ct := &AgencyText{Name: name + " chapter " + k, Date: date, Chapters: []AgencyChapter{c}}
+		ct.Churn = computeChurnBestEffort(ctx, st, cache, ct.Chapters)
+		chapters = append(chapters, store.ChapterValues{Chapter: k, Values: computeValues(ct)})
+	}
+	text.Churn = computeChurnBestEffort(ctx, st, cache, text.Chapters)
+	if err := st.PutTitleMetrics(ctx, title, date, computeValues(text)); err != nil {
+		return nil, fmt.Errorf("store title metrics: %w", err)
+	}
+	if err := st.PutChapterMetrics(ctx, title, date, chapters); err != nil {
+		return nil, fmt.Errorf("store chapter metrics: %w", err)
+	}
+	return text.Chapters, nil
+}
+
+// computeCFR stores every registered metric over chapters, the chapters of
+// every title computed, under store.WholeCFR at the newest of their dates.
+func computeCFR(ctx context.Context, st *store.Store, cache *chapterStatsCache, chapters []AgencyChapter) error {
+	if len(chapters) == 0 {
+		return nil
+	}
+	text := &AgencyText{Name: "Code of Federal Regulations", Chapters: chapters}
+	for _, c := range chapters {
+		text.Date = max(text.Date, c.Date)
+	}
+	text.Churn = computeChurnBestEffort(ctx, st, cache, chapters)
+	if err := st.PutTitleMetrics(ctx, store.WholeCFR, text.Date, computeValues(text)); err != nil {
+		return fmt.Errorf("store CFR metrics: %w", err)
+	}
+	return nil
+}
+
+func computeValues(text *AgencyText) []store.MetricValue {
+	vals := make([]store.MetricValue, 0, len(registry))
+	for _, m := range registry {
+		v := m.Compute(text)
+		vals = append(vals, store.MetricValue{Metric: m.Info().Name, Num: v.Num, Text: v.Text})
+	}
+	return vals
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"ecfr-analytics/internal/ecfr"
+	"ecfr-analytics/internal/store"
+)
+
+func TestComputeTitleAndCFRMetrics(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	// No agency references title 2; it still gets metrics.
+	agency := ecfr.Agency{Name: "Agency One", Slug: "agency-one", CFRReferences: []ecfr.CFRRef{{Title: 1, Chapter: "I"}}}
+	if err := st.UpsertAgencies(ctx, []ecfr.Agency{agency}); err != nil {
+		t.Fatalf("upsert agencies: %v", err)
+	}
+	if err := st.UpsertTitles(ctx, []ecfr.Title{
+		{Number: 1, Name: "Title 1", UpToDateAsOf: "2025-01-02"},
+		{Number: 2, Name: "Title 2", UpToDateAsOf: "2025-01-03"},
+	}); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	snapshots := map[int]struct {
+		date string
+		xml  string
+	}{
+		1: {"2025-01-02", `<ROOT><DIV1 TYPE="CHAPTER" N="I"><P>One two.</P></DIV1><DIV1 TYPE="CHAPTER" N="II"><P>Three four five.</P></DIV1></ROOT>`},
+		2: {"2025-01-03", `<ROOT><DIV1 TYPE="CHAPTER" N="I"><P>You shall.</P></DIV1></ROOT>`},
+	}
+	for n, s := range snapshots {
+		if err := st.SaveSnapshotFromReader(ctx, n, s.date, bytes.NewReader([]byte(s.xml))); err != nil {
+			t.Fatalf("save snapshot %d: %v", n, err)
+		}
+	}
+	if _, err := ComputeLatest(ctx, st); err != nil {
+		t.Fatalf("compute latest: %v", err)
+	}
+
+	rows, err := st.LatestTitleMetric(ctx, "word_count")
+	if err != nil || len(rows) != 2 || rows[0]["value"] != 5.0 || rows[1]["value"] != 2.0 {
+		t.Fatalf("unexpected title word counts: %#v %v", rows, err)
+	}
+	cfr, err := st.TitleMetricsAsOf(ctx, store.WholeCFR, "")
+	if err != nil || cfr.Date != "2025-01-03" || cfr.Values["word_count"] != 7.0 || cfr.Values["restriction_count"] != 1.0 || cfr.Values["words_per_chapter"] != 7.0/3 {
+		t.Fatalf("unexpected CFR metrics: %#v %v", cfr, err)
+	}
+	_, chapters, err := st.ChapterMetricsAsOf(ctx, 1, "")
+	if err != nil || len(chapters) != 2 {
+		t.Fatalf("unexpected chapters: %#v %v", chapters, err)
+	}
+	if m := chapters[1]["metrics"].(map[string]any); chapters[1]["chapter"] != "II" || m["word_count"] != 3.0 {
+		t.Fatalf("unexpected chapter II metrics: %#v", chapters[1])
+	}
+}
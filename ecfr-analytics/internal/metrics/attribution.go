@@ -0,0 +1,228 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"ecfr-analytics/internal/store"
+)
+
+// Attribution modes decide how a chapter referenced by several agencies is
+// counted towards each one's word_count and restriction_count.
+const (
+	// AttributionFull gives every referencing agency the whole chapter.
+	AttributionFull = "full"
+	// AttributionSplit divides the chapter evenly between its agencies.
+	AttributionSplit = "split"
+	// AttributionPrimary gives the chapter to one agency, its primary owner.
+	AttributionPrimary = "primary"
+)
+
+var attribution = AttributionFull
+
+// SetAttribution changes the attribution mode. Call it before any
+// computation starts; stored values follow the new mode from the next
+// refresh.
+func SetAttribution(mode string) error {
+	if !ValidAttribution(mode) {
+		return fmt.Errorf("invalid attribution %q (want %s, %s or %s)", mode, AttributionFull, AttributionSplit, AttributionPrimary)
+	}
+	attribution = mode
+	return nil
+}
+
+func Attribution() string { return attribution }
+
+func ValidAttribution(mode string) bool {
+	return mode == AttributionFull || mode == AttributionSplit || mode == AttributionPrimary
+}
+
+// Reference specificities, most specific last. The primary owner of a chapter
+// is the agency that names it most specifically.
+const (
+	specTitle = iota
+	specSubtitle
+	specChapter
+)
+
+type chapterOwner struct {
+	Slug  string
+	Name  string
+	Depth int
+	Spec  int
+}
+
+// chapterOwners lists the agencies whose own references cover each chapter,
+// keyed by refKey, primary owner first.
+type chapterOwners map[string][]chapterOwner
+
+// buildChapterOwners resolves every agency's own references against the
+// snapshots in titleDates. Titles that fail to load are left out; computeAgency
+// reports them.
+func buildChapterOwners(ctx context.Context, cache *chapterStatsCache, agencies []agencyRecord, titleDates map[int]string) chapterOwners {
+	owners := chapterOwners{}
+	for _, a := range agencies {
+		spec := map[string]int{}
+		var keys []string
+		for _, ref := range a.Raw.CFRReferences {
+			td := titleDates[ref.Title]
+			if td == "" {
+				continue
+			}
+			chMap, err := cache.get(ctx, ref.Title, td)
+			if err != nil {
+				continue
+			}
+			s := specTitle
+			switch {
+			case ref.Chapter != "":
+				s = specChapter
+			case ref.Subtitle != "":
+				s = specSubtitle
+			}
+			for _, ch := range resolveRef(ref, chMap) {
+				k := refKey(ref.Title, ch)
+				old, ok := spec[k]
+				if !ok {
+					keys = append(keys, k)
+				}
+				if !ok || s > old {
+					spec[k] = s
+				}
+			}
+		}
+		for _, k := range keys {
+			owners[k] = append(owners[k], chapterOwner{Slug: a.Slug, Name: a.Name, Depth: a.Depth, Spec: spec[k]})
+		}
+	}
+	// Prefer the most specific reference, then the most specific agency (a
+	// bureau over its department), then the slug for a stable order.
+	for _, list := range owners {
+		sort.SliceStable(list, func(i, j int) bool {
+			if list[i].Spec != list[j].Spec {
+				return list[i].Spec > list[j].Spec
+			}
+			if list[i].Depth != list[j].Depth {
+				return list[i].Depth > list[j].Depth
+			}
+			return list[i].Slug < list[j].Slug
+		})
+	}
+	return owners
+}
+
+// share is the fraction of a chapter attributed to the agencies in slugs
+// together under mode: 1 under AttributionFull if any of them references it.
+func (o chapterOwners) share(mode string, title int, chapter string, slugs map[string]bool) float64 {
+	list := o[refKey(title, chapter)]
+	n := 0
+	for _, ow := range list {
+		if slugs[ow.Slug] {
+			n++
+		}
+	}
+	switch {
+	case n == 0:
+		return 0
+	case mode == AttributionSplit:
+		return float64(n) / float64(len(list))
+	case mode == AttributionPrimary:
+		if slugs[list[0].Slug] {
+			return 1
+		}
+		return 0
+	}
+	return 1
+}
+
+type ChapterAgency struct {
+	Slug    string  `json:"slug"`
+	Name    string  `json:"name"`
+	Share   float64 `json:"share"`
+	Primary bool    `json:"primary"`
+}
+
+type SharedChapter struct {
+	Title    int             `json:"title"`
+	Chapter  string          `json:"chapter"`
+	Date     string          `json:"date"`
+	Words    int             `json:"words"`
+	Agencies []ChapterAgency `json:"agencies"`
+}
+
+// AttributionTotals reconciles summed agency word counts with the CFR.
+// CFRWords = ReferencedWords + UnreferencedWords, and AttributedWords is what
+// the agencies' own word_count values add up to under Mode.
+type AttributionTotals struct {
+	CFRWords          int     `json:"cfr_words"`
+	ReferencedWords   int     `json:"referenced_words"`
+	UnreferencedWords int     `json:"unreferenced_words"`
+	SharedWords       int     `json:"shared_words"`
+	AttributedWords   float64 `json:"attributed_words"`
+}
+
+type ChapterAttribution struct {
+	Mode     string            `json:"mode"`
+	Totals   AttributionTotals `json:"totals"`
+	Chapters []SharedChapter   `json:"chapters"`
+}
+
+// SharedChapters lists the current chapters referenced by more than one
+// agency (every referenced chapter if all is set) with each agency's share
+// under the current attribution mode, ordered by title and chapter. Totals
+// always cover the whole CFR.
+func SharedChapters(ctx context.Context, st *store.Store, all bool) (*ChapterAttribution, error) {
+	agencies, err := loadAgencies(ctx, st)
+	if err != nil {
+		return nil, err
+	}
+	titles, err := loadTitles(ctx, st)
+	if err != nil {
+		return nil, err
+	}
+	titleDates := currentTitleDates(titles)
+	cache := newChapterStatsCache(st)
+	owners := buildChapterOwners(ctx, cache, agencies, titleDates)
+
+	out := &ChapterAttribution{Mode: attribution, Chapters: []SharedChapter{}}
+	sort.Slice(titles, func(i, j int) bool { return titles[i].Number < titles[j].Number })
+	for _, t := range titles {
+		td := titleDates[t.Number]
+		if td == "" {
+			continue
+		}
+		chMap, err := cache.get(ctx, t.Number, td)
+		if err != nil {
+			continue
+		}
+		keys := make([]string, 0, len(chMap))
+		for k := range chMap {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			words := chMap[k].Words
+			out.Totals.CFRWords += words
+			list := owners[refKey(t.Number, k)]
+			if len(list) == 0 {
+				out.Totals.UnreferencedWords += words
+				continue
+			}
+			out.Totals.ReferencedWords += words
+			if len(list) > 1 {
+				out.Totals.SharedWords += words
+			}
+			sc := SharedChapter{Title: t.Number, Chapter: k, Date: td, Words: words}
+			for i, ow := range list {
+				s := owners.share(attribution, t.Number, k, map[string]bool{ow.Slug: true})
+				out.Totals.AttributedWords += s * float64(words)
+				sc.Agencies = append(sc.Agencies, ChapterAgency{Slug: ow.Slug, Name: ow.Name, Share: s, Primary: i == 0})
+			}
+			if all || len(list) > 1 {
+				out.Chapters = append(out.Chapters, sc)
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"ecfr-analytics/internal/ecfr"
+	"ecfr-analytics/internal/store"
+)
+
+func TestAttributionModes(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+	t.Cleanup(func() { _ = SetAttribution(AttributionFull) })
+
+	agencies := []ecfr.Agency{
+		{
+			Name:          "Department",
+			Slug:          "department",
+			CFRReferences: []ecfr.CFRRef{{Title: 1}},
+			Children: []ecfr.Agency{
+				{Name: "Bureau", Slug: "bureau", CFRReferences: []ecfr.CFRRef{{Title: 1, Chapter: "I"}}},
+			},
+		},
+		{Name: "Other", Slug: "other", CFRReferences: []ecfr.CFRRef{{Title: 1, Chapter: "I"}}},
+	}
+	if err := st.UpsertAgencies(ctx, agencies); err != nil {
+		t.Fatalf("upsert agencies: %v", err)
+	}
+	if err := st.UpsertTitles(ctx, []ecfr.Title{
+		{Number: 1, Name: "Title 1", UpToDateAsOf: "2025-01-02"},
+		{Number: 2, Name: "Title 2", UpToDateAsOf: "2025-01-02"},
+	}); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	// Chapter I (6 words) is referenced by all three agencies, chapter II (2
+	// words) only by the department's whole-title reference, and title 2
+	// (1 word) by nobody.
+	xml1 := []byte(`<ROOT><DIV1 TYPE="CHAPTER" N="I"><P>One two three four five six.</P></DIV1><DIV1 TYPE="CHAPTER" N="II"><P>Seven eight.</P></DIV1></ROOT>`)
+	xml2 := []byte(`<ROOT><DIV1 TYPE="CHAPTER" N="I"><P>Nine.</P></DIV1></ROOT>`)
+	for n, xml := range map[int][]byte{1: xml1, 2: xml2} {
+		if err := st.SaveSnapshotFromReader(ctx, n, "2025-01-02", bytes.NewReader(xml)); err != nil {
+			t.Fatalf("save snapshot %d: %v", n, err)
+		}
+	}
+
+	words := func(scope string) map[string]float64 {
+		t.Helper()
+		rows, err := st.LatestAgencyMetric(ctx, "word_count", scope)
+		if err != nil {
+			t.Fatalf("latest %s: %v", scope, err)
+		}
+		out := map[string]float64{}
+		for _, r := range rows {
+			out[r["slug"].(string)] = r["value"].(float64)
+		}
+		return out
+	}
+
+	cases := []struct {
+		mode       string
+		own        map[string]float64
+		rollup     float64
+		attributed float64
+	}{
+		{AttributionFull, map[string]float64{"department": 8, "bureau": 6, "other": 6}, 8, 20},
+		{AttributionSplit, map[string]float64{"department": 4, "bureau": 2, "other": 2}, 6, 8},
+		// The bureau and other both name chapter I; the bureau wins as the
+		// deeper agency. The department keeps chapter II.
+		{AttributionPrimary, map[string]float64{"department": 2, "bureau": 6, "other": 0}, 8, 8},
+	}
+	for _, tc := range cases {
+		if err := SetAttribution(tc.mode); err != nil {
+			t.Fatalf("set attribution: %v", err)
+		}
+		if _, err := st.DB().ExecContext(ctx, `DELETE FROM agency_metrics`); err != nil {
+			t.Fatalf("clear metrics: %v", err)
+		}
+		report, err := ComputeLatest(ctx, st)
+		if err != nil {
+			t.Fatalf("%s: compute: %v", tc.mode, err)
+		}
+		got := words(store.ScopeOwn)
+		if len(got) != len(tc.own) {
+			t.Fatalf("%s: unexpected own word counts: %v", tc.mode, got)
+		}
+		for slug, want := range tc.own {
+			if got[slug] != want {
+				t.Fatalf("%s: %s = %v, want %v (%v)", tc.mode, slug, got[slug], want, got)
+			}
+		}
+		if r := words(store.ScopeRollup)["department"]; r != tc.rollup {
+			t.Fatalf("%s: department rollup = %v, want %v", tc.mode, r, tc.rollup)
+		}
+
+		shared, err := SharedChapters(ctx, st, false)
+		if err != nil {
+			t.Fatalf("%s: shared chapters: %v", tc.mode, err)
+		}
+		tot := shared.Totals
+		if tot.CFRWords != 9 || tot.ReferencedWords != 8 || tot.UnreferencedWords != 1 || tot.SharedWords != 6 || tot.AttributedWords != tc.attributed {
+			t.Fatalf("%s: unexpected totals: %#v", tc.mode, tot)
+		}
+		if len(shared.Chapters) != 1 || shared.Chapters[0].Chapter != "I" || len(shared.Chapters[0].Agencies) != 3 {
+			t.Fatalf("%s: unexpected shared chapters: %#v", tc.mode, shared.Chapters)
+		}
+		if a := shared.Chapters[0].Agencies[0]; a.Slug != "bureau" || !a.Primary {
+			t.Fatalf("%s: unexpected primary owner: %#v", tc.mode, a)
+		}
+		if tc.mode == AttributionPrimary {
+			var other AgencyReport
+			for _, ar := range report.Agencies {
+				if ar.Slug == "other" {
+					other = ar
+				}
+			}
+			if other.Status != StatusOK || report.Attribution != AttributionPrimary {
+				t.Fatalf("unexpected report for other: %#v", other)
+			}
+			// Attribution weighs word counts only; other keeps its
+			// chapter's remaining metrics.
+			rows, err := st.LatestAgencyMetric(ctx, "words_per_chapter", store.ScopeOwn)
+			if err != nil {
+				t.Fatalf("latest words per chapter: %v", err)
+			}
+			found := false
+			for _, r := range rows {
+				if r["slug"] == "other" {
+					found = r["value"].(float64) == 6 && r["attribution"] == AttributionPrimary
+				}
+			}
+			if !found {
+				t.Fatalf("expected words per chapter for other: %v", rows)
+			}
+		}
+	}
+
+	all, err := SharedChapters(ctx, st, true)
+	if err != nil || len(all.Chapters) != 2 {
+		t.Fatalf("all chapters: %#v %v", all, err)
+	}
+	if err := SetAttribution("bogus"); err == nil {
+		t.Fatalf("expected invalid mode to fail")
+	}
+}
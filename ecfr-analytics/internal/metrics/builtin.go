@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"strings"
+
+	"ecfr-analytics/internal/ecfr"
+)
+
+func init() {
+	Register(NewMetric(MetricInfo{
+		Name:        "word_count",
+		Label:       "Word count",
+		Unit:        "words",
+		Kind:        KindNumber,
+		Description: "Words in the agency's referenced chapters, with shared chapters counted by the attribution mode.",
+	}, func(a *AgencyText) Value {
+		return Number(a.AttributedWords())
+	}))
+	Register(NewMetric(MetricInfo{
+		Name:        "words_per_chapter",
+		Label:       "Words per chapter",
+		Unit:        "words",
+		Kind:        KindNumber,
+		Description: "Word count divided by the number of distinct referenced chapters.",
+	}, func(a *AgencyText) Value {
+		return Number(float64(a.Words()) / float64(max(1, a.DistinctChapters())))
+	}))
+	Register(NewMetric(MetricInfo{
+		Name:        "content_checksum",
+		Label:       "Checksum",
+		Unit:        "sha256",
+		Kind:        KindText,
+		Description: "SHA-256 over the referenced chapter checksums, in reference order; changes whenever any referenced text changes.",
+	}, func(a *AgencyText) Value {
+		sums := make([]string, 0, len(a.Chapters))
+		for _, c := range a.Chapters {
+			sums = append(sums, c.Stats.Checksum)
+		}
+		return Text(ecfr.ChecksumHex(strings.Join(sums, "")))
+	}))
+	Register(NewMetric(MetricInfo{
+		Name:        "readability",
+		Label:       "Readability",
+		Unit:        "score",
+		Kind:        KindNumber,
+		Description: "Flesch Reading Ease; higher is easier to read.",
+	}, func(a *AgencyText) Value {
+		return Number(ecfr.FleschReadingEaseCounts(a.Words(), a.Sentences(), a.Syllables()))
+	}))
+	Register(NewMetric(MetricInfo{
+		Name:        "flesch_kincaid_grade",
+		Label:       "Flesch–Kincaid grade",
+		Unit:        "grade",
+		Kind:        KindNumber,
+		Description: "Flesch–Kincaid grade level; the US school grade needed to follow the text.",
+	}, func(a *AgencyText) Value {
+		return Number(ecfr.FleschKincaidGradeCounts(a.Words(), a.Sentences(), a.Syllables()))
+	}))
+	Register(NewMetric(MetricInfo{
+		Name:        "gunning_fog",
+		Label:       "Gunning fog",
+		Unit:        "grade",
+		Kind:        KindNumber,
+		Description: "Gunning fog index, counting words of three or more syllables as complex.",
+	}, func(a *AgencyText) Value {
+		return Number(ecfr.GunningFogCounts(a.Words(), a.Sentences(), a.Polysyllables()))
+	}))
+	Register(NewMetric(MetricInfo{
+		Name:        "smog",
+		Label:       "SMOG grade",
+		Unit:        "grade",
+		Kind:        KindNumber,
+		Description: "SMOG grade from the rate of words with three or more syllables.",
+	}, func(a *AgencyText) Value {
+		return Number(ecfr.SMOGCounts(a.Sentences(), a.Polysyllables()))
+	}))
+	Register(NewMetric(MetricInfo{
+		Name:        "coleman_liau",
+		Label:       "Coleman–Liau",
+		Unit:        "grade",
+		Kind:        KindNumber,
+		Description: "Coleman–Liau index, from letters and sentences per 100 words.",
+	}, func(a *AgencyText) Value {
+		return Number(ecfr.ColemanLiauCounts(a.Letters(), a.Words(), a.Sentences()))
+	}))
+	Register(NewMetric(MetricInfo{
+		Name:        "automated_readability_index",
+		Label:       "Automated Readability Index",
+		Unit:        "grade",
+		Kind:        KindNumber,
+		Description: "Automated Readability Index, from characters per word and words per sentence.",
+	}, func(a *AgencyText) Value {
+		return Number(ecfr.AutomatedReadabilityIndexCounts(a.Letters(), a.Words(), a.Sentences()))
+	}))
+	Register(NewMetric(MetricInfo{
+		Name:        "churn",
+		Label:       "Churn rate",
+		Unit:        "ratio",
+		Kind:        KindNumber,
+		Description: "Share of referenced chapters whose text changed since the previous snapshot.",
+	}, func(a *AgencyText) Value {
+		return Number(a.Churn)
+	}))
+	Register(NewMetric(MetricInfo{
+		Name:        "restriction_count",
+		Label:       "Restrictions",
+		Unit:        "count",
+		Kind:        KindNumber,
+		Description: "Occurrences of restrictive terms such as \"shall\", \"must\" and \"may not\", with shared chapters counted by the attribution mode.",
+	}, func(a *AgencyText) Value {
+		return Number(a.AttributedRestrictions())
+	}))
+	Register(NewMetric(MetricInfo{
+		Name:        "restrictions_per_1k_words",
+		Label:       "Restrictions per 1k words",
+		Unit:        "per 1k words",
+		Kind:        KindNumber,
+		Description: "Restriction count per 1,000 words.",
+	}, func(a *AgencyText) Value {
+		return Number(per1kWords(a.Restrictions(), a.Words()))
+	}))
+	Register(NewMetric(MetricInfo{
+		Name:        "median_section_age",
+		Label:       "Median section age",
+		Unit:        "years",
+		Kind:        KindNumber,
+		Description: "Median years since each section in the referenced chapters was last amended, from the eCFR's version history and the sections' source citations. Backfilled snapshots are dated from the citations alone, so a series may mix the two.",
+	}, func(a *AgencyText) Value {
+		return sectionAgePercentile(a, 50)
+	}))
+	Register(NewMetric(MetricInfo{
+		Name:        "p90_section_age",
+		Label:       "90th percentile section age",
+		Unit:        "years",
+		Kind:        KindNumber,
+		Description: "Years since last amendment that 90% of the referenced sections are newer than; high values mean a long tail of untouched provisions. Dated like median_section_age.",
+	}, func(a *AgencyText) Value {
+		return sectionAgePercentile(a, 90)
+	}))
+}
+
+// sectionAgePercentile has no value for text without dated sections.
+func sectionAgePercentile(a *AgencyText, p float64) Value {
+	ages := a.SectionAges()
+	if len(ages) == 0 {
+		return Value{}
+	}
+	return Number(percentile(ages, p))
+}
@@ -2,188 +2,365 @@ package metrics
 
 import (
 	"context"
-	"encoding/json"
+	"database/sql"
+	"errors"
 	"fmt"
 	"sort"
+	"strings"
 
 	"ecfr-analytics/internal/ecfr"
 	"ecfr-analytics/internal/store"
 )
 
 type agencyRecord struct {
-	Slug string
-	Name string
-	Raw  ecfr.Agency
+	Slug   string
+	Name   string
+	Parent string
+	// Depth is 0 for top-level agencies, 1 for their sub-agencies and so on.
+	Depth int
+	Raw   ecfr.Agency
 }
 
+// rollup returns a with the CFR references of all its sub-agencies merged
+// into its own, each reference once.
+func (a agencyRecord) rollup() agencyRecord {
+	seen := map[string]bool{}
+	var refs []ecfr.CFRRef
+	var walk func(n ecfr.Agency)
+	walk = func(n ecfr.Agency) {
+		for _, r := range n.CFRReferences {
+			k := refKey(r.Title, r.Chapter) + ":" + r.Subtitle
+			if !seen[k] {
+				seen[k] = true
+				refs = append(refs, r)
+			}
+		}
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(a.Raw)
+	a.Raw.CFRReferences = refs
+	return a
+}
+
+// slugs is the set of a's slug and those of all its sub-agencies.
+func (a agencyRecord) slugs() map[string]bool {
+	out := map[string]bool{}
+	var walk func(n ecfr.Agency)
+	walk = func(n ecfr.Agency) {
+		out[n.Slug] = true
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(a.Raw)
+	return out
+}
+
+var errNoSnapshot = errors.New("snapshot not downloaded")
+
 type titleKey struct {
 	Title int
 	Date  string
 }
 
-func ComputeLatest(ctx context.Context, st *store.Store) error {
+func ComputeLatest(ctx context.Context, st *store.Store) (*Report, error) {
 	titles, err := loadTitles(ctx, st)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	titleDates := currentTitleDates(titles)
 	return computeWithTitleDates(ctx, st, titles, titleDates)
 }
 
-func computeWithTitleDates(ctx context.Context, st *store.Store, titles []ecfr.Title, titleDates map[int]string) error {
+func ComputeAsOf(ctx context.Context, st *store.Store, date string) (*Report, error) {
+	titles, err := loadTitles(ctx, st)
+	if err != nil {
+		return nil, err
+	}
+	return computeWithTitleDates(ctx, st, titles, titleDatesAsOf(ctx, st, titles, date))
+}
+
+func titleDatesAsOf(ctx context.Context, st *store.Store, titles []ecfr.Title, date string) map[int]string {
+	titleDates := make(map[int]string, len(titles))
+	for _, t := range titles {
+		if t.Reserved {
+			continue
+		}
+		if d, ok := st.SnapshotDateOnOrBefore(ctx, t.Number, date); ok {
+			titleDates[t.Number] = d
+		}
+	}
+	return titleDates
+}
+
+func computeWithTitleDates(ctx context.Context, st *store.Store, titles []ecfr.Title, titleDates map[int]string) (*Report, error) {
 	agencies, err := loadAgencies(ctx, st)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	titleChapterText := map[titleKey]map[string]string{}
+	mode := attribution
+	report := &Report{TextProfile: st.TextProfile().String(), Attribution: mode}
+	cache := newChapterStatsCache(st)
+	partCache := newPartStatsCache(st)
+	ages := newAmendmentCache(st, true)
 
+	var cfr []AgencyChapter
+	titles = append([]ecfr.Title(nil), titles...)
+	sort.Slice(titles, func(i, j int) bool { return titles[i].Number < titles[j].Number })
 	for _, t := range titles {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if t.Reserved {
+			report.addTitle(t.Number, "", StatusSkipped, "reserved")
 			continue
 		}
 		date := titleDates[t.Number]
 		if date == "" {
+			report.addTitle(t.Number, "", StatusSkipped, "no snapshot for date")
 			continue
 		}
-		k := titleKey{Title: t.Number, Date: date}
-		xmlBytes, err := st.ReadSnapshotXML(ctx, t.Number, date)
+		chapters, err := computeTitle(ctx, st, cache, partCache, ages, t.Number, date)
 		if err != nil {
+			status := StatusFailed
+			if errors.Is(err, errNoSnapshot) {
+				status = StatusSkipped
+			}
+			report.addTitle(t.Number, date, status, err.Error())
 			continue
 		}
-		chText, err := ecfr.ParseTitleChapters(xmlBytes)
-		if err != nil {
+		cfr = append(cfr, chapters...)
+		report.addTitle(t.Number, date, StatusOK, "")
+	}
+	if err := computeCFR(ctx, st, cache, cfr); err != nil {
+		report.addTitle(store.WholeCFR, "", StatusFailed, err.Error())
+	}
+
+	owners := buildChapterOwners(ctx, cache, agencies, titleDates)
+	for _, a := range agencies {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		ownShare := func(title int, chapter string) float64 {
+			return owners.share(mode, title, chapter, map[string]bool{a.Slug: true})
+		}
+		slugs := a.slugs()
+		rollupShare := func(title int, chapter string) float64 {
+			return owners.share(mode, title, chapter, slugs)
+		}
+		own := computeAgency(ctx, st, cache, partCache, ages, a, store.ScopeOwn, mode, titleDates, ownShare)
+		report.addUnresolved(a, own.unresolved)
+		if len(a.Raw.Children) == 0 {
+			// A rollup of no sub-agencies is the agency's own values, which
+			// the store serves for it.
+			report.addAgency(a, own.date, own.status, own.reason)
 			continue
 		}
-		titleChapterText[k] = chText
+		rollup := computeAgency(ctx, st, cache, partCache, ages, a.rollup(), store.ScopeRollup, mode, titleDates, rollupShare)
+		switch {
+		case own.status == StatusSkipped && rollup.status == StatusOK:
+			report.addAgency(a, rollup.date, StatusOK, "no own text; rollup only")
+		case own.status == StatusOK && rollup.status == StatusFailed:
+			report.addAgency(a, own.date, StatusPartial, "rollup: "+rollup.reason)
+		default:
+			report.addAgency(a, own.date, own.status, own.reason)
+		}
 	}
 
-	for _, a := range agencies {
-		var allText string
-		chapterChecksums := []string{}
-		chapterSet := map[string]bool{}
+	return report, nil
+}
 
-		for _, ref := range a.Raw.CFRReferences {
-			if ref.Chapter == "" {
-				continue
-			}
-			td := titleDates[ref.Title]
-			if td == "" {
-				continue
-			}
-			k := titleKey{Title: ref.Title, Date: td}
-			chMap := titleChapterText[k]
-			if chMap == nil {
+type agencyResult struct {
+	date       string
+	status     string
+	reason     string
+	unresolved []UnresolvedRef
+}
+
+// computeAgency computes and stores every registered metric for a's CFR
+// references under scope. share gives the fraction of each referenced chapter
+// attributed to a under mode; it weighs only the attributed metrics, so a
+// chapter attributed elsewhere still counts towards the others.
+func computeAgency(
+	ctx context.Context,
+	st *store.Store,
+	cache *chapterStatsCache,
+	partCache *partStatsCache,
+	ages *amendmentCache,
+	a agencyRecord,
+	scope, mode string,
+	titleDates map[int]string,
+	share func(title int, chapter string) float64,
+) agencyResult {
+	date := newestReferencedDateFromMap(a, titleDates)
+	text := &AgencyText{Slug: a.Slug, Name: a.Name, Date: date}
+	res := agencyResult{date: date}
+	var failedTitles []string
+
+	seen := map[string]bool{}
+	for _, ref := range a.Raw.CFRReferences {
+		td := titleDates[ref.Title]
+		if td == "" {
+			res.unresolved = append(res.unresolved, unresolvedRef(ref, "no snapshot of title"))
+			continue
+		}
+		chMap, err := cache.get(ctx, ref.Title, td)
+		if err != nil {
+			failedTitles = append(failedTitles, fmt.Sprintf("title %d", ref.Title))
+			continue
+		}
+		keys := resolveRef(ref, chMap)
+		if len(keys) == 0 {
+			res.unresolved = append(res.unresolved, unresolvedRef(ref, "not in title snapshot "+td))
+			continue
+		}
+		parts, err := partCache.get(ctx, ref.Title, td)
+		if err != nil {
+			failedTitles = append(failedTitles, fmt.Sprintf("title %d", ref.Title))
+			continue
+		}
+		for _, k := range keys {
+			if seen[refKey(ref.Title, k)] {
 				continue
 			}
-			txt := chMap[ref.Chapter]
-			if txt == "" {
-				continue
+			seen[refKey(ref.Title, k)] = true
+			amended, _, err := ages.chapter(ctx, ref.Title, td, k)
+			if err != nil {
+				failedTitles = append(failedTitles, fmt.Sprintf("title %d (section ages)", ref.Title))
 			}
-			allText += txt + " "
-			chapterChecksums = append(chapterChecksums, ecfr.ChecksumHex(txt))
-			chapterSet[refKey(ref.Title, ref.Chapter)] = true
+			text.Chapters = append(text.Chapters, AgencyChapter{
+				Title: ref.Title, Chapter: k, Date: td, Stats: chMap[k], Parts: parts, Share: share(ref.Title, k),
+				Amended: lastAmended(amended),
+			})
 		}
-
-		if allText == "" {
-			continue
+	}
+	failedTitles = uniqueStrings(failedTitles)
+
+	if len(text.Chapters) == 0 {
+		switch {
+		case len(failedTitles) > 0:
+			res.status, res.reason = StatusFailed, "referenced titles failed: "+strings.Join(failedTitles, ", ")
+		case len(a.Raw.CFRReferences) == 0:
+			res.status, res.reason = StatusSkipped, "no CFR references"
+		default:
+			res.status, res.reason = StatusSkipped, "no text for referenced chapters"
 		}
+		return res
+	}
 
-		wc := float64(ecfr.WordCount(allText))
-
-		denom := len(chapterSet)
-		if denom == 0 {
-			denom = 1
+	text.Churn = computeChurnBestEffort(ctx, st, cache, text.Chapters)
+	for _, m := range registry {
+		name := m.Info().Name
+		v := m.Compute(text)
+		if err := st.PutAgencyMetric(ctx, a.Slug, date, name, scope, mode, v.Num, v.Text); err != nil {
+			res.status, res.reason = StatusFailed, fmt.Sprintf("store %s: %v", name, err)
+			return res
 		}
-		wordsPerChapter := wc / float64(denom)
-
-		sum := ecfr.ChecksumHex(allText)
-
-		fre := ecfr.FleschReadingEase(allText)
-
-		churn := computeChurnBestEffort(ctx, st, a, titleDates)
+	}
+	res.status = StatusOK
+	if len(failedTitles) > 0 {
+		res.reason = "partial; referenced titles failed: " + strings.Join(failedTitles, ", ")
+	}
+	return res
+}
 
-		date := newestReferencedDateFromMap(a, titleDates)
+// resolveRef lists the keys of chMap that ref covers, sorted: its chapter,
+// everything in its subtitle, or for a whole-title reference everything.
+func resolveRef(ref ecfr.CFRRef, chMap map[string]ecfr.ChapterStats) []string {
+	var keys []string
+	for k, cs := range chMap {
+		if ref.Covers(ref.Title, cs.Subtitle, k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
 
-		_ = st.PutAgencyMetric(ctx, a.Slug, date, "word_count", &wc, nil)
-		_ = st.PutAgencyMetric(ctx, a.Slug, date, "words_per_chapter", &wordsPerChapter, nil)
-		_ = st.PutAgencyMetric(ctx, a.Slug, date, "checksum", nil, &sum)
-		_ = st.PutAgencyMetric(ctx, a.Slug, date, "readability", &fre, nil)
-		_ = st.PutAgencyMetric(ctx, a.Slug, date, "churn", &churn, nil)
+// chapterStatsCache loads each title snapshot's chapter summaries at most once
+// per computation. Snapshots saved before chapter_content existed are scanned
+// from disk and indexed on first use. Failures are cached too.
+type chapterStatsCache struct {
+	st   *store.Store
+	m    map[titleKey]map[string]ecfr.ChapterStats
+	errs map[titleKey]error
+}
 
-		_ = chapterChecksums
+func newChapterStatsCache(st *store.Store) *chapterStatsCache {
+	return &chapterStatsCache{
+		st:   st,
+		m:    map[titleKey]map[string]ecfr.ChapterStats{},
+		errs: map[titleKey]error{},
 	}
-
-	return nil
 }
 
-func computeChurnBestEffort(
-	ctx context.Context,
-	st *store.Store,
-	a agencyRecord,
-	titleDates map[int]string,
-) float64 {
-	type pair struct {
-		title   int
-		chapter string
+func (c *chapterStatsCache) get(ctx context.Context, title int, date string) (map[string]ecfr.ChapterStats, error) {
+	k := titleKey{Title: title, Date: date}
+	if err, ok := c.errs[k]; ok {
+		return nil, err
 	}
-	var refs []pair
-	for _, r := range a.Raw.CFRReferences {
-		if r.Chapter != "" {
-			refs = append(refs, pair{r.Title, r.Chapter})
-		}
+	if chMap, ok := c.m[k]; ok {
+		return chMap, nil
 	}
-	if len(refs) == 0 {
-		return 0
+	chMap, err := c.load(ctx, title, date)
+	if err != nil {
+		c.errs[k] = err
+		return nil, err
 	}
+	c.m[k] = chMap
+	return chMap, nil
+}
 
-	changed := 0
-	total := 0
+func (c *chapterStatsCache) load(ctx context.Context, title int, date string) (map[string]ecfr.ChapterStats, error) {
+	chMap, ok, err := c.st.ChapterContent(ctx, title, date)
+	if err != nil {
+		return nil, fmt.Errorf("load chapter content: %w", err)
+	}
+	if ok {
+		return chMap, nil
+	}
+	chMap, _, err = indexSnapshot(ctx, c.st, title, date)
+	return chMap, err
+}
 
-	m := map[int][]string{}
-	for _, p := range refs {
-		m[p.title] = append(m[p.title], p.chapter)
+// indexSnapshot summarizes a snapshot missing from the store's content
+// caches, counting its chapters and parts in one pass.
+func indexSnapshot(ctx context.Context, st *store.Store, title int, date string) (map[string]ecfr.ChapterStats, []ecfr.PartStats, error) {
+	chMap, parts, err := st.IndexSnapshotContent(ctx, title, date)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, errNoSnapshot
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("index snapshot content: %w", err)
 	}
+	return chMap, parts, nil
+}
 
-	for title, chapters := range m {
-		curDate := titleDates[title]
-		if curDate == "" {
-			continue
-		}
-		prevDate, ok := st.PreviousSnapshotDate(ctx, title, curDate)
+// computeChurnBestEffort is the share of chapters whose checksum differs from
+// the title's previous snapshot, over chapters present in both.
+func computeChurnBestEffort(ctx context.Context, st *store.Store, cache *chapterStatsCache, chapters []AgencyChapter) float64 {
+	changed, total := 0, 0
+	for _, c := range chapters {
+		prevDate, ok := st.PreviousSnapshotDate(ctx, c.Title, c.Date)
 		if !ok {
 			continue
 		}
-		curXML, err := st.ReadSnapshotXML(ctx, title, curDate)
+		prevCh, err := cache.get(ctx, c.Title, prevDate)
 		if err != nil {
 			continue
 		}
-		prevXML, err := st.ReadSnapshotXML(ctx, title, prevDate)
-		if err != nil {
-			continue
-		}
-		curCh, err := ecfr.ParseTitleChapters(curXML)
-		if err != nil {
-			continue
-		}
-		prevCh, err := ecfr.ParseTitleChapters(prevXML)
-		if err != nil {
+		pt, ok := prevCh[c.Chapter]
+		if !ok {
 			continue
 		}
-
-		for _, ch := range uniqueStrings(chapters) {
-			ct := curCh[ch]
-			pt := prevCh[ch]
-			if ct == "" || pt == "" {
-				continue
-			}
-			total++
-			if ecfr.ChecksumHex(ct) != ecfr.ChecksumHex(pt) {
-				changed++
-			}
+		total++
+		if c.Stats.Checksum != pt.Checksum {
+			changed++
 		}
 	}
-
 	if total == 0 {
 		return 0
 	}
@@ -191,43 +368,30 @@ func computeChurnBestEffort(
 }
 
 func loadAgencies(ctx context.Context, st *store.Store) ([]agencyRecord, error) {
-	rows, err := st.DB().QueryContext(ctx, `SELECT slug, name, json FROM agencies`)
+	roots, err := st.RootAgencies(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-	var out []agencyRecord
-	for rows.Next() {
-		var slug, name, raw string
-		if err := rows.Scan(&slug, &name, &raw); err != nil {
-			return nil, err
-		}
-		var a ecfr.Agency
-		_ = json.Unmarshal([]byte(raw), &a)
-		out = append(out, agencyRecord{Slug: slug, Name: name, Raw: a})
-	}
-	return flattenAgencyTree(out), nil
+	return flattenAgencyTree(roots), nil
 }
 
-func flattenAgencyTree(in []agencyRecord) []agencyRecord {
+// flattenAgencyTree lists every agency in the tree once, by name. Each record
+// keeps its subtree in Raw.Children for roll-ups.
+func flattenAgencyTree(roots []ecfr.Agency) []agencyRecord {
+	seen := map[string]bool{}
 	var out []agencyRecord
-	var walk func(a ecfr.Agency)
-	walk = func(a ecfr.Agency) {
-		out = append(out, agencyRecord{Slug: a.Slug, Name: a.Name, Raw: a})
+	var walk func(a ecfr.Agency, parent string, depth int)
+	walk = func(a ecfr.Agency, parent string, depth int) {
+		if !seen[a.Slug] {
+			seen[a.Slug] = true
+			out = append(out, agencyRecord{Slug: a.Slug, Name: a.Name, Parent: parent, Depth: depth, Raw: a})
+		}
 		for _, c := range a.Children {
-			walk(c)
+			walk(c, a.Slug, depth+1)
 		}
 	}
-	for _, r := range in {
-		walk(r.Raw)
-	}
-	seen := map[string]agencyRecord{}
-	for _, r := range out {
-		seen[r.Slug] = r
-	}
-	out = out[:0]
-	for _, r := range seen {
-		out = append(out, r)
+	for _, a := range roots {
+		walk(a, "", 0)
 	}
 	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
 	return out
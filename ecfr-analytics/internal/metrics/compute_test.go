@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -61,11 +62,11 @@ func TestComputeLatest(t *testing.T) {
 		t.Fatalf("save cur snapshot: %v", err)
 	}
 
-	if err := ComputeLatest(ctx, st); err != nil {
+	if _, err := ComputeLatest(ctx, st); err != nil {
 		t.Fatalf("compute latest: %v", err)
 	}
 
-	rows, err := st.LatestAgencyMetric(ctx, "churn")
+	rows, err := st.LatestAgencyMetric(ctx, "churn", store.ScopeOwn)
 	if err != nil {
 		t.Fatalf("latest churn: %v", err)
 	}
@@ -75,6 +76,219 @@ func TestComputeLatest(t *testing.T) {
 	if rows[0]["value"].(float64) != 1.0 {
 		t.Fatalf("expected churn=1.0, got %v", rows[0]["value"])
 	}
+
+	// "Alpha gamma.": 2 words, 1 sentence, 4 syllables, no polysyllables, 10 letters.
+	grades := map[string]float64{
+		"flesch_kincaid_grade":        ecfr.FleschKincaidGradeCounts(2, 1, 4),
+		"gunning_fog":                 ecfr.GunningFogCounts(2, 1, 0),
+		"smog":                        ecfr.SMOGCounts(1, 0),
+		"coleman_liau":                ecfr.ColemanLiauCounts(10, 2, 1),
+		"automated_readability_index": ecfr.AutomatedReadabilityIndexCounts(10, 2, 1),
+	}
+	for metric, want := range grades {
+		rows, err := st.LatestAgencyMetric(ctx, metric, store.ScopeOwn)
+		if err != nil || len(rows) != 1 || rows[0]["value"].(float64) != want {
+			t.Fatalf("%s: got %v %v, want %v", metric, rows, err, want)
+		}
+	}
+}
+
+func TestComputeStopsWhenCancelled(t *testing.T) {
+	st := newTestStore(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := st.UpsertTitles(context.Background(), []ecfr.Title{{Number: 1, Name: "Title 1", UpToDateAsOf: "2025-01-02"}}); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	if _, err := ComputeLatest(ctx, st); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancelled compute, got %v", err)
+	}
+}
+
+func TestComputeLatestIndexesUnindexedSnapshots(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	agency := ecfr.Agency{Name: "Agency One", Slug: "agency-one", CFRReferences: []ecfr.CFRRef{{Title: 1, Chapter: "I"}}}
+	if err := st.UpsertAgencies(ctx, []ecfr.Agency{agency}); err != nil {
+		t.Fatalf("upsert agencies: %v", err)
+	}
+	if err := st.UpsertTitles(ctx, []ecfr.Title{{Number: 1, Name: "Title 1", UpToDateAsOf: "2025-01-02"}}); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	xml := []byte(`<ROOT><DIV1 TYPE="CHAPTER" N="I"><P>Alpha beta gamma.</P></DIV1></ROOT>`)
+	if err := st.SaveSnapshotFromReader(ctx, 1, "2025-01-02", bytes.NewReader(xml)); err != nil {
+		t.Fatalf("save snapshot: %v", err)
+	}
+	for _, table := range []string{"chapter_content", "content_indexed"} {
+		if _, err := st.DB().ExecContext(ctx, `DELETE FROM `+table); err != nil {
+			t.Fatalf("clear %s: %v", table, err)
+		}
+	}
+
+	if _, err := ComputeLatest(ctx, st); err != nil {
+		t.Fatalf("compute latest: %v", err)
+	}
+	rows, err := st.LatestAgencyMetric(ctx, "word_count", store.ScopeOwn)
+	if err != nil {
+		t.Fatalf("latest word count: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["value"].(float64) != 3 {
+		t.Fatalf("unexpected word count rows: %#v", rows)
+	}
+	chapters, _, err := st.ChapterContent(ctx, 1, "2025-01-02")
+	if err != nil {
+		t.Fatalf("chapter content: %v", err)
+	}
+	if len(chapters) != 1 {
+		t.Fatalf("expected snapshot to be re-indexed, got %#v", chapters)
+	}
+}
+
+func TestComputeAsOf(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	agency := ecfr.Agency{
+		Name:          "Agency One",
+		Slug:          "agency-one",
+		CFRReferences: []ecfr.CFRRef{{Title: 1, Chapter: "I"}},
+	}
+	if err := st.UpsertAgencies(ctx, []ecfr.Agency{agency}); err != nil {
+		t.Fatalf("upsert agencies: %v", err)
+	}
+	title := ecfr.Title{Number: 1, Name: "Title 1", UpToDateAsOf: "2025-03-01", Reserved: false}
+	if err := st.UpsertTitles(ctx, []ecfr.Title{title}); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	snapshots := map[string]string{
+		"2025-01-01": `<ROOT><DIV1 TYPE="CHAPTER" N="I"><P>Alpha beta.</P></DIV1></ROOT>`,
+		"2025-02-01": `<ROOT><DIV1 TYPE="CHAPTER" N="I"><P>Alpha beta gamma.</P></DIV1></ROOT>`,
+	}
+	for d, x := range snapshots {
+		if err := st.SaveSnapshotFromReader(ctx, 1, d, bytes.NewReader([]byte(x))); err != nil {
+			t.Fatalf("save snapshot %s: %v", d, err)
+		}
+	}
+
+	for _, d := range []string{"2025-01-15", "2025-02-15"} {
+		if _, err := ComputeAsOf(ctx, st, d); err != nil {
+			t.Fatalf("compute as of %s: %v", d, err)
+		}
+	}
+
+	rows, err := st.AgencyMetricSeriesRange(ctx, "agency-one", "word_count", store.SeriesRange{})
+	if err != nil {
+		t.Fatalf("series: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 points, got %#v", rows)
+	}
+	if rows[0]["date"] != "2025-01-01" || rows[0]["value"].(float64) != 2 {
+		t.Fatalf("unexpected first point: %#v", rows[0])
+	}
+	if rows[1]["date"] != "2025-02-01" || rows[1]["value"].(float64) != 3 {
+		t.Fatalf("unexpected second point: %#v", rows[1])
+	}
+}
+
+func TestComputeRollup(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	parent := ecfr.Agency{
+		Name:          "Department",
+		Slug:          "department",
+		CFRReferences: []ecfr.CFRRef{{Title: 1, Chapter: "I"}},
+		Children: []ecfr.Agency{
+			{Name: "Bureau", Slug: "bureau", CFRReferences: []ecfr.CFRRef{{Title: 1, Chapter: "I"}, {Title: 1, Chapter: "II"}}},
+			{Name: "Office", Slug: "office"},
+		},
+	}
+	if err := st.UpsertAgencies(ctx, []ecfr.Agency{parent}); err != nil {
+		t.Fatalf("upsert agencies: %v", err)
+	}
+	if err := st.UpsertTitles(ctx, []ecfr.Title{{Number: 1, Name: "Title 1", UpToDateAsOf: "2025-01-02"}}); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	xml := []byte(`<ROOT><DIV1 TYPE="CHAPTER" N="I"><P>One two.</P></DIV1><DIV1 TYPE="CHAPTER" N="II"><P>Three four five.</P></DIV1></ROOT>`)
+	if err := st.SaveSnapshotFromReader(ctx, 1, "2025-01-02", bytes.NewReader(xml)); err != nil {
+		t.Fatalf("save snapshot: %v", err)
+	}
+	report, err := ComputeLatest(ctx, st)
+	if err != nil {
+		t.Fatalf("compute latest: %v", err)
+	}
+	if report.Summary.AgenciesOK != 2 || report.Summary.AgenciesSkipped != 1 {
+		t.Fatalf("unexpected summary: %#v", report.Summary)
+	}
+
+	words := func(scope string) map[string]float64 {
+		t.Helper()
+		rows, err := st.LatestAgencyMetric(ctx, "word_count", scope)
+		if err != nil {
+			t.Fatalf("latest %s: %v", scope, err)
+		}
+		out := map[string]float64{}
+		for _, r := range rows {
+			out[r["slug"].(string)] = r["value"].(float64)
+		}
+		return out
+	}
+	if got := words(store.ScopeOwn); got["department"] != 2 || got["bureau"] != 5 || len(got) != 2 {
+		t.Fatalf("unexpected own word counts: %v", got)
+	}
+	// Chapter I is referenced by both the department and the bureau but
+	// counted once.
+	if got := words(store.ScopeRollup); got["department"] != 5 || got["bureau"] != 5 {
+		t.Fatalf("unexpected rollup word counts: %v", got)
+	}
+}
+
+func TestComputeSubtitleAndTitleReferences(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	agencies := []ecfr.Agency{
+		{Name: "Subtitle A", Slug: "subtitle-a", CFRReferences: []ecfr.CFRRef{{Title: 1, Subtitle: "A"}}},
+		{Name: "Whole Title", Slug: "whole-title", CFRReferences: []ecfr.CFRRef{{Title: 1}, {Title: 1, Chapter: "II"}}},
+		{Name: "Missing Subtitle", Slug: "missing-subtitle", CFRReferences: []ecfr.CFRRef{{Title: 1, Subtitle: "Z"}}},
+	}
+	if err := st.UpsertAgencies(ctx, agencies); err != nil {
+		t.Fatalf("upsert agencies: %v", err)
+	}
+	if err := st.UpsertTitles(ctx, []ecfr.Title{{Number: 1, Name: "Title 1", UpToDateAsOf: "2025-01-02"}}); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	xml := []byte(`<ROOT>
+<DIV2 TYPE="SUBTITLE" N="A"><DIV5 TYPE="PART" N="1"><P>One.</P></DIV5><DIV3 TYPE="CHAPTER" N="I"><P>Two three.</P></DIV3></DIV2>
+<DIV2 TYPE="SUBTITLE" N="B"><DIV3 TYPE="CHAPTER" N="II"><P>Four five six.</P></DIV3></DIV2>
+</ROOT>`)
+	if err := st.SaveSnapshotFromReader(ctx, 1, "2025-01-02", bytes.NewReader(xml)); err != nil {
+		t.Fatalf("save snapshot: %v", err)
+	}
+	report, err := ComputeLatest(ctx, st)
+	if err != nil {
+		t.Fatalf("compute latest: %v", err)
+	}
+
+	rows, err := st.LatestAgencyMetric(ctx, "word_count", store.ScopeOwn)
+	if err != nil {
+		t.Fatalf("latest word_count: %v", err)
+	}
+	got := map[string]float64{}
+	for _, r := range rows {
+		got[r["slug"].(string)] = r["value"].(float64)
+	}
+	// The whole-title agency's chapter II reference is already covered by its
+	// title reference and counted once.
+	if got["subtitle-a"] != 3 || got["whole-title"] != 6 || len(got) != 2 {
+		t.Fatalf("unexpected word counts: %v", got)
+	}
+	if len(report.Unresolved) != 1 || report.Unresolved[0].Slug != "missing-subtitle" || report.Unresolved[0].References[0].Subtitle != "Z" {
+		t.Fatalf("unexpected unresolved: %#v", report.Unresolved)
+	}
 }
 
 func TestHelpers(t *testing.T) {
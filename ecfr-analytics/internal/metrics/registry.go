@@ -0,0 +1,216 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+
+	"ecfr-analytics/internal/ecfr"
+)
+
+const (
+	KindNumber = "number"
+	KindText   = "text"
+)
+
+// MetricInfo describes a metric for the /api/metrics catalog.
+type MetricInfo struct {
+	Name        string `json:"name"`
+	Label       string `json:"label"`
+	Unit        string `json:"unit,omitempty"`
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+}
+
+// Value is a metric result; at most one of Num and Text is set, matching the
+// metric's Kind. Neither is set if the text gives the metric no value.
+type Value struct {
+	Num  *float64
+	Text *string
+}
+
+func Number(v float64) Value { return Value{Num: &v} }
+
+func Text(s string) Value { return Value{Text: &s} }
+
+// Metric computes one value from a body of text: an agency's referenced
+// chapters, or a whole title, one chapter or the whole CFR.
+type Metric interface {
+	Info() MetricInfo
+	Compute(a *AgencyText) Value
+}
+
+// AgencyText is what a Metric sees of one agency at one date: the summaries of
+// every chapter it references that has text and is attributed to it, in
+// reference order. Title, chapter and CFR-wide metrics see every chapter in
+// title and chapter order, with an empty Slug.
+type AgencyText struct {
+	Slug     string
+	Name     string
+	Date     string
+	Chapters []AgencyChapter
+	// Churn is the share of referenced chapters whose text changed since
+	// each title's previous snapshot.
+	Churn float64
+}
+
+type AgencyChapter struct {
+	Title   int
+	Chapter string
+	Date    string
+	Stats   ecfr.ChapterStats
+	Parts   []ecfr.PartStats
+	// Share is the fraction of the chapter attributed to the agency under
+	// the attribution mode, in [0, 1]. Only AttributedWords and
+	// AttributedRestrictions weigh chapters by it.
+	Share float64
+	// Amended is when each dated section of the chapter was last amended.
+	Amended []string
+}
+
+func (a *AgencyText) Words() int {
+	n := 0
+	for _, c := range a.Chapters {
+		n += c.Stats.Words
+	}
+	return n
+}
+
+// AttributedWords is Words with each chapter weighted by its Share, so that
+// summing it over agencies counts a shared chapter once unless the
+// attribution mode is AttributionFull.
+func (a *AgencyText) AttributedWords() float64 {
+	n := 0.0
+	for _, c := range a.Chapters {
+		n += float64(c.Stats.Words) * c.Share
+	}
+	return n
+}
+
+func (a *AgencyText) Sentences() int {
+	n := 0
+	for _, c := range a.Chapters {
+		n += c.Stats.Sentences
+	}
+	return n
+}
+
+func (a *AgencyText) Syllables() int {
+	n := 0
+	for _, c := range a.Chapters {
+		n += c.Stats.Syllables
+	}
+	return n
+}
+
+func (a *AgencyText) Polysyllables() int {
+	n := 0
+	for _, c := range a.Chapters {
+		n += c.Stats.Polysyllables
+	}
+	return n
+}
+
+func (a *AgencyText) Letters() int {
+	n := 0
+	for _, c := range a.Chapters {
+		n += c.Stats.Letters
+	}
+	return n
+}
+
+func (a *AgencyText) Restrictions() int {
+	n := 0
+	for _, c := range a.Chapters {
+		n += chapterRestrictions(c.Parts, c.Chapter)
+	}
+	return n
+}
+
+// AttributedRestrictions is Restrictions weighted like AttributedWords.
+func (a *AgencyText) AttributedRestrictions() float64 {
+	n := 0.0
+	for _, c := range a.Chapters {
+		n += float64(chapterRestrictions(c.Parts, c.Chapter)) * c.Share
+	}
+	return n
+}
+
+// SectionAges is the age in years of every dated section, as of its
+// chapter's snapshot, ascending. Repeated chapters count once.
+func (a *AgencyText) SectionAges() []float64 {
+	var ages []float64
+	seen := map[string]bool{}
+	for _, c := range a.Chapters {
+		if seen[refKey(c.Title, c.Chapter)] {
+			continue
+		}
+		seen[refKey(c.Title, c.Chapter)] = true
+		for _, d := range c.Amended {
+			if age, ok := ageYears(d, c.Date); ok {
+				ages = append(ages, age)
+			}
+		}
+	}
+	sort.Float64s(ages)
+	return ages
+}
+
+// DistinctChapters counts referenced chapters, ignoring repeated references.
+func (a *AgencyText) DistinctChapters() int {
+	seen := map[string]bool{}
+	for _, c := range a.Chapters {
+		seen[refKey(c.Title, c.Chapter)] = true
+	}
+	return len(seen)
+}
+
+type funcMetric struct {
+	info MetricInfo
+	fn   func(a *AgencyText) Value
+}
+
+func (m funcMetric) Info() MetricInfo { return m.info }
+
+func (m funcMetric) Compute(a *AgencyText) Value { return m.fn(a) }
+
+// NewMetric adapts a function to the Metric interface.
+func NewMetric(info MetricInfo, fn func(a *AgencyText) Value) Metric {
+	return funcMetric{info: info, fn: fn}
+}
+
+var (
+	registry []Metric
+	byName   = map[string]Metric{}
+)
+
+// Register adds m to the metrics computed for every agency. Metrics are
+// computed and listed in registration order. It panics on a duplicate or
+// malformed metric, so call it from init.
+func Register(m Metric) {
+	info := m.Info()
+	if info.Name == "" || (info.Kind != KindNumber && info.Kind != KindText) {
+		panic(fmt.Sprintf("metrics: invalid metric %+v", info))
+	}
+	if _, dup := byName[info.Name]; dup {
+		panic("metrics: duplicate metric " + info.Name)
+	}
+	registry = append(registry, m)
+	byName[info.Name] = m
+}
+
+func Registered() []Metric {
+	return append([]Metric(nil), registry...)
+}
+
+func Lookup(name string) (Metric, bool) {
+	m, ok := byName[name]
+	return m, ok
+}
+
+func Catalog() []MetricInfo {
+	out := make([]MetricInfo, 0, len(registry))
+	for _, m := range registry {
+		out = append(out, m.Info())
+	}
+	return out
+}
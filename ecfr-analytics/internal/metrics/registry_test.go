@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"ecfr-analytics/internal/ecfr"
+	"ecfr-analytics/internal/store"
+)
+
+func TestCatalog(t *testing.T) {
+	want := []string{"word_count", "words_per_chapter", "content_checksum", "readability",
+		"flesch_kincaid_grade", "gunning_fog", "smog", "coleman_liau", "automated_readability_index",
+		"churn", "restriction_count", "restrictions_per_1k_words"}
+	cat := Catalog()
+	if len(cat) < len(want) {
+		t.Fatalf("catalog too short: %#v", cat)
+	}
+	for i, name := range want {
+		if cat[i].Name != name || cat[i].Label == "" || cat[i].Description == "" {
+			t.Fatalf("catalog[%d] = %#v, want %s", i, cat[i], name)
+		}
+	}
+	if m, ok := Lookup("content_checksum"); !ok || m.Info().Kind != KindText {
+		t.Fatalf("content_checksum should be a text metric")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected duplicate registration to panic")
+		}
+	}()
+	Register(NewMetric(MetricInfo{Name: "word_count", Kind: KindNumber}, nil))
+}
+
+func TestRegisteredMetricIsComputed(t *testing.T) {
+	saved, savedByName := registry, byName
+	t.Cleanup(func() { registry, byName = saved, savedByName })
+	registry = append([]Metric(nil), registry...)
+	byName = map[string]Metric{}
+	for k, v := range savedByName {
+		byName[k] = v
+	}
+	Register(NewMetric(MetricInfo{Name: "chapter_refs", Label: "Chapters", Kind: KindNumber, Description: "test"}, func(a *AgencyText) Value {
+		return Number(float64(len(a.Chapters)))
+	}))
+
+	st := newTestStore(t)
+	ctx := context.Background()
+	agency := ecfr.Agency{Name: "Agency One", Slug: "agency-one", CFRReferences: []ecfr.CFRRef{{Title: 1, Chapter: "I"}, {Title: 1, Chapter: "II"}}}
+	if err := st.UpsertAgencies(ctx, []ecfr.Agency{agency}); err != nil {
+		t.Fatalf("upsert agencies: %v", err)
+	}
+	if err := st.UpsertTitles(ctx, []ecfr.Title{{Number: 1, Name: "Title 1", UpToDateAsOf: "2025-01-02"}}); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	xml := []byte(`<ROOT><DIV1 TYPE="CHAPTER" N="I"><P>One.</P></DIV1><DIV1 TYPE="CHAPTER" N="II"><P>Two.</P></DIV1></ROOT>`)
+	if err := st.SaveSnapshotFromReader(ctx, 1, "2025-01-02", bytes.NewReader(xml)); err != nil {
+		t.Fatalf("save snapshot: %v", err)
+	}
+	if _, err := ComputeLatest(ctx, st); err != nil {
+		t.Fatalf("compute latest: %v", err)
+	}
+	rows, err := st.LatestAgencyMetric(ctx, "chapter_refs", store.ScopeOwn)
+	if err != nil || len(rows) != 1 || rows[0]["value"].(float64) != 2 {
+		t.Fatalf("unexpected custom metric rows: %v %v", rows, err)
+	}
+}
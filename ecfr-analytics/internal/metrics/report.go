@@ -0,0 +1,107 @@
+package metrics
+
+import "ecfr-analytics/internal/ecfr"
+
+const (
+	StatusOK      = "ok"
+	StatusSkipped = "skipped"
+	StatusFailed  = "failed"
+	// StatusPartial marks an agency whose own metrics were stored but whose
+	// rollup failed.
+	StatusPartial = "partial"
+)
+
+// Report records what happened to every title and agency during one metric
+// computation, so a missing agency can be traced to its cause. TextProfile and
+// Attribution are the text profile and attribution mode the values were
+// computed with.
+type Report struct {
+	TextProfile string         `json:"text_profile"`
+	Attribution string         `json:"attribution"`
+	Titles      []TitleReport  `json:"titles"`
+	Agencies    []AgencyReport `json:"agencies"`
+	// Unresolved lists agencies with CFR references that matched no text.
+	Unresolved []UnresolvedAgency `json:"unresolved"`
+	Summary    ReportSummary      `json:"summary"`
+}
+
+// TitleReport is the outcome for one title. Title is store.WholeCFR for the
+// CFR-wide totals, which are reported only when they fail.
+type TitleReport struct {
+	Title  int    `json:"title"`
+	Date   string `json:"date,omitempty"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type AgencyReport struct {
+	Slug   string `json:"slug"`
+	Name   string `json:"name"`
+	Date   string `json:"date,omitempty"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type UnresolvedAgency struct {
+	Slug       string          `json:"slug"`
+	Name       string          `json:"name"`
+	References []UnresolvedRef `json:"references"`
+}
+
+type UnresolvedRef struct {
+	Title    int    `json:"title"`
+	Subtitle string `json:"subtitle,omitempty"`
+	Chapter  string `json:"chapter,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+func unresolvedRef(ref ecfr.CFRRef, reason string) UnresolvedRef {
+	return UnresolvedRef{Title: ref.Title, Subtitle: ref.Subtitle, Chapter: ref.Chapter, Reason: reason}
+}
+
+type ReportSummary struct {
+	TitlesOK        int `json:"titles_ok"`
+	TitlesSkipped   int `json:"titles_skipped"`
+	TitlesFailed    int `json:"titles_failed"`
+	AgenciesOK      int `json:"agencies_ok"`
+	AgenciesSkipped int `json:"agencies_skipped"`
+	AgenciesFailed  int `json:"agencies_failed"`
+	AgenciesPartial int `json:"agencies_partial"`
+	// AgenciesUnresolved counts agencies with at least one unresolved
+	// reference, whatever their status.
+	AgenciesUnresolved int `json:"agencies_unresolved"`
+}
+
+func (r *Report) addTitle(title int, date, status, reason string) {
+	r.Titles = append(r.Titles, TitleReport{Title: title, Date: date, Status: status, Reason: reason})
+	switch status {
+	case StatusOK:
+		r.Summary.TitlesOK++
+	case StatusSkipped:
+		r.Summary.TitlesSkipped++
+	case StatusFailed:
+		r.Summary.TitlesFailed++
+	}
+}
+
+func (r *Report) addAgency(a agencyRecord, date, status, reason string) {
+	r.Agencies = append(r.Agencies, AgencyReport{Slug: a.Slug, Name: a.Name, Date: date, Status: status, Reason: reason})
+	switch status {
+	case StatusOK:
+		r.Summary.AgenciesOK++
+	case StatusSkipped:
+		r.Summary.AgenciesSkipped++
+	case StatusFailed:
+		r.Summary.AgenciesFailed++
+	case StatusPartial:
+		r.Summary.AgenciesPartial++
+	}
+}
+
+func (r *Report) addUnresolved(a agencyRecord, refs []UnresolvedRef) {
+	if len(refs) == 0 {
+		return
+	}
+	r.Unresolved = append(r.Unresolved, UnresolvedAgency{Slug: a.Slug, Name: a.Name, References: refs})
+	r.Summary.AgenciesUnresolved++
+}
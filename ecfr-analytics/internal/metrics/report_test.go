@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ecfr-analytics/internal/ecfr"
+)
+
+func TestComputeReport(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	agencies := []ecfr.Agency{
+		{Name: "Has Text", Slug: "has-text", CFRReferences: []ecfr.CFRRef{{Title: 1, Chapter: "I"}}},
+		{Name: "Whole Title", Slug: "whole-title", CFRReferences: []ecfr.CFRRef{{Title: 1}}},
+		{Name: "No References", Slug: "no-references"},
+		{Name: "Empty Chapter", Slug: "empty-chapter", CFRReferences: []ecfr.CFRRef{{Title: 1, Chapter: "IX"}}},
+		{Name: "Broken Title", Slug: "broken-title", CFRReferences: []ecfr.CFRRef{{Title: 2, Chapter: "I"}}},
+	}
+	if err := st.UpsertAgencies(ctx, agencies); err != nil {
+		t.Fatalf("upsert agencies: %v", err)
+	}
+	titles := []ecfr.Title{
+		{Number: 1, Name: "Title 1", UpToDateAsOf: "2025-01-02"},
+		{Number: 2, Name: "Title 2", UpToDateAsOf: "2025-01-02"},
+		{Number: 3, Name: "Title 3", UpToDateAsOf: "2025-01-02"},
+		{Number: 4, Name: "Title 4", Reserved: true},
+	}
+	if err := st.UpsertTitles(ctx, titles); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	xml := []byte(`<ROOT><DIV1 TYPE="CHAPTER" N="I"><P>Alpha beta.</P></DIV1></ROOT>`)
+	for _, n := range []int{1, 2} {
+		if err := st.SaveSnapshotFromReader(ctx, n, "2025-01-02", bytes.NewReader(xml)); err != nil {
+			t.Fatalf("save snapshot %d: %v", n, err)
+		}
+	}
+	// Corrupt title 2 on disk and drop its index so compute has to re-read it.
+	if err := os.WriteFile(filepath.Join(st.DataDir(), "xml", "title-2_2025-01-02.xml.gz"), []byte("not gzip"), 0o644); err != nil {
+		t.Fatalf("corrupt snapshot: %v", err)
+	}
+	for _, table := range []string{"chapter_content", "content_indexed"} {
+		if _, err := st.DB().ExecContext(ctx, `DELETE FROM `+table+` WHERE title_number=2`); err != nil {
+			t.Fatalf("clear %s: %v", table, err)
+		}
+	}
+
+	report, err := ComputeLatest(ctx, st)
+	if err != nil {
+		t.Fatalf("compute latest: %v", err)
+	}
+
+	titleStatus := map[int]string{}
+	for _, tr := range report.Titles {
+		titleStatus[tr.Title] = tr.Status
+	}
+	want := map[int]string{1: StatusOK, 2: StatusFailed, 3: StatusSkipped, 4: StatusSkipped}
+	for n, s := range want {
+		if titleStatus[n] != s {
+			t.Fatalf("title %d: expected %s, got %s (%#v)", n, s, titleStatus[n], report.Titles)
+		}
+	}
+
+	agencyStatus := map[string]AgencyReport{}
+	for _, ar := range report.Agencies {
+		agencyStatus[ar.Slug] = ar
+	}
+	if agencyStatus["has-text"].Status != StatusOK {
+		t.Fatalf("unexpected has-text report: %#v", agencyStatus["has-text"])
+	}
+	if r := agencyStatus["whole-title"]; r.Status != StatusOK {
+		t.Fatalf("unexpected whole-title report: %#v", r)
+	}
+	if r := agencyStatus["no-references"]; r.Status != StatusSkipped || r.Reason != "no CFR references" {
+		t.Fatalf("unexpected no-references report: %#v", r)
+	}
+	if r := agencyStatus["empty-chapter"]; r.Status != StatusSkipped || r.Reason != "no text for referenced chapters" {
+		t.Fatalf("unexpected empty-chapter report: %#v", r)
+	}
+	if r := agencyStatus["broken-title"]; r.Status != StatusFailed {
+		t.Fatalf("unexpected broken-title report: %#v", r)
+	}
+	if report.Summary.AgenciesOK != 2 || report.Summary.AgenciesSkipped != 2 || report.Summary.AgenciesFailed != 1 {
+		t.Fatalf("unexpected summary: %#v", report.Summary)
+	}
+	if report.Summary.AgenciesUnresolved != 1 || len(report.Unresolved) != 1 || report.Unresolved[0].Slug != "empty-chapter" {
+		t.Fatalf("unexpected unresolved: %#v", report.Unresolved)
+	}
+	if ref := report.Unresolved[0].References[0]; ref.Title != 1 || ref.Chapter != "IX" {
+		t.Fatalf("unexpected unresolved reference: %#v", ref)
+	}
+}
@@ -0,0 +1,163 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"ecfr-analytics/internal/ecfr"
+	"ecfr-analytics/internal/store"
+)
+
+// partStatsCache is chapterStatsCache for part-level restriction counts,
+// made with the store's restriction terms.
+type partStatsCache struct {
+	st   *store.Store
+	m    map[titleKey][]ecfr.PartStats
+	errs map[titleKey]error
+}
+
+func newPartStatsCache(st *store.Store) *partStatsCache {
+	return &partStatsCache{
+		st:   st,
+		m:    map[titleKey][]ecfr.PartStats{},
+		errs: map[titleKey]error{},
+	}
+}
+
+func (c *partStatsCache) get(ctx context.Context, title int, date string) ([]ecfr.PartStats, error) {
+	k := titleKey{Title: title, Date: date}
+	if err, ok := c.errs[k]; ok {
+		return nil, err
+	}
+	if parts, ok := c.m[k]; ok {
+		return parts, nil
+	}
+	parts, err := c.load(ctx, title, date)
+	if err != nil {
+		c.errs[k] = err
+		return nil, err
+	}
+	c.m[k] = parts
+	return parts, nil
+}
+
+func (c *partStatsCache) load(ctx context.Context, title int, date string) ([]ecfr.PartStats, error) {
+	parts, ok, err := c.st.PartContent(ctx, title, date)
+	if err != nil {
+		return nil, fmt.Errorf("load part content: %w", err)
+	}
+	if ok {
+		return parts, nil
+	}
+	_, parts, err = indexSnapshot(ctx, c.st, title, date)
+	return parts, err
+}
+
+// chapterRestrictions sums restriction counts over the parts of one chapter.
+func chapterRestrictions(parts []ecfr.PartStats, chapter string) int {
+	n := 0
+	for _, p := range parts {
+		if p.Chapter == chapter {
+			n += p.Restrictions
+		}
+	}
+	return n
+}
+
+func per1kWords(count, words int) float64 {
+	if words == 0 {
+		return 0
+	}
+	return float64(count) * 1000 / float64(words)
+}
+
+type PartRestrictions struct {
+	Title           int     `json:"title"`
+	Chapter         string  `json:"chapter"`
+	Part            string  `json:"part"`
+	Date            string  `json:"date"`
+	Words           int     `json:"words"`
+	Restrictions    int     `json:"restriction_count"`
+	RestrictionsPer float64 `json:"restrictions_per_1k_words"`
+}
+
+// AgencyPartRestrictions breaks an agency's restriction count down by part,
+// most restrictive first, resolving references as computeAgency does. date selects each title's snapshot on or before it;
+// empty means the current snapshots.
+func AgencyPartRestrictions(ctx context.Context, st *store.Store, slug, date string) ([]PartRestrictions, error) {
+	agencies, err := loadAgencies(ctx, st)
+	if err != nil {
+		return nil, err
+	}
+	var agency *agencyRecord
+	for i := range agencies {
+		if agencies[i].Slug == slug {
+			agency = &agencies[i]
+			break
+		}
+	}
+	if agency == nil {
+		return nil, fmt.Errorf("%w: %s", store.ErrUnknownAgency, slug)
+	}
+
+	titles, err := loadTitles(ctx, st)
+	if err != nil {
+		return nil, err
+	}
+	titleDates := currentTitleDates(titles)
+	if date != "" {
+		titleDates = titleDatesAsOf(ctx, st, titles, date)
+	}
+
+	chapters := newChapterStatsCache(st)
+	cache := newPartStatsCache(st)
+	out := []PartRestrictions{}
+	seen := map[string]bool{}
+	for _, ref := range agency.Raw.CFRReferences {
+		td := titleDates[ref.Title]
+		if td == "" {
+			continue
+		}
+		chMap, err := chapters.get(ctx, ref.Title, td)
+		if errors.Is(err, errNoSnapshot) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("title %d: %w", ref.Title, err)
+		}
+		var keys []string
+		for _, k := range resolveRef(ref, chMap) {
+			if !seen[refKey(ref.Title, k)] {
+				seen[refKey(ref.Title, k)] = true
+				keys = append(keys, k)
+			}
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		parts, err := cache.get(ctx, ref.Title, td)
+		if err != nil {
+			return nil, fmt.Errorf("title %d: %w", ref.Title, err)
+		}
+		for _, k := range keys {
+			for _, p := range parts {
+				if p.Chapter != k {
+					continue
+				}
+				out = append(out, PartRestrictions{
+					Title:           ref.Title,
+					Chapter:         p.Chapter,
+					Part:            p.Part,
+					Date:            td,
+					Words:           p.Words,
+					Restrictions:    p.Restrictions,
+					RestrictionsPer: per1kWords(p.Restrictions, p.Words),
+				})
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Restrictions > out[j].Restrictions })
+	return out, nil
+}
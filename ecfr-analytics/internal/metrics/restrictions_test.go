@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"ecfr-analytics/internal/ecfr"
+	"ecfr-analytics/internal/store"
+)
+
+func TestRestrictionMetrics(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	agency := ecfr.Agency{Name: "Agency One", Slug: "agency-one", CFRReferences: []ecfr.CFRRef{{Title: 1, Chapter: "I"}}}
+	if err := st.UpsertAgencies(ctx, []ecfr.Agency{agency}); err != nil {
+		t.Fatalf("upsert agencies: %v", err)
+	}
+	if err := st.UpsertTitles(ctx, []ecfr.Title{{Number: 1, Name: "Title 1", UpToDateAsOf: "2025-01-02"}}); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	xml := []byte(`<ROOT><DIV1 TYPE="CHAPTER" N="I">
+<DIV5 TYPE="PART" N="1"><P>You shall file and must pay. You may not appeal.</P></DIV5>
+<DIV5 TYPE="PART" N="2"><P>Applicants should consider a filing.</P></DIV5>
+</DIV1><DIV1 TYPE="CHAPTER" N="II"><P>Everything is required.</P></DIV1></ROOT>`)
+	if err := st.SaveSnapshotFromReader(ctx, 1, "2025-01-02", bytes.NewReader(xml)); err != nil {
+		t.Fatalf("save snapshot: %v", err)
+	}
+	if parts, ok, err := st.PartContent(ctx, 1, "2025-01-02"); err != nil || !ok || len(parts) != 3 {
+		t.Fatalf("expected the save to count parts: %#v %v %v", parts, ok, err)
+	}
+
+	latest := func(metric string) float64 {
+		t.Helper()
+		rows, err := st.LatestAgencyMetric(ctx, metric, store.ScopeOwn)
+		if err != nil || len(rows) != 1 {
+			t.Fatalf("latest %s: %v %v", metric, rows, err)
+		}
+		return rows[0]["value"].(float64)
+	}
+
+	if _, err := ComputeLatest(ctx, st); err != nil {
+		t.Fatalf("compute latest: %v", err)
+	}
+	if got := latest("restriction_count"); got != 3 {
+		t.Fatalf("expected 3 restrictions, got %v", got)
+	}
+	if got, want := latest("restrictions_per_1k_words"), 3*1000/latest("word_count"); got != want {
+		t.Fatalf("restrictions_per_1k_words = %v, want %v", got, want)
+	}
+
+	parts, err := AgencyPartRestrictions(ctx, st, "agency-one", "")
+	if err != nil {
+		t.Fatalf("agency parts: %v", err)
+	}
+	if len(parts) != 2 || parts[0].Part != "1" || parts[0].Restrictions != 3 || parts[1].Restrictions != 0 {
+		t.Fatalf("unexpected part breakdown: %#v", parts)
+	}
+	if _, err := AgencyPartRestrictions(ctx, st, "missing", ""); !errors.Is(err, store.ErrUnknownAgency) {
+		t.Fatalf("expected ErrUnknownAgency, got %v", err)
+	}
+
+	st.SetRestrictionTerms([]string{"should"})
+	if _, err := ComputeLatest(ctx, st); err != nil {
+		t.Fatalf("recompute: %v", err)
+	}
+	if got := latest("restriction_count"); got != 1 {
+		t.Fatalf("expected changed terms to rescan, got %v", got)
+	}
+}
+
+func TestAgencyPartRestrictionsSubtitle(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	agency := ecfr.Agency{Name: "Agency One", Slug: "agency-one", CFRReferences: []ecfr.CFRRef{{Title: 1, Subtitle: "A"}}}
+	if err := st.UpsertAgencies(ctx, []ecfr.Agency{agency}); err != nil {
+		t.Fatalf("upsert agencies: %v", err)
+	}
+	if err := st.UpsertTitles(ctx, []ecfr.Title{{Number: 1, Name: "Title 1", UpToDateAsOf: "2025-01-02"}}); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	xml := []byte(`<ROOT><DIV1 TYPE="TITLE" N="1">
+<DIV2 TYPE="SUBTITLE" N="A">
+<DIV5 TYPE="PART" N="1"><P>You shall file.</P></DIV5>
+<DIV3 TYPE="CHAPTER" N="I"><DIV5 TYPE="PART" N="2"><P>You must pay and may not appeal.</P></DIV5></DIV3>
+</DIV2>
+<DIV2 TYPE="SUBTITLE" N="B"><DIV3 TYPE="CHAPTER" N="II"><DIV5 TYPE="PART" N="3"><P>Everything is required.</P></DIV5></DIV3></DIV2>
+</DIV1></ROOT>`)
+	if err := st.SaveSnapshotFromReader(ctx, 1, "2025-01-02", bytes.NewReader(xml)); err != nil {
+		t.Fatalf("save snapshot: %v", err)
+	}
+	if _, err := ComputeLatest(ctx, st); err != nil {
+		t.Fatalf("compute latest: %v", err)
+	}
+	rows, err := st.LatestAgencyMetric(ctx, "restriction_count", store.ScopeOwn)
+	if err != nil || len(rows) != 1 || rows[0]["value"].(float64) != 3 {
+		t.Fatalf("expected 3 restrictions in subtitle A: %v %v", rows, err)
+	}
+
+	parts, err := AgencyPartRestrictions(ctx, st, "agency-one", "")
+	if err != nil {
+		t.Fatalf("agency parts: %v", err)
+	}
+	if len(parts) != 2 || parts[0].Part != "2" || parts[0].Restrictions != 2 || parts[1].Part != "1" || parts[1].Chapter != "SUBTITLE A" {
+		t.Fatalf("expected the parts of subtitle A to add up to its count: %#v", parts)
+	}
+}
@@ -0,0 +1,267 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// WholeCFR is the title number under which title_metrics keeps the CFR-wide
+// totals. Its date is the newest title snapshot included.
+const WholeCFR = 0
+
+const aggregatesDDL = `
+CREATE TABLE IF NOT EXISTS title_metrics (
+  title_number INTEGER NOT NULL,
+  issue_date TEXT NOT NULL,
+  metric TEXT NOT NULL,
+  value_num REAL,
+  value_text TEXT,
+  created_at TEXT NOT NULL,
+  text_profile TEXT NOT NULL DEFAULT '',
+  PRIMARY KEY(title_number, issue_date, metric)
+);
+
+CREATE TABLE IF NOT EXISTS chapter_metrics (
+  title_number INTEGER NOT NULL,
+  issue_date TEXT NOT NULL,
+  chapter TEXT NOT NULL,
+  metric TEXT NOT NULL,
+  value_num REAL,
+  value_text TEXT,
+  created_at TEXT NOT NULL,
+  text_profile TEXT NOT NULL DEFAULT '',
+  position INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY(title_number, issue_date, chapter, metric),
+  FOREIGN KEY(title_number) REFERENCES titles(number)
+);
+`
+
+// MetricValue is one computed metric; exactly one of Num and Text is set.
+type MetricValue struct {
+	Metric string
+	Num    *float64
+	Text   *string
+}
+
+// PutTitleMetrics stores a title's (or WholeCFR's) metrics for one snapshot
+// date, replacing all earlier values of that date, with the store's text
+// profile.
+func (s *Store) PutTitleMetrics(ctx context.Context, title int, date string, vals []MetricValue) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM title_metrics WHERE title_number=? AND issue_date=?`, title, date); err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, `
+INSERT INTO title_metrics(title_number, issue_date, metric, value_num, value_text, created_at, text_profile)
+VALUES(?,?,?,?,?,?,?)
+`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	now := time.Now().Format(time.RFC3339)
+	for _, v := range vals {
+		if _, err := stmt.ExecContext(ctx, title, date, v.Metric, v.Num, v.Text, now, s.profile.String()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ChapterValues is the metrics of one chapter.
+type ChapterValues struct {
+	Chapter string
+	Values  []MetricValue
+}
+
+// migrateChapterPositions adds position to chapter_metrics created before it;
+// their chapters sort by name until recomputed.
+func (s *Store) migrateChapterPositions() error {
+	ok, err := s.hasColumn("chapter_metrics", "position")
+	if err != nil || ok {
+		return err
+	}
+	if _, err := s.db.Exec(`ALTER TABLE chapter_metrics ADD COLUMN position INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return fmt.Errorf("migrate chapter_metrics: %w", err)
+	}
+	return nil
+}
+
+// PutChapterMetrics stores the metrics of every chapter of a title snapshot,
+// given in document order, with the store's text profile. They replace all
+// earlier values of the snapshot, so chapters no longer in it are dropped.
+func (s *Store) PutChapterMetrics(ctx context.Context, title int, date string, chapters []ChapterValues) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM chapter_metrics WHERE title_number=? AND issue_date=?`, title, date); err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, `
+INSERT INTO chapter_metrics(title_number, issue_date, chapter, metric, value_num, value_text, created_at, text_profile, position)
+VALUES(?,?,?,?,?,?,?,?,?)
+`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	now := time.Now().Format(time.RFC3339)
+	for i, ch := range chapters {
+		for _, v := range ch.Values {
+			if _, err := stmt.ExecContext(ctx, title, date, ch.Chapter, v.Metric, v.Num, v.Text, now, s.profile.String(), i); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// LatestTitleMetric returns each title's latest value of metric with the
+// change from its previous snapshot computed with the same text profile, by
+// title number. WholeCFR is not included.
+func (s *Store) LatestTitleMetric(ctx context.Context, metric string) ([]map[string]any, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT
+  m.title_number,
+  t.name,
+  m.issue_date,
+  m.value_num,
+  m.value_text,
+  m.text_profile,
+  (SELECT m2.value_num
+     FROM title_metrics m2
+    WHERE m2.title_number=m.title_number
+      AND m2.metric=m.metric
+      AND m2.text_profile=m.text_profile
+      AND m2.issue_date < m.issue_date
+    ORDER BY m2.issue_date DESC
+    LIMIT 1) AS prev_num
+FROM title_metrics m
+JOIN titles t ON t.number = m.title_number
+WHERE m.metric = ?
+  AND m.issue_date = (SELECT MAX(issue_date) FROM title_metrics m2 WHERE m2.title_number=m.title_number AND m2.metric=m.metric)
+ORDER BY m.title_number
+`, metric)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []map[string]any{}
+	for rows.Next() {
+		var number int
+		var name, date, profile string
+		var num, prevNum sql.NullFloat64
+		var txt sql.NullString
+		if err := rows.Scan(&number, &name, &date, &num, &txt, &profile, &prevNum); err != nil {
+			return nil, err
+		}
+		o := map[string]any{"title": number, "name": name, "date": date, "value": metricValue(num, txt), "delta": nil, "text_profile": profile}
+		if num.Valid && prevNum.Valid {
+			o["delta"] = num.Float64 - prevNum.Float64
+		}
+		out = append(out, o)
+	}
+	return out, rows.Err()
+}
+
+// TitleMetrics is all metrics of a title snapshot and the text profile they
+// were computed with, which they share as they are stored together.
+type TitleMetrics struct {
+	Date        string
+	Values      map[string]any
+	TextProfile string
+}
+
+// TitleMetricsAsOf returns all metrics of a title (or WholeCFR) from its
+// latest computed snapshot on or before date (the latest if date is empty).
+// Date is empty and Values empty if none was computed.
+func (s *Store) TitleMetricsAsOf(ctx context.Context, title int, date string) (TitleMetrics, error) {
+	var d sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+SELECT MAX(issue_date) FROM title_metrics WHERE title_number=? AND (? = '' OR issue_date <= ?)
+`, title, date, date).Scan(&d)
+	if err != nil {
+		return TitleMetrics{}, err
+	}
+	out := TitleMetrics{Values: map[string]any{}}
+	if !d.Valid {
+		return out, nil
+	}
+	out.Date = d.String
+	rows, err := s.db.QueryContext(ctx, `
+SELECT metric, value_num, value_text, text_profile FROM title_metrics WHERE title_number=? AND issue_date=?
+`, title, d.String)
+	if err != nil {
+		return TitleMetrics{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var metric string
+		var num sql.NullFloat64
+		var txt sql.NullString
+		if err := rows.Scan(&metric, &num, &txt, &out.TextProfile); err != nil {
+			return TitleMetrics{}, err
+		}
+		out.Values[metric] = metricValue(num, txt)
+	}
+	return out, rows.Err()
+}
+
+// ChapterMetricsAsOf returns the metrics of every chapter of a title from its
+// latest computed snapshot on or before date (the latest if date is empty),
+// by chapter, and that snapshot's date.
+func (s *Store) ChapterMetricsAsOf(ctx context.Context, title int, date string) (string, []map[string]any, error) {
+	var d sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+SELECT MAX(issue_date) FROM chapter_metrics WHERE title_number=? AND (? = '' OR issue_date <= ?)
+`, title, date, date).Scan(&d)
+	if err != nil {
+		return "", nil, err
+	}
+	out := []map[string]any{}
+	if !d.Valid {
+		return "", out, nil
+	}
+	rows, err := s.db.QueryContext(ctx, `
+SELECT chapter, metric, value_num, value_text, text_profile FROM chapter_metrics
+WHERE title_number=? AND issue_date=?
+ORDER BY position, chapter
+`, title, d.String)
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+	var cur map[string]any
+	for rows.Next() {
+		var chapter, metric, profile string
+		var num sql.NullFloat64
+		var txt sql.NullString
+		if err := rows.Scan(&chapter, &metric, &num, &txt, &profile); err != nil {
+			return "", nil, err
+		}
+		if cur == nil || cur["chapter"] != chapter {
+			cur = map[string]any{"chapter": chapter, "metrics": map[string]any{}, "text_profile": profile}
+			out = append(out, cur)
+		}
+		cur["metrics"].(map[string]any)[metric] = metricValue(num, txt)
+	}
+	return d.String, out, rows.Err()
+}
+
+func metricValue(num sql.NullFloat64, txt sql.NullString) any {
+	switch {
+	case num.Valid:
+		return num.Float64
+	case txt.Valid:
+		return txt.String
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"ecfr-analytics/internal/ecfr"
+)
+
+func TestTitleAndChapterMetrics(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+	if err := st.UpsertTitles(ctx, []ecfr.Title{{Number: 1, Name: "Title 1"}, {Number: 2, Name: "Title 2"}}); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	num := func(v float64) *float64 { return &v }
+	sum := "abc"
+	put := func(title int, date string, words float64) {
+		t.Helper()
+		vals := []MetricValue{{Metric: "word_count", Num: num(words)}, {Metric: "checksum", Text: &sum}}
+		if err := st.PutTitleMetrics(ctx, title, date, vals); err != nil {
+			t.Fatalf("put title metrics: %v", err)
+		}
+	}
+	put(1, "2025-01-01", 10)
+	put(1, "2025-02-01", 15)
+	put(2, "2025-01-01", 7)
+	put(WholeCFR, "2025-02-01", 22)
+
+	rows, err := st.LatestTitleMetric(ctx, "word_count")
+	if err != nil {
+		t.Fatalf("latest: %v", err)
+	}
+	if len(rows) != 2 || rows[0]["title"] != 1 || rows[0]["value"] != 15.0 || rows[0]["delta"] != 5.0 || rows[1]["delta"] != nil {
+		t.Fatalf("unexpected latest rows: %#v", rows)
+	}
+
+	tm, err := st.TitleMetricsAsOf(ctx, 1, "2025-01-15")
+	if err != nil || tm.Date != "2025-01-01" || tm.Values["word_count"] != 10.0 || tm.Values["checksum"] != "abc" || tm.TextProfile != "all,-AUTH,-SOURCE" {
+		t.Fatalf("unexpected as-of metrics: %#v %v", tm, err)
+	}
+	tm, err = st.TitleMetricsAsOf(ctx, WholeCFR, "")
+	if err != nil || tm.Date != "2025-02-01" || tm.Values["word_count"] != 22.0 {
+		t.Fatalf("unexpected CFR metrics: %#v %v", tm, err)
+	}
+	if tm, err := st.TitleMetricsAsOf(ctx, 1, "2024-01-01"); err != nil || tm.Date != "" {
+		t.Fatalf("expected no metrics before the first snapshot, got %q %v", tm.Date, err)
+	}
+
+	// Chapters are kept in document order, not by name.
+	chapters := []ChapterValues{
+		{"X", []MetricValue{{Metric: "word_count", Num: num(4)}}},
+		{"IX", []MetricValue{{Metric: "word_count", Num: num(6)}, {Metric: "checksum", Text: &sum}}},
+	}
+	if err := st.PutChapterMetrics(ctx, 1, "2025-02-01", chapters); err != nil {
+		t.Fatalf("put chapter metrics: %v", err)
+	}
+	date, chs, err := st.ChapterMetricsAsOf(ctx, 1, "")
+	if err != nil || date != "2025-02-01" || len(chs) != 2 {
+		t.Fatalf("unexpected chapter metrics: %s %#v %v", date, chs, err)
+	}
+	if chs[0]["chapter"] != "X" || chs[1]["chapter"] != "IX" || chs[1]["metrics"].(map[string]any)["word_count"] != 6.0 {
+		t.Fatalf("unexpected chapter order: %#v", chs)
+	}
+
+	// A recompute replaces the snapshot's chapters and metrics outright.
+	chapters = []ChapterValues{{"IX", []MetricValue{{Metric: "word_count", Num: num(8)}}}}
+	if err := st.PutChapterMetrics(ctx, 1, "2025-02-01", chapters); err != nil {
+		t.Fatalf("put chapter metrics again: %v", err)
+	}
+	_, chs, err = st.ChapterMetricsAsOf(ctx, 1, "")
+	if err != nil || len(chs) != 1 || chs[0]["chapter"] != "IX" || len(chs[0]["metrics"].(map[string]any)) != 1 {
+		t.Fatalf("expected stale chapters and metrics to be dropped: %#v %v", chs, err)
+	}
+	if err := st.PutTitleMetrics(ctx, 1, "2025-02-01", []MetricValue{{Metric: "word_count", Num: num(16)}}); err != nil {
+		t.Fatalf("put title metrics again: %v", err)
+	}
+	if tm, err := st.TitleMetricsAsOf(ctx, 1, ""); err != nil || len(tm.Values) != 1 || tm.Values["word_count"] != 16.0 {
+		t.Fatalf("expected stale title metrics to be dropped: %#v %v", tm, err)
+	}
+}
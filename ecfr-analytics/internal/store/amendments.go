@@ -0,0 +1,196 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"ecfr-analytics/internal/ecfr"
+)
+
+// amendmentsDDL holds when each section and appendix of a snapshot was last
+// amended. amendments_indexed records the snapshots dated and whether the
+// versioner's history was available; snapshots dated from their notes alone
+// are dated again once it is.
+const amendmentsDDL = `
+CREATE TABLE IF NOT EXISTS section_amendments (
+  title_number INTEGER NOT NULL,
+  issue_date TEXT NOT NULL,
+  chapter TEXT NOT NULL,
+  part TEXT NOT NULL,
+  type TEXT NOT NULL,
+  identifier TEXT NOT NULL,
+  heading TEXT NOT NULL,
+  last_amended TEXT NOT NULL,
+  basis TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS section_amendments_snapshot ON section_amendments(title_number, issue_date);
+
+CREATE TABLE IF NOT EXISTS amendments_indexed (
+  title_number INTEGER NOT NULL,
+  issue_date TEXT NOT NULL,
+  versions INTEGER NOT NULL,
+  sections INTEGER NOT NULL,
+  indexed_at TEXT NOT NULL,
+  PRIMARY KEY(title_number, issue_date)
+);
+`
+
+// VersionsFunc fetches a title's content versions up to date, as
+// ecfr.Client.GetTitleVersions does.
+type VersionsFunc func(ctx context.Context, title int, date string) ([]ecfr.ContentVersion, error)
+
+// IndexAmendments dates the sections of each title's latest stored snapshot
+// with the content versions from versions, carrying on past titles that
+// fail. A title whose versions cannot be fetched is dated from its notes
+// alone and retried on the next call. It returns the number of snapshots
+// dated with their versions.
+func (s *Store) IndexAmendments(ctx context.Context, versions VersionsFunc, progress func(done, total int)) (int, error) {
+	type pending struct {
+		title int
+		date  string
+	}
+	var todo []pending
+	rows, err := s.db.QueryContext(ctx, `
+SELECT s.title_number, s.issue_date
+FROM (SELECT title_number, MAX(issue_date) AS issue_date FROM snapshots GROUP BY title_number) s
+LEFT JOIN amendments_indexed i ON i.title_number = s.title_number AND i.issue_date = s.issue_date AND i.versions = 1
+WHERE i.title_number IS NULL
+ORDER BY s.title_number
+`)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.title, &p.date); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		todo = append(todo, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	indexed, failed := 0, 0
+	var firstErr error
+	for i, p := range todo {
+		if progress != nil {
+			progress(i, len(todo))
+		}
+		vs, err := versions(ctx, p.title, p.date)
+		if err == nil {
+			if vs == nil {
+				vs = []ecfr.ContentVersion{}
+			}
+			err = s.IndexTitleAmendments(ctx, p.title, p.date, vs)
+		} else if ctx.Err() == nil {
+			err = fmt.Errorf("versions: %w", err)
+			if ierr := s.IndexTitleAmendments(ctx, p.title, p.date, nil); ierr != nil {
+				err = fmt.Errorf("%w; %v", err, ierr)
+			}
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return indexed, ctx.Err()
+			}
+			failed++
+			if firstErr == nil {
+				firstErr = fmt.Errorf("amendments of title %d (%s): %w", p.title, p.date, err)
+			}
+			continue
+		}
+		indexed++
+	}
+	if progress != nil {
+		progress(len(todo), len(todo))
+	}
+	if failed > 0 {
+		return indexed, fmt.Errorf("%d of %d snapshots not dated; first error: %w", failed, len(todo), firstErr)
+	}
+	return indexed, nil
+}
+
+// IndexTitleAmendments replaces the last-amended dates of the sections in a
+// title's snapshot at date with those from its notes and versions, the
+// title's content versions up to date. Nil versions dates the sections from
+// their notes alone.
+func (s *Store) IndexTitleAmendments(ctx context.Context, title int, date string, versions []ecfr.ContentVersion) error {
+	rc, err := s.OpenSnapshot(ctx, title, date)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	var sections []ecfr.Section
+	err = ecfr.ScanTitleStructure(rc, func(sec ecfr.Section) error {
+		sec.Text = ""
+		sections = append(sections, sec)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	amended := ecfr.LastAmended(sections, ecfr.LastAmendedVersions(versions))
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM section_amendments WHERE title_number=? AND issue_date=?`, title, date); err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, `
+INSERT INTO section_amendments(title_number, issue_date, chapter, part, type, identifier, heading, last_amended, basis)
+VALUES(?,?,?,?,?,?,?,?,?)
+`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, a := range amended {
+		if _, err := stmt.ExecContext(ctx, title, date, a.Chapter, a.Part, a.Type, a.Identifier, a.Heading, a.LastAmended, a.Basis); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO amendments_indexed(title_number, issue_date, versions, sections, indexed_at)
+VALUES(?,?,?,?,?)
+ON CONFLICT(title_number, issue_date) DO UPDATE SET versions=excluded.versions, sections=excluded.sections, indexed_at=excluded.indexed_at
+`, title, date, versions != nil, len(amended), time.Now().Format(time.RFC3339)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SectionAmendments returns the last-amended dates of the sections in a
+// title's snapshot at date, in document order, or nil if the snapshot has
+// not been dated.
+func (s *Store) SectionAmendments(ctx context.Context, title int, date string) ([]ecfr.SectionAmendment, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM amendments_indexed WHERE title_number=? AND issue_date=?`, title, date).Scan(&n)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, `
+SELECT chapter, part, type, identifier, heading, last_amended, basis
+FROM section_amendments
+WHERE title_number=? AND issue_date=?
+ORDER BY rowid
+`, title, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []ecfr.SectionAmendment{}
+	for rows.Next() {
+		var a ecfr.SectionAmendment
+		if err := rows.Scan(&a.Chapter, &a.Part, &a.Type, &a.Identifier, &a.Heading, &a.LastAmended, &a.Basis); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
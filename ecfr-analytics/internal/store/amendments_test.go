@@ -0,0 +1,65 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"ecfr-analytics/internal/ecfr"
+)
+
+func TestIndexAmendments(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	if err := st.UpsertTitles(ctx, []ecfr.Title{{Number: 10, Name: "Energy", UpToDateAsOf: "2025-02-01"}}); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	xml := []byte(`<ECFR><DIV1 N="10" TYPE="TITLE"><DIV3 N="I" TYPE="CHAPTER">
+<DIV5 N="2" TYPE="PART"><HEAD>PART 2—PROCEDURE</HEAD>
+<SOURCE><HED>Source:</HED><PSPACE>27 FR 377, Jan. 13, 1962, unless otherwise noted.</PSPACE></SOURCE>
+<DIV8 N="2.1" TYPE="SECTION"><HEAD>§ 2.1 Scope.</HEAD><P>Scope.</P>
+<CITA TYPE="N">[27 FR 377, Jan. 13, 1962, as amended at 56 FR 29407, June 27, 1991]</CITA></DIV8>
+<DIV8 N="2.2" TYPE="SECTION"><HEAD>§ 2.2 Subparts.</HEAD><P>Subparts.</P></DIV8>
+</DIV5>
+</DIV3></DIV1></ECFR>`)
+	if err := st.SaveSnapshotFromReader(ctx, 10, "2025-02-01", bytes.NewReader(xml)); err != nil {
+		t.Fatalf("save snapshot: %v", err)
+	}
+	if got, err := st.SectionAmendments(ctx, 10, "2025-02-01"); err != nil || got != nil {
+		t.Fatalf("expected no dates before indexing: %#v %v", got, err)
+	}
+
+	calls := 0
+	failing := func(ctx context.Context, title int, date string) ([]ecfr.ContentVersion, error) {
+		calls++
+		return nil, errors.New("unavailable")
+	}
+	if n, err := st.IndexAmendments(ctx, failing, nil); err == nil || n != 0 {
+		t.Fatalf("expected a versions failure, got %d %v", n, err)
+	}
+	got, err := st.SectionAmendments(ctx, 10, "2025-02-01")
+	if err != nil || len(got) != 2 || got[0].LastAmended != "1991-06-27" || got[1].LastAmended != "1962-01-13" || got[1].Basis != ecfr.AmendedSource {
+		t.Fatalf("unexpected dates from notes: %#v %v", got, err)
+	}
+
+	versions := func(ctx context.Context, title int, date string) ([]ecfr.ContentVersion, error) {
+		calls++
+		return []ecfr.ContentVersion{
+			{AmendmentDate: "2017-01-03", Identifier: "2.1", Type: "section", Substantive: true},
+			{AmendmentDate: "2017-01-03", Identifier: "2.2", Type: "section", Substantive: true},
+			{AmendmentDate: "2022-08-01", Identifier: "2.2", Type: "section", Substantive: true},
+		}, nil
+	}
+	if n, err := st.IndexAmendments(ctx, versions, nil); err != nil || n != 1 {
+		t.Fatalf("index amendments: %d %v", n, err)
+	}
+	got, err = st.SectionAmendments(ctx, 10, "2025-02-01")
+	if err != nil || len(got) != 2 || got[0].LastAmended != "1991-06-27" || got[1].LastAmended != "2022-08-01" || got[1].Basis != ecfr.AmendedVersions {
+		t.Fatalf("unexpected dates with versions: %#v %v", got, err)
+	}
+	if n, err := st.IndexAmendments(ctx, versions, nil); err != nil || n != 0 || calls != 2 {
+		t.Fatalf("expected nothing left to date: %d %v (%d calls)", n, err, calls)
+	}
+}
@@ -0,0 +1,548 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"ecfr-analytics/internal/ecfr"
+)
+
+var ErrInvalidCitation = errors.New("invalid citation")
+
+// The citation graph covers each title's latest snapshot only. cfr_sections
+// lists that snapshot's parts, sections and appendices, so citations into a
+// title can be resolved and placed in its chapters; citations holds one edge
+// per citing section and cited part, section or statute, with the number of
+// times it is cited; a range is one edge, with target_through set and sort
+// keys (rangeKey) of its ends. section_history records the first and last stored
+// snapshot of every division ever seen, so citations of divisions missing
+// from the latest snapshot can be told apart as removed or never existing.
+const citationsDDL = `
+CREATE TABLE IF NOT EXISTS cfr_sections (
+  title_number INTEGER NOT NULL,
+  issue_date TEXT NOT NULL,
+  subtitle TEXT NOT NULL,
+  chapter TEXT NOT NULL,
+  part TEXT NOT NULL,
+  type TEXT NOT NULL,
+  identifier TEXT NOT NULL,
+  heading TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS cfr_sections_part ON cfr_sections(title_number, part);
+CREATE INDEX IF NOT EXISTS cfr_sections_identifier ON cfr_sections(title_number, type, identifier);
+
+CREATE TABLE IF NOT EXISTS citations (
+  title_number INTEGER NOT NULL,
+  issue_date TEXT NOT NULL,
+  subtitle TEXT NOT NULL,
+  chapter TEXT NOT NULL,
+  part TEXT NOT NULL,
+  section TEXT NOT NULL,
+  target_kind TEXT NOT NULL,
+  target_title INTEGER NOT NULL,
+  target_part TEXT NOT NULL,
+  target_section TEXT NOT NULL,
+  count INTEGER NOT NULL,
+  target_through TEXT NOT NULL DEFAULT '',
+  target_key TEXT NOT NULL DEFAULT '',
+  target_through_key TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS citations_from ON citations(title_number, part, section);
+CREATE INDEX IF NOT EXISTS citations_to ON citations(target_kind, target_title, target_part, target_section);
+
+CREATE TABLE IF NOT EXISTS citations_indexed (
+  title_number INTEGER PRIMARY KEY,
+  issue_date TEXT NOT NULL,
+  version INTEGER NOT NULL,
+  sections INTEGER NOT NULL,
+  citations INTEGER NOT NULL,
+  indexed_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS section_history (
+  title_number INTEGER NOT NULL,
+  type TEXT NOT NULL,
+  identifier TEXT NOT NULL,
+  first_date TEXT NOT NULL,
+  last_date TEXT NOT NULL,
+  heading TEXT NOT NULL,
+  PRIMARY KEY(title_number, type, identifier)
+);
+
+CREATE TABLE IF NOT EXISTS history_indexed (
+  title_number INTEGER NOT NULL,
+  issue_date TEXT NOT NULL,
+  PRIMARY KEY(title_number, issue_date)
+);
+`
+
+// migrateCitationRanges adds the range columns to citations created before
+// ranges were kept. Their titles are indexed again, as ecfr.CitationsVersion
+// changed with them.
+func (s *Store) migrateCitationRanges() error {
+	ok, err := s.hasColumn("citations", "target_through")
+	if err != nil || ok {
+		return err
+	}
+	for _, col := range []string{"target_through", "target_key", "target_through_key"} {
+		if _, err := s.db.Exec(`ALTER TABLE citations ADD COLUMN ` + col + ` TEXT NOT NULL DEFAULT ''`); err != nil {
+			return fmt.Errorf("migrate citations: %w", err)
+		}
+	}
+	return nil
+}
+
+// rangeKey orders part and section numbers for range lookups: every run of
+// digits is padded to the same width, so "60.9" sorts before "60.10" and
+// "1910" after "191".
+func rangeKey(id string) string {
+	var b strings.Builder
+	for i := 0; i < len(id); {
+		j := i
+		for j < len(id) && id[j] >= '0' && id[j] <= '9' {
+			j++
+		}
+		if j == i {
+			b.WriteByte(id[i])
+			i++
+			continue
+		}
+		for k := j - i; k < 10; k++ {
+			b.WriteByte('0')
+		}
+		b.WriteString(id[i:j])
+		i = j
+	}
+	return b.String()
+}
+
+// IndexCitations brings the citation graph up to date with each title's
+// latest stored snapshot, and section history with every stored snapshot,
+// carrying on past snapshots that fail. Titles indexed by an older
+// ecfr.CitationsVersion are indexed again. It returns the number of
+// snapshots indexed.
+func (s *Store) IndexCitations(ctx context.Context, progress func(done, total int)) (int, error) {
+	type pending struct {
+		title  int
+		date   string
+		latest bool
+	}
+	var todo []pending
+	latest := map[pending]bool{}
+	rows, err := s.db.QueryContext(ctx, `
+SELECT s.title_number, s.issue_date
+FROM (SELECT title_number, MAX(issue_date) AS issue_date FROM snapshots GROUP BY title_number) s
+LEFT JOIN citations_indexed i ON i.title_number = s.title_number AND i.issue_date = s.issue_date AND i.version = ?
+WHERE i.title_number IS NULL
+ORDER BY s.title_number
+`, ecfr.CitationsVersion)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		p := pending{latest: true}
+		if err := rows.Scan(&p.title, &p.date); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		todo = append(todo, p)
+		latest[pending{title: p.title, date: p.date}] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	rows, err = s.db.QueryContext(ctx, `
+SELECT s.title_number, s.issue_date FROM snapshots s
+LEFT JOIN history_indexed h ON h.title_number = s.title_number AND h.issue_date = s.issue_date
+WHERE h.title_number IS NULL
+ORDER BY s.title_number, s.issue_date
+`)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.title, &p.date); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if !latest[p] {
+			todo = append(todo, p)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	indexed, failed := 0, 0
+	var firstErr error
+	for i, p := range todo {
+		if progress != nil {
+			progress(i, len(todo))
+		}
+		if p.latest {
+			err = s.IndexTitleCitations(ctx, p.title, p.date)
+		} else {
+			err = s.indexSectionHistory(ctx, p.title, p.date)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return indexed, ctx.Err()
+			}
+			failed++
+			if firstErr == nil {
+				firstErr = fmt.Errorf("citations of title %d (%s): %w", p.title, p.date, err)
+			}
+			continue
+		}
+		indexed++
+	}
+	if progress != nil {
+		progress(len(todo), len(todo))
+	}
+	if failed > 0 {
+		return indexed, fmt.Errorf("%d of %d snapshots not indexed; first error: %w", failed, len(todo), firstErr)
+	}
+	return indexed, nil
+}
+
+// IndexTitleCitations replaces a title's structure, outgoing citations and
+// provenance notes with those of the snapshot at date, and records the
+// snapshot in section history. The replacement is one transaction, so
+// readers never see a title half indexed. A section citing itself is not
+// recorded.
+func (s *Store) IndexTitleCitations(ctx context.Context, title int, date string) error {
+	rc, err := s.OpenSnapshot(ctx, title, date)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	type edge struct {
+		section int
+		to      ecfr.Citation
+	}
+	var sections []ecfr.Section
+	var edges []edge
+	counts := map[edge]int{}
+	err = ecfr.ScanTitleStructure(rc, func(sec ecfr.Section) error {
+		for _, c := range ecfr.ExtractCitations(sec.Text, title) {
+			if c.Kind == ecfr.CitationCFR && c.Title == title && c.Section == sec.Identifier {
+				continue
+			}
+			e := edge{len(sections), c}
+			if counts[e] == 0 {
+				edges = append(edges, e)
+			}
+			counts[e]++
+		}
+		sec.Text = ""
+		sections = append(sections, sec)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, q := range []string{`DELETE FROM cfr_sections WHERE title_number=?`, `DELETE FROM citations WHERE title_number=?`} {
+		if _, err := tx.ExecContext(ctx, q, title); err != nil {
+			return err
+		}
+	}
+	secStmt, err := tx.PrepareContext(ctx, `
+INSERT INTO cfr_sections(title_number, issue_date, subtitle, chapter, part, type, identifier, heading)
+VALUES(?,?,?,?,?,?,?,?)
+`)
+	if err != nil {
+		return err
+	}
+	defer secStmt.Close()
+	for _, sec := range sections {
+		if _, err := secStmt.ExecContext(ctx, title, date, sec.Subtitle, sec.Chapter, sec.Part, sec.Type, sec.Identifier, sec.Heading); err != nil {
+			return err
+		}
+	}
+	citeStmt, err := tx.PrepareContext(ctx, `
+INSERT INTO citations(title_number, issue_date, subtitle, chapter, part, section, target_kind, target_title, target_part, target_section, count,
+  target_through, target_key, target_through_key)
+VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+`)
+	if err != nil {
+		return err
+	}
+	defer citeStmt.Close()
+	for _, e := range edges {
+		sec := sections[e.section]
+		var key, throughKey string
+		if e.to.Through != "" {
+			key, throughKey = rangeKey(e.to.Part), rangeKey(e.to.Through)
+			if e.to.Section != "" {
+				key = rangeKey(e.to.Section)
+			}
+		}
+		if _, err := citeStmt.ExecContext(ctx, title, date, sec.Subtitle, sec.Chapter, sec.Part, sec.Identifier,
+			e.to.Kind, e.to.Title, e.to.Part, e.to.Section, counts[e], e.to.Through, key, throughKey); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO citations_indexed(title_number, issue_date, version, sections, citations, indexed_at)
+VALUES(?,?,?,?,?,?)
+ON CONFLICT(title_number) DO UPDATE SET issue_date=excluded.issue_date, version=excluded.version,
+  sections=excluded.sections, citations=excluded.citations, indexed_at=excluded.indexed_at
+`, title, date, ecfr.CitationsVersion, len(sections), len(edges), time.Now().Format(time.RFC3339)); err != nil {
+		return err
+	}
+	if err := putSectionHistory(ctx, tx, title, date, sections); err != nil {
+		return err
+	}
+	if err := putProvenance(ctx, tx, title, date, sections); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// indexSectionHistory records the divisions of an older snapshot in section
+// history.
+func (s *Store) indexSectionHistory(ctx context.Context, title int, date string) error {
+	rc, err := s.OpenSnapshot(ctx, title, date)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	var sections []ecfr.Section
+	err = ecfr.ScanTitleStructure(rc, func(sec ecfr.Section) error {
+		sec.Text = ""
+		sections = append(sections, sec)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := putSectionHistory(ctx, tx, title, date, sections); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// putSectionHistory widens each division's first and last dates to include
+// date, keeping the heading of its latest snapshot, and marks the snapshot
+// recorded.
+func putSectionHistory(ctx context.Context, tx *sql.Tx, title int, date string, sections []ecfr.Section) error {
+	stmt, err := tx.PrepareContext(ctx, `
+INSERT INTO section_history(title_number, type, identifier, first_date, last_date, heading)
+VALUES(?,?,?,?,?,?)
+ON CONFLICT(title_number, type, identifier) DO UPDATE SET
+  first_date = MIN(first_date, excluded.first_date),
+  last_date = MAX(last_date, excluded.last_date),
+  heading = CASE WHEN excluded.last_date >= last_date THEN excluded.heading ELSE heading END
+`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, sec := range sections {
+		if _, err := stmt.ExecContext(ctx, title, sec.Type, sec.Identifier, date, date, sec.Heading); err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, `INSERT OR IGNORE INTO history_indexed(title_number, issue_date) VALUES(?,?)`, title, date)
+	return err
+}
+
+// CitationQuery selects edges of the citation graph. From matches citing
+// sections in a CFR title, part or section; To matches cited titles, parts
+// or sections (a part matches citations of its sections too), including
+// ranges that take them in. At least one is required.
+type CitationQuery struct {
+	From   *ecfr.Citation
+	To     *ecfr.Citation
+	Limit  int
+	Offset int
+}
+
+// CitingSection is the section or appendix a citation appears in.
+type CitingSection struct {
+	Title    int      `json:"title"`
+	Subtitle string   `json:"subtitle,omitempty"`
+	Chapter  string   `json:"chapter,omitempty"`
+	Part     string   `json:"part,omitempty"`
+	Section  string   `json:"section"`
+	Date     string   `json:"date"`
+	Agencies []string `json:"agencies"`
+}
+
+type CitationEdge struct {
+	From     CitingSection `json:"from"`
+	To       ecfr.Citation `json:"to"`
+	Citation string        `json:"citation"`
+	Count    int           `json:"count"`
+}
+
+// Citations returns the edges matching q, ordered by citing section and then
+// by cited title, part and section.
+func (s *Store) Citations(ctx context.Context, q CitationQuery) ([]CitationEdge, error) {
+	if q.From == nil && q.To == nil {
+		return nil, fmt.Errorf("%w: from or to is required", ErrInvalidCitation)
+	}
+	if q.Limit <= 0 {
+		q.Limit = 100
+	}
+	var where []string
+	var args []any
+	if f := q.From; f != nil {
+		if f.Kind != ecfr.CitationCFR {
+			return nil, fmt.Errorf("%w: from must be a CFR title, part or section", ErrInvalidCitation)
+		}
+		where = append(where, "title_number = ?")
+		args = append(args, f.Title)
+		if f.Section != "" {
+			where = append(where, "section = ?")
+			args = append(args, f.Section)
+		} else if f.Part != "" {
+			where = append(where, "part = ?")
+			args = append(args, f.Part)
+		}
+	}
+	if t := q.To; t != nil {
+		where = append(where, "target_kind = ?", "target_title = ?")
+		args = append(args, t.Kind, t.Title)
+		if t.Section != "" {
+			where = append(where, `(target_section = ? OR
+  (target_through != '' AND target_section != '' AND target_key <= ? AND target_through_key >= ?))`)
+			args = append(args, t.Section, rangeKey(t.Section), rangeKey(t.Section))
+		} else if t.Part != "" {
+			where = append(where, `(target_part = ? OR
+  (target_through != '' AND target_section = '' AND target_key <= ? AND target_through_key >= ?))`)
+			args = append(args, t.Part, rangeKey(t.Part), rangeKey(t.Part))
+		}
+	}
+	args = append(args, q.Limit, q.Offset)
+
+	owners, err := s.agencyChapters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, `
+SELECT title_number, issue_date, subtitle, chapter, part, section, target_kind, target_title, target_part, target_section, target_through, count
+FROM citations
+WHERE `+strings.Join(where, " AND ")+`
+ORDER BY title_number, part, section, target_kind, target_title, target_part, target_section, target_through
+LIMIT ? OFFSET ?
+`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []CitationEdge{}
+	for rows.Next() {
+		var e CitationEdge
+		f := &e.From
+		if err := rows.Scan(&f.Title, &f.Date, &f.Subtitle, &f.Chapter, &f.Part, &f.Section,
+			&e.To.Kind, &e.To.Title, &e.To.Part, &e.To.Section, &e.To.Through, &e.Count); err != nil {
+			return nil, err
+		}
+		f.Agencies = owners.owning(f.Title, f.Subtitle, f.Chapter)
+		e.Citation = e.To.String()
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// AgencyCitations counts the citations made by and to an agency's text.
+// Outbound counts citations in its sections (OutboundUSC those of the U.S.
+// Code); Inbound counts CFR citations of its parts and sections, and
+// InboundExternal those of them made from text the agency does not own.
+type AgencyCitations struct {
+	Slug            string `json:"slug"`
+	Name            string `json:"name"`
+	Outbound        int    `json:"outbound"`
+	OutboundUSC     int    `json:"outbound_usc"`
+	Inbound         int    `json:"inbound"`
+	InboundExternal int    `json:"inbound_external"`
+}
+
+// AgencyCitationCounts returns every agency's citation counts, most cited
+// first. Cited parts are placed in chapters by the indexed structure of their
+// title; citations of parts it lacks, or of titles not indexed, count only
+// for agencies referencing the whole title.
+func (s *Store) AgencyCitationCounts(ctx context.Context) ([]AgencyCitations, error) {
+	owners, err := s.agencyChapters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]*AgencyCitations, len(owners.refs))
+	for slug := range owners.refs {
+		counts[slug] = &AgencyCitations{Slug: slug, Name: owners.names[slug]}
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+SELECT c.title_number, c.subtitle, c.chapter, c.target_kind, c.target_title,
+  COALESCE(p.subtitle, ''), COALESCE(p.chapter, ''), SUM(c.count)
+FROM citations c
+LEFT JOIN (
+  SELECT title_number, part, MIN(subtitle) AS subtitle, MIN(chapter) AS chapter
+  FROM cfr_sections GROUP BY title_number, part
+) p ON c.target_kind = 'cfr' AND p.title_number = c.target_title AND p.part = c.target_part
+GROUP BY 1, 2, 3, 4, 5, 6, 7
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var title, targetTitle, n int
+		var subtitle, chapter, kind, targetSubtitle, targetChapter string
+		if err := rows.Scan(&title, &subtitle, &chapter, &kind, &targetTitle, &targetSubtitle, &targetChapter, &n); err != nil {
+			return nil, err
+		}
+		from := owners.owning(title, subtitle, chapter)
+		for _, slug := range from {
+			counts[slug].Outbound += n
+			if kind == ecfr.CitationUSC {
+				counts[slug].OutboundUSC += n
+			}
+		}
+		if kind != ecfr.CitationCFR {
+			continue
+		}
+		for _, slug := range owners.owning(targetTitle, targetSubtitle, targetChapter) {
+			counts[slug].Inbound += n
+			if i := sort.SearchStrings(from, slug); i == len(from) || from[i] != slug {
+				counts[slug].InboundExternal += n
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]AgencyCitations, 0, len(counts))
+	for _, c := range counts {
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Inbound != out[j].Inbound {
+			return out[i].Inbound > out[j].Inbound
+		}
+		return out[i].Slug < out[j].Slug
+	})
+	return out, nil
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"ecfr-analytics/internal/ecfr"
+)
+
+func TestCitationGraph(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	if err := st.UpsertTitles(ctx, []ecfr.Title{{Number: 40, Name: "Environment", UpToDateAsOf: "2025-02-01"}}); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	if err := st.UpsertAgencies(ctx, []ecfr.Agency{
+		{Name: "Agency One", Slug: "one", CFRReferences: []ecfr.CFRRef{{Title: 40, Chapter: "I"}}},
+		{Name: "Agency Two", Slug: "two", CFRReferences: []ecfr.CFRRef{{Title: 40, Chapter: "II"}}},
+	}); err != nil {
+		t.Fatalf("upsert agencies: %v", err)
+	}
+
+	old := []byte(`<ECFR><DIV1 N="40" TYPE="TITLE"><DIV3 N="I" TYPE="CHAPTER"><DIV5 N="60" TYPE="PART">
+<DIV8 N="60.1" TYPE="SECTION"><P>See 40 CFR part 99.</P></DIV8>
+</DIV5></DIV3></DIV1></ECFR>`)
+	cur := []byte(`<ECFR><DIV1 N="40" TYPE="TITLE">
+<DIV3 N="I" TYPE="CHAPTER"><DIV5 N="60" TYPE="PART">
+<DIV8 N="60.1" TYPE="SECTION"><HEAD>§ 60.1 Scope.</HEAD><P>Under 42 U.S.C. 7411, § 60.1(a) and § 60.5 apply; see § 60.5(b).</P></DIV8>
+<DIV8 N="60.5" TYPE="SECTION"><P>Records under part 200 of this chapter.</P></DIV8>
+</DIV5></DIV3>
+<DIV3 N="II" TYPE="CHAPTER"><DIV5 N="200" TYPE="PART">
+<DIV8 N="200.1" TYPE="SECTION"><P>As in 40 CFR 60.5 and 42 U.S.C. 7411.</P></DIV8>
+</DIV5></DIV3>
+</DIV1></ECFR>`)
+	for d, xml := range map[string][]byte{"2025-01-01": old, "2025-02-01": cur} {
+		if err := st.SaveSnapshotFromReader(ctx, 40, d, bytes.NewReader(xml)); err != nil {
+			t.Fatalf("save snapshot: %v", err)
+		}
+	}
+	if n, err := st.IndexCitations(ctx, nil); err != nil || n != 2 {
+		t.Fatalf("index citations: %d %v", n, err)
+	}
+	if n, err := st.IndexCitations(ctx, nil); err != nil || n != 0 {
+		t.Fatalf("expected nothing pending, got %d %v", n, err)
+	}
+
+	from, _ := ecfr.ParseCitation("40 CFR 60.1")
+	edges, err := st.Citations(ctx, CitationQuery{From: &from})
+	if err != nil {
+		t.Fatalf("citations from: %v", err)
+	}
+	if len(edges) != 2 || edges[0].Citation != "40 CFR 60.5" || edges[0].Count != 2 || edges[1].Citation != "42 U.S.C. 7411" {
+		t.Fatalf("unexpected edges from 60.1 (self-citation must be dropped): %+v", edges)
+	}
+	if f := edges[0].From; f.Chapter != "I" || f.Part != "60" || f.Date != "2025-02-01" || len(f.Agencies) != 1 || f.Agencies[0] != "one" {
+		t.Fatalf("unexpected citing section: %+v", f)
+	}
+
+	to, _ := ecfr.ParseCitation("40 CFR part 60")
+	edges, err = st.Citations(ctx, CitationQuery{To: &to})
+	if err != nil {
+		t.Fatalf("citations to: %v", err)
+	}
+	if len(edges) != 2 || edges[0].From.Section != "200.1" || edges[1].From.Section != "60.1" {
+		t.Fatalf("unexpected edges to part 60: %+v", edges)
+	}
+	usc, _ := ecfr.ParseCitation("42 U.S.C.")
+	if edges, err := st.Citations(ctx, CitationQuery{To: &usc}); err != nil || len(edges) != 2 {
+		t.Fatalf("expected 2 edges to 42 U.S.C., got %+v (%v)", edges, err)
+	}
+	if _, err := st.Citations(ctx, CitationQuery{From: &usc}); !errors.Is(err, ErrInvalidCitation) {
+		t.Fatalf("expected ErrInvalidCitation for a U.S.C. source, got %v", err)
+	}
+	if _, err := st.Citations(ctx, CitationQuery{}); !errors.Is(err, ErrInvalidCitation) {
+		t.Fatalf("expected ErrInvalidCitation without from or to, got %v", err)
+	}
+
+	counts, err := st.AgencyCitationCounts(ctx)
+	if err != nil {
+		t.Fatalf("agency counts: %v", err)
+	}
+	want := []AgencyCitations{
+		{Slug: "one", Name: "Agency One", Outbound: 4, OutboundUSC: 1, Inbound: 3, InboundExternal: 1},
+		{Slug: "two", Name: "Agency Two", Outbound: 2, OutboundUSC: 1, Inbound: 1, InboundExternal: 1},
+	}
+	if len(counts) != len(want) || counts[0] != want[0] || counts[1] != want[1] {
+		t.Fatalf("got %+v, want %+v", counts, want)
+	}
+}
+
+func TestCitationRanges(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	if err := st.UpsertTitles(ctx, []ecfr.Title{{Number: 40, Name: "Environment", UpToDateAsOf: "2025-01-01"}}); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	xml := []byte(`<ECFR><DIV1 N="40" TYPE="TITLE"><DIV3 N="I" TYPE="CHAPTER"><DIV5 N="70" TYPE="PART">
+<DIV8 N="70.1" TYPE="SECTION"><P>See §§ 60.1 through 60.10, and parts 61 through 63 of this chapter.</P></DIV8>
+</DIV5></DIV3></DIV1></ECFR>`)
+	if err := st.SaveSnapshotFromReader(ctx, 40, "2025-01-01", bytes.NewReader(xml)); err != nil {
+		t.Fatalf("save snapshot: %v", err)
+	}
+	if _, err := st.IndexCitations(ctx, nil); err != nil {
+		t.Fatalf("index citations: %v", err)
+	}
+
+	cases := []struct {
+		to   string
+		want []string
+	}{
+		{"40 CFR 60.1", []string{"40 CFR 60.1 through 60.10"}},
+		{"40 CFR 60.5", []string{"40 CFR 60.1 through 60.10"}},
+		{"40 CFR 60.10", []string{"40 CFR 60.1 through 60.10"}},
+		{"40 CFR 60.11", nil},
+		{"40 CFR part 60", []string{"40 CFR 60.1 through 60.10"}},
+		{"40 CFR part 62", []string{"40 CFR parts 61 through 63"}},
+		{"40 CFR part 64", nil},
+	}
+	for _, c := range cases {
+		to, ok := ecfr.ParseCitation(c.to)
+		if !ok {
+			t.Fatalf("parse %q", c.to)
+		}
+		edges, err := st.Citations(ctx, CitationQuery{To: &to})
+		if err != nil {
+			t.Fatalf("citations to %s: %v", c.to, err)
+		}
+		var got []string
+		for _, e := range edges {
+			got = append(got, e.Citation)
+		}
+		if len(got) != len(c.want) || (len(got) > 0 && got[0] != c.want[0]) {
+			t.Errorf("citations to %s = %v, want %v", c.to, got, c.want)
+		}
+	}
+	if edges, err := st.Citations(ctx, CitationQuery{To: &ecfr.Citation{Kind: ecfr.CitationCFR, Title: 40, Part: "60", Section: "60.5"}}); err != nil || len(edges) != 1 || edges[0].Count != 1 || edges[0].To.Through != "60.10" {
+		t.Fatalf("expected the range stored once as one edge: %+v %v", edges, err)
+	}
+}
@@ -0,0 +1,184 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"ecfr-analytics/internal/ecfr"
+)
+
+// Statuses of a CFR citation of a part or section resolved against the
+// latest indexed snapshot of the cited title. RefRemoved means the division
+// is in an earlier stored snapshot only; RefMissing that no stored snapshot
+// has it. RefUnchecked is for titles with no indexed snapshot. A section
+// citation may also resolve to a subpart numbered like a section, as in
+// "46 CFR 164.009".
+const (
+	RefOK        = "ok"
+	RefReserved  = "reserved"
+	RefRemoved   = "removed"
+	RefMissing   = "missing"
+	RefUnchecked = "unchecked"
+)
+
+// DanglingStatuses are the statuses a dangling reference report lists by
+// default.
+var DanglingStatuses = []string{RefReserved, RefRemoved, RefMissing}
+
+func ValidRefStatus(s string) bool {
+	switch s {
+	case RefOK, RefReserved, RefRemoved, RefMissing, RefUnchecked:
+		return true
+	}
+	return false
+}
+
+type DanglingQuery struct {
+	Agency   string   // only references made in this agency's text
+	Statuses []string // DanglingStatuses if empty
+}
+
+// DanglingReference is a citation edge with its resolution. Heading is the
+// cited division's current heading, or its last one if removed; LastSeen is
+// the last stored snapshot containing a removed division.
+type DanglingReference struct {
+	From     CitingSection `json:"from"`
+	To       ecfr.Citation `json:"to"`
+	Citation string        `json:"citation"`
+	Count    int           `json:"count"`
+	Status   string        `json:"status"`
+	Heading  string        `json:"heading,omitempty"`
+	LastSeen string        `json:"last_seen,omitempty"`
+}
+
+type AgencyDangling struct {
+	Slug       string              `json:"slug"`
+	Name       string              `json:"name"`
+	Counts     map[string]int      `json:"counts"`
+	References []DanglingReference `json:"references"`
+}
+
+// DanglingReport lists the selected references by the agencies owning the
+// citing text, most references first; references in text no agency owns are
+// under Unowned. Summary counts every CFR part and section citation edge by
+// status, whatever was selected.
+type DanglingReport struct {
+	Summary  map[string]int      `json:"summary"`
+	Agencies []AgencyDangling    `json:"agencies"`
+	Unowned  []DanglingReference `json:"unowned"`
+}
+
+// DanglingReferences resolves every citation of a CFR part or section in the
+// citation graph against the cited title's latest indexed snapshot and
+// section history.
+func (s *Store) DanglingReferences(ctx context.Context, q DanglingQuery) (*DanglingReport, error) {
+	owners, err := s.agencyChapters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if q.Agency != "" {
+		if _, ok := owners.refs[q.Agency]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownAgency, q.Agency)
+		}
+	}
+	statuses := q.Statuses
+	if len(statuses) == 0 {
+		statuses = DanglingStatuses
+	}
+	selected := map[string]bool{}
+	for _, st := range statuses {
+		selected[st] = true
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+WITH t AS (
+  SELECT c.*,
+    CASE WHEN c.target_section = '' THEN 'PART' ELSE 'SECTION' END AS target_type,
+    CASE WHEN c.target_section = '' THEN c.target_part ELSE c.target_section END AS target_id
+  FROM citations c
+  WHERE c.target_kind = 'cfr' AND c.target_part != ''
+)
+SELECT t.title_number, t.issue_date, t.subtitle, t.chapter, t.part, t.section,
+  t.target_title, t.target_part, t.target_section, t.count,
+  i.title_number IS NOT NULL,
+  (SELECT s.heading FROM cfr_sections s
+    WHERE s.title_number = t.target_title AND s.identifier = t.target_id
+      AND (s.type = t.target_type OR (t.target_type = 'SECTION' AND s.type = 'SUBPART'))
+    ORDER BY s.type = 'SUBPART' LIMIT 1),
+  (SELECT h.last_date || char(31) || h.heading FROM section_history h
+    WHERE h.title_number = t.target_title AND h.identifier = t.target_id
+      AND (h.type = t.target_type OR (t.target_type = 'SECTION' AND h.type = 'SUBPART'))
+    ORDER BY h.last_date DESC LIMIT 1)
+FROM t
+LEFT JOIN citations_indexed i ON i.title_number = t.target_title
+ORDER BY t.title_number, t.part, t.section, t.target_title, t.target_part, t.target_section
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &DanglingReport{Summary: map[string]int{}, Agencies: []AgencyDangling{}, Unowned: []DanglingReference{}}
+	byAgency := map[string]*AgencyDangling{}
+	for rows.Next() {
+		r := DanglingReference{To: ecfr.Citation{Kind: ecfr.CitationCFR}}
+		f := &r.From
+		var indexed bool
+		var heading, last sql.NullString
+		if err := rows.Scan(&f.Title, &f.Date, &f.Subtitle, &f.Chapter, &f.Part, &f.Section,
+			&r.To.Title, &r.To.Part, &r.To.Section, &r.Count, &indexed, &heading, &last); err != nil {
+			return nil, err
+		}
+		switch {
+		case !indexed:
+			r.Status = RefUnchecked
+		case heading.Valid && ecfr.IsReserved(heading.String):
+			r.Status, r.Heading = RefReserved, heading.String
+		case heading.Valid:
+			r.Status, r.Heading = RefOK, heading.String
+		case last.Valid:
+			r.Status = RefRemoved
+			r.LastSeen, r.Heading, _ = strings.Cut(last.String, "\x1f")
+		default:
+			r.Status = RefMissing
+		}
+		report.Summary[r.Status]++
+		if !selected[r.Status] {
+			continue
+		}
+		r.Citation = r.To.String()
+		f.Agencies = owners.owning(f.Title, f.Subtitle, f.Chapter)
+		if len(f.Agencies) == 0 && q.Agency == "" {
+			report.Unowned = append(report.Unowned, r)
+		}
+		for _, slug := range f.Agencies {
+			if q.Agency != "" && slug != q.Agency {
+				continue
+			}
+			a := byAgency[slug]
+			if a == nil {
+				a = &AgencyDangling{Slug: slug, Name: owners.names[slug], Counts: map[string]int{}}
+				byAgency[slug] = a
+			}
+			a.Counts[r.Status]++
+			a.References = append(a.References, r)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, a := range byAgency {
+		report.Agencies = append(report.Agencies, *a)
+	}
+	sort.Slice(report.Agencies, func(i, j int) bool {
+		a, b := report.Agencies[i], report.Agencies[j]
+		if len(a.References) != len(b.References) {
+			return len(a.References) > len(b.References)
+		}
+		return a.Slug < b.Slug
+	})
+	return report, nil
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"ecfr-analytics/internal/ecfr"
+)
+
+func TestDanglingReferences(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	if err := st.UpsertTitles(ctx, []ecfr.Title{{Number: 40, Name: "Environment", UpToDateAsOf: "2025-02-01"}}); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	if err := st.UpsertAgencies(ctx, []ecfr.Agency{
+		{Name: "Agency One", Slug: "one", CFRReferences: []ecfr.CFRRef{{Title: 40, Chapter: "I"}}},
+		{Name: "Agency Two", Slug: "two", CFRReferences: []ecfr.CFRRef{{Title: 40, Chapter: "II"}}},
+	}); err != nil {
+		t.Fatalf("upsert agencies: %v", err)
+	}
+
+	old := []byte(`<ECFR><DIV1 N="40" TYPE="TITLE"><DIV3 N="I" TYPE="CHAPTER">
+<DIV5 N="60" TYPE="PART"><HEAD>PART 60—STANDARDS</HEAD>
+<DIV8 N="60.1" TYPE="SECTION"><P>Scope.</P></DIV8>
+<DIV8 N="60.2" TYPE="SECTION"><HEAD>§ 60.2 Definitions.</HEAD><P>Terms.</P></DIV8>
+</DIV5>
+<DIV5 N="61" TYPE="PART"><HEAD>PART 61—HAZARDS</HEAD><DIV8 N="61.1" TYPE="SECTION"><P>Hazards.</P></DIV8></DIV5>
+</DIV3></DIV1></ECFR>`)
+	cur := []byte(`<ECFR><DIV1 N="40" TYPE="TITLE">
+<DIV3 N="I" TYPE="CHAPTER">
+<DIV5 N="60" TYPE="PART"><HEAD>PART 60—STANDARDS</HEAD>
+<DIV8 N="60.1" TYPE="SECTION"><P>See § 60.2, § 60.3, § 60.9, § 60.50, part 60 of this chapter, part 61 of this chapter and 41 CFR 1.1.</P></DIV8>
+<DIV8 N="60.3" TYPE="SECTION"><HEAD>§ 60.3 [Reserved]</HEAD></DIV8>
+<DIV6 N="60.50" TYPE="SUBPART"><HEAD>Subpart 60.50—Boilers</HEAD><DIV8 N="60.50-1" TYPE="SECTION"><P>Boilers.</P></DIV8></DIV6>
+</DIV5>
+<DIV5 N="61" TYPE="PART"><HEAD>PART 61 [RESERVED]</HEAD></DIV5>
+</DIV3>
+<DIV3 N="II" TYPE="CHAPTER"><DIV5 N="200" TYPE="PART">
+<DIV8 N="200.1" TYPE="SECTION"><P>As in 40 CFR 60.9.</P></DIV8>
+</DIV5></DIV3>
+</DIV1></ECFR>`)
+	for d, xml := range map[string][]byte{"2025-01-01": old, "2025-02-01": cur} {
+		if err := st.SaveSnapshotFromReader(ctx, 40, d, bytes.NewReader(xml)); err != nil {
+			t.Fatalf("save snapshot: %v", err)
+		}
+	}
+	if _, err := st.IndexCitations(ctx, nil); err != nil {
+		t.Fatalf("index citations: %v", err)
+	}
+
+	report, err := st.DanglingReferences(ctx, DanglingQuery{})
+	if err != nil {
+		t.Fatalf("dangling references: %v", err)
+	}
+	wantSummary := map[string]int{RefOK: 2, RefReserved: 2, RefRemoved: 1, RefMissing: 2, RefUnchecked: 1}
+	if !reflect.DeepEqual(report.Summary, wantSummary) {
+		t.Fatalf("summary: got %v, want %v", report.Summary, wantSummary)
+	}
+	if len(report.Agencies) != 2 || report.Agencies[0].Slug != "one" || report.Agencies[1].Slug != "two" {
+		t.Fatalf("unexpected agencies: %+v", report.Agencies)
+	}
+	got := map[string]DanglingReference{}
+	for _, r := range report.Agencies[0].References {
+		got[r.Citation] = r
+	}
+	if len(got) != 4 {
+		t.Fatalf("expected 4 references for agency one, got %+v", report.Agencies[0].References)
+	}
+	if r := got["40 CFR 60.2"]; r.Status != RefRemoved || r.LastSeen != "2025-01-01" || r.Heading != "§ 60.2 Definitions." {
+		t.Fatalf("60.2: %+v", r)
+	}
+	if r := got["40 CFR 60.3"]; r.Status != RefReserved {
+		t.Fatalf("60.3: %+v", r)
+	}
+	if r := got["40 CFR part 61"]; r.Status != RefReserved || r.Heading != "PART 61 [RESERVED]" {
+		t.Fatalf("part 61: %+v", r)
+	}
+	if r := got["40 CFR 60.9"]; r.Status != RefMissing || r.From.Section != "60.1" {
+		t.Fatalf("60.9: %+v", r)
+	}
+
+	report, err = st.DanglingReferences(ctx, DanglingQuery{Agency: "two", Statuses: []string{RefMissing}})
+	if err != nil {
+		t.Fatalf("dangling references for two: %v", err)
+	}
+	if len(report.Agencies) != 1 || len(report.Agencies[0].References) != 1 || report.Agencies[0].Counts[RefMissing] != 1 {
+		t.Fatalf("unexpected report for two: %+v", report.Agencies)
+	}
+	if _, err := st.DanglingReferences(ctx, DanglingQuery{Agency: "nope"}); !errors.Is(err, ErrUnknownAgency) {
+		t.Fatalf("expected ErrUnknownAgency, got %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"ecfr-analytics/internal/ecfr"
+)
+
+// provenanceDDL holds the AUTH and SOURCE notes of the parts and subparts in
+// each title's latest snapshot, indexed along with its citations. The notes
+// are kept as text and parsed when read, so parsing can improve without
+// indexing again.
+const provenanceDDL = `
+CREATE TABLE IF NOT EXISTS provenance (
+  title_number INTEGER NOT NULL,
+  issue_date TEXT NOT NULL,
+  part TEXT NOT NULL,
+  type TEXT NOT NULL,
+  identifier TEXT NOT NULL,
+  heading TEXT NOT NULL,
+  authority TEXT NOT NULL,
+  source TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS provenance_part ON provenance(title_number, part);
+`
+
+// ProvenanceNote is the authority and source of a part or subpart. Statutes
+// and PublicLaws are parsed from Authority, FederalRegister from Source.
+type ProvenanceNote struct {
+	Type            string            `json:"type"`
+	Identifier      string            `json:"identifier"`
+	Heading         string            `json:"heading"`
+	Authority       string            `json:"authority,omitempty"`
+	Source          string            `json:"source,omitempty"`
+	Statutes        []ecfr.Citation   `json:"statutes"`
+	PublicLaws      []string          `json:"public_laws"`
+	FederalRegister []ecfr.FRCitation `json:"federal_register"`
+}
+
+// PartProvenance is a part of a title's latest indexed snapshot with the
+// notes of the part and of its subparts, the part's first.
+type PartProvenance struct {
+	Title    int              `json:"title"`
+	Date     string           `json:"date"`
+	Subtitle string           `json:"subtitle,omitempty"`
+	Chapter  string           `json:"chapter,omitempty"`
+	Part     string           `json:"part"`
+	Heading  string           `json:"heading"`
+	Agencies []string         `json:"agencies"`
+	Notes    []ProvenanceNote `json:"notes"`
+}
+
+// putProvenance replaces a title's notes with those of sections, the
+// divisions of its snapshot at date.
+func putProvenance(ctx context.Context, tx *sql.Tx, title int, date string, sections []ecfr.Section) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM provenance WHERE title_number=?`, title); err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, `
+INSERT INTO provenance(title_number, issue_date, part, type, identifier, heading, authority, source)
+VALUES(?,?,?,?,?,?,?,?)
+`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, sec := range sections {
+		if sec.Authority == "" && sec.Source == "" {
+			continue
+		}
+		if _, err := stmt.ExecContext(ctx, title, date, sec.Part, sec.Type, sec.Identifier, sec.Heading, sec.Authority, sec.Source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PartProvenance returns the notes of a part in the latest indexed snapshot
+// of title, or nil if that snapshot has no such part.
+func (s *Store) PartProvenance(ctx context.Context, title int, part string) (*PartProvenance, error) {
+	p := &PartProvenance{Title: title, Part: part, Notes: []ProvenanceNote{}}
+	err := s.db.QueryRowContext(ctx, `
+SELECT issue_date, subtitle, chapter, heading FROM cfr_sections
+WHERE title_number = ? AND type = 'PART' AND identifier = ?
+LIMIT 1
+`, title, part).Scan(&p.Date, &p.Subtitle, &p.Chapter, &p.Heading)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	owners, err := s.agencyChapters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.Agencies = owners.owning(title, p.Subtitle, p.Chapter)
+
+	rows, err := s.db.QueryContext(ctx, `
+SELECT type, identifier, heading, authority, source FROM provenance
+WHERE title_number = ? AND part = ?
+ORDER BY type = 'PART' DESC, rowid
+`, title, part)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var n ProvenanceNote
+		if err := rows.Scan(&n.Type, &n.Identifier, &n.Heading, &n.Authority, &n.Source); err != nil {
+			return nil, err
+		}
+		n.Statutes, n.PublicLaws = ecfr.ParseAuthority(n.Authority, title)
+		n.FederalRegister = ecfr.ParseFRCitations(n.Source)
+		if n.PublicLaws == nil {
+			n.PublicLaws = []string{}
+		}
+		if n.Statutes == nil {
+			n.Statutes = []ecfr.Citation{}
+		}
+		if n.FederalRegister == nil {
+			n.FederalRegister = []ecfr.FRCitation{}
+		}
+		p.Notes = append(p.Notes, n)
+	}
+	return p, rows.Err()
+}
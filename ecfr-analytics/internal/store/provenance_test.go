@@ -0,0 +1,68 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"ecfr-analytics/internal/ecfr"
+)
+
+func TestPartProvenance(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	if err := st.UpsertTitles(ctx, []ecfr.Title{{Number: 10, Name: "Energy", UpToDateAsOf: "2025-02-01"}}); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	if err := st.UpsertAgencies(ctx, []ecfr.Agency{
+		{Name: "Agency One", Slug: "one", CFRReferences: []ecfr.CFRRef{{Title: 10, Chapter: "I"}}},
+	}); err != nil {
+		t.Fatalf("upsert agencies: %v", err)
+	}
+	xml := []byte(`<ECFR><DIV1 N="10" TYPE="TITLE"><DIV3 N="I" TYPE="CHAPTER">
+<DIV5 N="2" TYPE="PART"><HEAD>PART 2—PROCEDURE</HEAD>
+<AUTH><HED>Authority:</HED><PSPACE>Atomic Energy Act of 1954, secs. 161, 181 (42 U.S.C. 2201, 2231); Pub. L. 104-134.</PSPACE></AUTH>
+<SOURCE><HED>Source:</HED><PSPACE>27 FR 377, Jan. 13, 1962, unless otherwise noted.</PSPACE></SOURCE>
+<DIV6 N="C" TYPE="SUBPART"><HEAD>Subpart C—Hearings</HEAD>
+<SOURCE><HED>Source:</HED><PSPACE>69 FR 2236, Jan. 14, 2004, unless otherwise noted.</PSPACE></SOURCE>
+<DIV8 N="2.300" TYPE="SECTION"><P>Scope.</P></DIV8>
+</DIV6>
+</DIV5>
+<DIV5 N="3" TYPE="PART"><HEAD>PART 3 [RESERVED]</HEAD></DIV5>
+</DIV3></DIV1></ECFR>`)
+	if err := st.SaveSnapshotFromReader(ctx, 10, "2025-02-01", bytes.NewReader(xml)); err != nil {
+		t.Fatalf("save snapshot: %v", err)
+	}
+	if _, err := st.IndexCitations(ctx, nil); err != nil {
+		t.Fatalf("index citations: %v", err)
+	}
+
+	p, err := st.PartProvenance(ctx, 10, "2")
+	if err != nil {
+		t.Fatalf("provenance: %v", err)
+	}
+	if p == nil || p.Date != "2025-02-01" || p.Chapter != "I" || p.Heading != "PART 2—PROCEDURE" || len(p.Agencies) != 1 || p.Agencies[0] != "one" {
+		t.Fatalf("unexpected part: %+v", p)
+	}
+	if len(p.Notes) != 2 || p.Notes[0].Type != "PART" || p.Notes[1].Type != "SUBPART" || p.Notes[1].Identifier != "C" {
+		t.Fatalf("unexpected notes: %+v", p.Notes)
+	}
+	part := p.Notes[0]
+	if len(part.Statutes) != 2 || part.Statutes[0].String() != "42 U.S.C. 2201" || len(part.PublicLaws) != 1 || part.PublicLaws[0] != "104-134" {
+		t.Fatalf("unexpected authority: %+v", part)
+	}
+	if len(part.FederalRegister) != 1 || part.FederalRegister[0] != (ecfr.FRCitation{Volume: 27, Page: 377, Date: "1962-01-13"}) {
+		t.Fatalf("unexpected source: %+v", part.FederalRegister)
+	}
+	if sub := p.Notes[1]; sub.Authority != "" || len(sub.Statutes) != 0 || sub.FederalRegister[0].Date != "2004-01-14" {
+		t.Fatalf("unexpected subpart note: %+v", sub)
+	}
+
+	if p, err := st.PartProvenance(ctx, 10, "3"); err != nil || p == nil || len(p.Notes) != 0 {
+		t.Fatalf("expected part 3 without notes, got %+v (%v)", p, err)
+	}
+	if p, err := st.PartProvenance(ctx, 10, "99"); err != nil || p != nil {
+		t.Fatalf("expected no part 99, got %+v (%v)", p, err)
+	}
+}
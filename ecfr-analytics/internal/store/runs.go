@@ -0,0 +1,149 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+const (
+	RunRunning   = "running"
+	RunOK        = "ok"
+	RunFailed    = "failed"
+	RunCancelled = "cancelled"
+)
+
+type RefreshRun struct {
+	ID            int64             `json:"id"`
+	Trigger       string            `json:"trigger"`
+	Status        string            `json:"status"`
+	Error         string            `json:"error,omitempty"`
+	StartedAt     string            `json:"started_at"`
+	FinishedAt    string            `json:"finished_at,omitempty"`
+	TitlesChecked int               `json:"titles_checked"`
+	Downloaded    int               `json:"downloaded"`
+	Failures      []SnapshotFailure `json:"failures"`
+	Report        any               `json:"report,omitempty"`
+}
+
+type SnapshotFailure struct {
+	Title int    `json:"title"`
+	Date  string `json:"date"`
+	Error string `json:"error"`
+}
+
+func (s *Store) StartRefreshRun(ctx context.Context, trigger string) (*RefreshRun, error) {
+	run := &RefreshRun{Trigger: trigger, Status: RunRunning, StartedAt: time.Now().Format(time.RFC3339), Failures: []SnapshotFailure{}}
+	res, err := s.db.ExecContext(ctx, `
+INSERT INTO refresh_runs(trigger, status, started_at, failures_json)
+VALUES(?,?,?,'[]')
+`, run.Trigger, run.Status, run.StartedAt)
+	if err != nil {
+		return nil, err
+	}
+	run.ID, err = res.LastInsertId()
+	return run, err
+}
+
+func (s *Store) FinishRefreshRun(ctx context.Context, run *RefreshRun) error {
+	run.FinishedAt = time.Now().Format(time.RFC3339)
+	failures, err := json.Marshal(run.Failures)
+	if err != nil {
+		return err
+	}
+	var report sql.NullString
+	if run.Report != nil {
+		b, err := json.Marshal(run.Report)
+		if err != nil {
+			return err
+		}
+		report = sql.NullString{String: string(b), Valid: true}
+	}
+	_, err = s.db.ExecContext(ctx, `
+UPDATE refresh_runs
+SET status=?, error=?, finished_at=?, titles_checked=?, downloaded=?, failures_json=?, report_json=?
+WHERE id=?
+`, run.Status, run.Error, run.FinishedAt, run.TitlesChecked, run.Downloaded, string(failures), report, run.ID)
+	return err
+}
+
+// FailInterruptedRuns marks runs still recorded as running as failed. It is
+// meant for startup, when no run can still be in progress, and returns the
+// number of runs marked.
+func (s *Store) FailInterruptedRuns(ctx context.Context) (int, error) {
+	res, err := s.db.ExecContext(ctx, `
+UPDATE refresh_runs
+SET status=?, error=?, finished_at=?
+WHERE status=?
+`, RunFailed, "interrupted: the server stopped before the run finished", time.Now().Format(time.RFC3339), RunRunning)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// ListRefreshRuns returns the most recent runs first, without their compute
+// reports.
+func (s *Store) ListRefreshRuns(ctx context.Context, limit int) ([]RefreshRun, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := s.db.QueryContext(ctx, `
+SELECT id, trigger, status, error, started_at, finished_at, titles_checked, downloaded, failures_json
+FROM refresh_runs
+ORDER BY id DESC
+LIMIT ?
+`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []RefreshRun{}
+	for rows.Next() {
+		run, err := scanRefreshRun(rows.Scan, false)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, run)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) GetRefreshRun(ctx context.Context, id int64) (RefreshRun, bool, error) {
+	row := s.db.QueryRowContext(ctx, `
+SELECT id, trigger, status, error, started_at, finished_at, titles_checked, downloaded, failures_json, report_json
+FROM refresh_runs
+WHERE id=?
+`, id)
+	run, err := scanRefreshRun(row.Scan, true)
+	if err == sql.ErrNoRows {
+		return RefreshRun{}, false, nil
+	}
+	if err != nil {
+		return RefreshRun{}, false, err
+	}
+	return run, true, nil
+}
+
+func scanRefreshRun(scan func(...any) error, withReport bool) (RefreshRun, error) {
+	var run RefreshRun
+	var errText, finished, report sql.NullString
+	var failures string
+	dest := []any{&run.ID, &run.Trigger, &run.Status, &errText, &run.StartedAt, &finished, &run.TitlesChecked, &run.Downloaded, &failures}
+	if withReport {
+		dest = append(dest, &report)
+	}
+	if err := scan(dest...); err != nil {
+		return run, err
+	}
+	run.Error = errText.String
+	run.FinishedAt = finished.String
+	run.Failures = []SnapshotFailure{}
+	_ = json.Unmarshal([]byte(failures), &run.Failures)
+	if report.Valid {
+		run.Report = json.RawMessage(report.String)
+	}
+	return run, nil
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestRefreshRunLifecycle(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	first, err := st.StartRefreshRun(ctx, "startup")
+	if err != nil {
+		t.Fatalf("start run: %v", err)
+	}
+	first.Status = RunOK
+	first.TitlesChecked = 49
+	first.Downloaded = 2
+	first.Failures = []SnapshotFailure{{Title: 40, Date: "2025-01-02", Error: "timeout"}}
+	first.Report = map[string]any{"summary": map[string]int{"agencies_ok": 3}}
+	if err := st.FinishRefreshRun(ctx, first); err != nil {
+		t.Fatalf("finish run: %v", err)
+	}
+	second, err := st.StartRefreshRun(ctx, "manual")
+	if err != nil {
+		t.Fatalf("start second run: %v", err)
+	}
+
+	runs, err := st.ListRefreshRuns(ctx, 10)
+	if err != nil {
+		t.Fatalf("list runs: %v", err)
+	}
+	if len(runs) != 2 || runs[0].ID != second.ID || runs[0].Status != RunRunning {
+		t.Fatalf("unexpected run list: %#v", runs)
+	}
+	if runs[1].Report != nil {
+		t.Fatalf("list should omit reports")
+	}
+
+	got, ok, err := st.GetRefreshRun(ctx, first.ID)
+	if err != nil || !ok {
+		t.Fatalf("get run: ok=%v err=%v", ok, err)
+	}
+	if got.Trigger != "startup" || got.FinishedAt == "" || got.TitlesChecked != 49 || got.Downloaded != 2 {
+		t.Fatalf("unexpected run: %#v", got)
+	}
+	if len(got.Failures) != 1 || got.Failures[0].Title != 40 {
+		t.Fatalf("unexpected failures: %#v", got.Failures)
+	}
+	var report struct {
+		Summary map[string]int `json:"summary"`
+	}
+	if err := json.Unmarshal(got.Report.(json.RawMessage), &report); err != nil || report.Summary["agencies_ok"] != 3 {
+		t.Fatalf("unexpected report: %v %#v", err, got.Report)
+	}
+
+	if _, ok, err := st.GetRefreshRun(ctx, 999); err != nil || ok {
+		t.Fatalf("expected missing run, ok=%v err=%v", ok, err)
+	}
+}
+
+func TestFailInterruptedRuns(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	done, err := st.StartRefreshRun(ctx, "startup")
+	if err != nil {
+		t.Fatalf("start run: %v", err)
+	}
+	done.Status = RunOK
+	if err := st.FinishRefreshRun(ctx, done); err != nil {
+		t.Fatalf("finish run: %v", err)
+	}
+	stale, err := st.StartRefreshRun(ctx, "manual")
+	if err != nil {
+		t.Fatalf("start stale run: %v", err)
+	}
+
+	if n, err := st.FailInterruptedRuns(ctx); err != nil || n != 1 {
+		t.Fatalf("fail interrupted runs: %d %v", n, err)
+	}
+	got, _, err := st.GetRefreshRun(ctx, stale.ID)
+	if err != nil || got.Status != RunFailed || got.Error == "" || got.FinishedAt == "" {
+		t.Fatalf("unexpected interrupted run: %#v %v", got, err)
+	}
+	if got, _, _ := st.GetRefreshRun(ctx, done.ID); got.Status != RunOK {
+		t.Fatalf("finished run should be left alone: %#v", got)
+	}
+}
@@ -0,0 +1,497 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"time"
+
+	"ecfr-analytics/internal/ecfr"
+)
+
+var (
+	ErrSearchUnavailable = errors.New("full-text search unavailable: sqlite was built without FTS5 (build with -tags sqlite_fts5)")
+	ErrInvalidQuery      = errors.New("invalid search query")
+	ErrUnknownAgency     = errors.New("unknown agency")
+)
+
+const sectionIndexBatch = 500
+
+// Snippet highlight delimiters; they cannot occur in XML text, so the snippet
+// can be HTML-escaped safely before they are swapped for <mark> tags.
+const (
+	markStart = "\x02"
+	markEnd   = "\x03"
+)
+
+// Section text is stored once per distinct content and linked to every
+// snapshot containing it, so unchanged sections cost nothing per backfilled
+// date. section_fts indexes it as an external-content FTS5 table. agencies
+// lists the slugs of the agencies whose CFR references cover the section,
+// separated by spaces; it is kept current with the agency catalog.
+const searchDDL = `
+CREATE TABLE IF NOT EXISTS section_text (
+  id INTEGER PRIMARY KEY,
+  title_number INTEGER NOT NULL,
+  subtitle TEXT NOT NULL,
+  chapter TEXT NOT NULL,
+  part TEXT NOT NULL,
+  type TEXT NOT NULL,
+  identifier TEXT NOT NULL,
+  heading TEXT NOT NULL,
+  body TEXT NOT NULL,
+  checksum TEXT NOT NULL UNIQUE,
+  agencies TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS section_text_owner ON section_text(title_number, subtitle, chapter);
+
+CREATE TABLE IF NOT EXISTS snapshot_sections (
+  title_number INTEGER NOT NULL,
+  issue_date TEXT NOT NULL,
+  section_id INTEGER NOT NULL,
+  PRIMARY KEY(title_number, issue_date, section_id),
+  FOREIGN KEY(section_id) REFERENCES section_text(id)
+);
+CREATE INDEX IF NOT EXISTS snapshot_sections_section ON snapshot_sections(section_id);
+
+CREATE TABLE IF NOT EXISTS search_indexed (
+  title_number INTEGER NOT NULL,
+  issue_date TEXT NOT NULL,
+  sections INTEGER NOT NULL,
+  indexed_at TEXT NOT NULL,
+  PRIMARY KEY(title_number, issue_date)
+);
+`
+
+const searchFTSDDL = `
+CREATE VIRTUAL TABLE IF NOT EXISTS section_fts USING fts5(
+  heading, body,
+  content='section_text', content_rowid='id',
+  tokenize='porter unicode61'
+);
+`
+
+func (s *Store) initSearchSchema() error {
+	owned, err := s.hasColumn("section_text", "agencies")
+	if err != nil {
+		return err
+	}
+	if !owned {
+		if ok, err := s.hasColumn("section_text", "id"); err != nil {
+			return err
+		} else if ok {
+			if _, err := s.db.Exec(`ALTER TABLE section_text ADD COLUMN agencies TEXT NOT NULL DEFAULT ''`); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := s.db.Exec(searchDDL); err != nil {
+		return err
+	}
+	if !owned {
+		if err := s.syncSectionAgencies(context.Background()); err != nil {
+			return err
+		}
+	}
+	_, err = s.db.Exec(searchFTSDDL)
+	if err != nil && strings.Contains(err.Error(), "no such module: fts5") {
+		s.fts = false
+		return nil
+	}
+	s.fts = err == nil
+	return err
+}
+
+func (s *Store) SearchAvailable() bool { return s.fts }
+
+// IndexPendingSections indexes the sections of every stored snapshot that is
+// not yet searchable, carrying on past snapshots that fail. It first brings
+// the indexed agencies up to date with the agency catalog and afterwards
+// drops section text no snapshot contains any more. It is a no-op without
+// FTS5.
+func (s *Store) IndexPendingSections(ctx context.Context, progress func(done, total int)) (int, error) {
+	if !s.fts {
+		return 0, nil
+	}
+	if err := s.syncSectionAgencies(ctx); err != nil {
+		return 0, err
+	}
+	rows, err := s.db.QueryContext(ctx, `
+SELECT s.title_number, s.issue_date FROM snapshots s
+LEFT JOIN search_indexed i ON i.title_number = s.title_number AND i.issue_date = s.issue_date
+WHERE i.title_number IS NULL
+ORDER BY s.issue_date DESC, s.title_number
+`)
+	if err != nil {
+		return 0, err
+	}
+	type pending struct {
+		title int
+		date  string
+	}
+	var todo []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.title, &p.date); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		todo = append(todo, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	indexed, failed := 0, 0
+	var firstErr error
+	for i, p := range todo {
+		if progress != nil {
+			progress(i, len(todo))
+		}
+		if err := s.IndexSnapshotSections(ctx, p.title, p.date); err != nil {
+			if ctx.Err() != nil {
+				return indexed, ctx.Err()
+			}
+			failed++
+			if firstErr == nil {
+				firstErr = fmt.Errorf("index title %d (%s): %w", p.title, p.date, err)
+			}
+			continue
+		}
+		indexed++
+	}
+	if progress != nil {
+		progress(len(todo), len(todo))
+	}
+	if err := s.pruneSections(ctx); err != nil {
+		return indexed, err
+	}
+	if failed > 0 {
+		return indexed, fmt.Errorf("%d of %d snapshots not indexed; first error: %w", failed, len(todo), firstErr)
+	}
+	return indexed, nil
+}
+
+// syncSectionAgencies sets the agencies of every stored section from the
+// current agency catalog.
+func (s *Store) syncSectionAgencies(ctx context.Context) error {
+	owners, err := s.agencyChapters(ctx)
+	if err != nil {
+		return err
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT title_number, subtitle, chapter FROM section_text`)
+	if err != nil {
+		return err
+	}
+	type owner struct {
+		title             int
+		subtitle, chapter string
+	}
+	var groups []owner
+	for rows.Next() {
+		var o owner
+		if err := rows.Scan(&o.title, &o.subtitle, &o.chapter); err != nil {
+			rows.Close()
+			return err
+		}
+		groups = append(groups, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, o := range groups {
+		agencies := strings.Join(owners.owning(o.title, o.subtitle, o.chapter), " ")
+		if _, err := tx.ExecContext(ctx, `
+UPDATE section_text SET agencies=?
+WHERE title_number=? AND subtitle=? AND chapter=? AND agencies<>?
+`, agencies, o.title, o.subtitle, o.chapter, agencies); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// pruneSections deletes the text, and its index entries, of sections that no
+// stored snapshot contains any more, such as the old wording of a snapshot
+// that was indexed again.
+func (s *Store) pruneSections(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO section_fts(section_fts, rowid, heading, body)
+SELECT 'delete', t.id, t.heading, t.body FROM section_text t
+WHERE NOT EXISTS (SELECT 1 FROM snapshot_sections ss WHERE ss.section_id = t.id)
+`); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+DELETE FROM section_text
+WHERE NOT EXISTS (SELECT 1 FROM snapshot_sections ss WHERE ss.section_id = section_text.id)
+`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// IndexSnapshotSections (re)builds the search index entries for one snapshot,
+// streaming it from disk and committing in batches so concurrent writers are
+// not starved.
+func (s *Store) IndexSnapshotSections(ctx context.Context, title int, date string) error {
+	if !s.fts {
+		return ErrSearchUnavailable
+	}
+	rc, err := s.OpenSnapshot(ctx, title, date)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	owners, err := s.agencyChapters(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM snapshot_sections WHERE title_number=? AND issue_date=?`, title, date); err != nil {
+		return err
+	}
+	count := 0
+	var batch []ecfr.Section
+	err = ecfr.ScanTitleSections(rc, func(sec ecfr.Section) error {
+		batch = append(batch, sec)
+		count++
+		if len(batch) < sectionIndexBatch {
+			return nil
+		}
+		err := s.putSnapshotSections(ctx, owners, title, date, batch)
+		batch = batch[:0]
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.putSnapshotSections(ctx, owners, title, date, batch); err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+INSERT INTO search_indexed(title_number, issue_date, sections, indexed_at)
+VALUES(?,?,?,?)
+ON CONFLICT(title_number, issue_date) DO UPDATE SET sections=excluded.sections, indexed_at=excluded.indexed_at
+`, title, date, count, time.Now().Format(time.RFC3339))
+	return err
+}
+
+func (s *Store) putSnapshotSections(ctx context.Context, owners agencyOwners, title int, date string, sections []ecfr.Section) error {
+	if len(sections) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, sec := range sections {
+		sum := ecfr.ChecksumHex(strings.Join([]string{
+			fmt.Sprint(title), sec.Subtitle, sec.Chapter, sec.Part, sec.Type, sec.Identifier, sec.Heading, sec.Text,
+		}, "\x1f"))
+		var id int64
+		err := tx.QueryRowContext(ctx, `SELECT id FROM section_text WHERE checksum=?`, sum).Scan(&id)
+		if err == sql.ErrNoRows {
+			res, err := tx.ExecContext(ctx, `
+INSERT INTO section_text(title_number, subtitle, chapter, part, type, identifier, heading, body, checksum, agencies)
+VALUES(?,?,?,?,?,?,?,?,?,?)
+`, title, sec.Subtitle, sec.Chapter, sec.Part, sec.Type, sec.Identifier, sec.Heading, sec.Text, sum,
+				strings.Join(owners.owning(title, sec.Subtitle, sec.Chapter), " "))
+			if err != nil {
+				return err
+			}
+			if id, err = res.LastInsertId(); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `INSERT INTO section_fts(rowid, heading, body) VALUES(?,?,?)`, id, sec.Heading, sec.Text); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+INSERT OR IGNORE INTO snapshot_sections(title_number, issue_date, section_id) VALUES(?,?,?)
+`, title, date, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+type SearchQuery struct {
+	Query  string
+	Title  int
+	Agency string
+	Date   string // as of; each title resolves to its latest indexed snapshot on or before it
+	Limit  int
+	Offset int
+}
+
+type SearchHit struct {
+	Title       int      `json:"title"`
+	Subtitle    string   `json:"subtitle,omitempty"`
+	Chapter     string   `json:"chapter,omitempty"`
+	Part        string   `json:"part,omitempty"`
+	Type        string   `json:"type"`
+	Identifier  string   `json:"identifier"`
+	Heading     string   `json:"heading"`
+	Date        string   `json:"date"`
+	Snippet     string   `json:"snippet"`
+	SnippetHTML string   `json:"snippet_html"`
+	Rank        float64  `json:"rank"`
+	Agencies    []string `json:"agencies"`
+}
+
+// Search runs an FTS5 query (terms, "phrases", AND/OR/NOT, prefix*, and
+// heading:/body: column filters) over section text, best matches first.
+func (s *Store) Search(ctx context.Context, q SearchQuery) ([]SearchHit, error) {
+	if !s.fts {
+		return nil, ErrSearchUnavailable
+	}
+	if strings.TrimSpace(q.Query) == "" {
+		return nil, fmt.Errorf("%w: empty query", ErrInvalidQuery)
+	}
+	if q.Limit <= 0 {
+		q.Limit = 50
+	}
+	if q.Date == "" {
+		q.Date = "9999-12-31"
+	}
+
+	where := []string{"1=1"}
+	args := []any{q.Query, q.Date}
+	if q.Title > 0 {
+		where = append(where, "t.title_number = ?")
+		args = append(args, q.Title)
+	}
+	if q.Agency != "" {
+		var n int
+		if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM agencies WHERE slug=?`, q.Agency).Scan(&n); err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownAgency, q.Agency)
+		}
+		where = append(where, "instr(' ' || t.agencies || ' ', ' ' || ? || ' ') > 0")
+		args = append(args, q.Agency)
+	}
+	args = append(args, q.Limit, q.Offset, q.Query)
+
+	// Rank matches first and filter/paginate them before computing snippets;
+	// letting the planner drive from snapshot_sections probes the FTS index
+	// once per stored section.
+	rows, err := s.db.QueryContext(ctx, `
+WITH matches AS MATERIALIZED (
+  SELECT rowid AS id, bm25(section_fts, 5.0, 1.0) AS rank FROM section_fts WHERE section_fts MATCH ?
+),
+cur AS MATERIALIZED (
+  SELECT title_number, MAX(issue_date) AS issue_date FROM search_indexed
+  WHERE issue_date <= ? GROUP BY title_number
+),
+page AS MATERIALIZED (
+  SELECT t.id, t.title_number, t.subtitle, t.chapter, t.part, t.type, t.identifier, t.heading, t.agencies, cur.issue_date, m.rank
+  FROM matches m
+  JOIN section_text t ON t.id = m.id
+  JOIN cur ON cur.title_number = t.title_number
+  JOIN snapshot_sections ss ON ss.title_number = cur.title_number AND ss.issue_date = cur.issue_date AND ss.section_id = t.id
+  WHERE `+strings.Join(where, " AND ")+`
+  ORDER BY m.rank
+  LIMIT ? OFFSET ?
+)
+SELECT p.title_number, p.subtitle, p.chapter, p.part, p.type, p.identifier, p.heading, p.agencies, p.issue_date,
+  snippet(section_fts, -1, '`+markStart+`', '`+markEnd+`', '…', 24), p.rank
+FROM page p
+JOIN section_fts ON section_fts.rowid = p.id
+WHERE section_fts MATCH ?
+ORDER BY p.rank
+`, args...)
+	if err != nil {
+		return nil, searchError(err)
+	}
+	defer rows.Close()
+
+	out := []SearchHit{}
+	for rows.Next() {
+		var h SearchHit
+		var agencies, snippet string
+		if err := rows.Scan(&h.Title, &h.Subtitle, &h.Chapter, &h.Part, &h.Type, &h.Identifier, &h.Heading, &agencies, &h.Date, &snippet, &h.Rank); err != nil {
+			return nil, err
+		}
+		h.Snippet = strings.NewReplacer(markStart, "", markEnd, "").Replace(snippet)
+		h.SnippetHTML = strings.NewReplacer(markStart, "<mark>", markEnd, "</mark>").Replace(html.EscapeString(snippet))
+		h.Agencies = strings.Fields(agencies)
+		out = append(out, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, searchError(err)
+	}
+	return out, nil
+}
+
+func searchError(err error) error {
+	msg := err.Error()
+	if strings.Contains(msg, "fts5") || strings.Contains(msg, "syntax error") || strings.Contains(msg, "unterminated string") || strings.Contains(msg, "no such column") {
+		return fmt.Errorf("%w: %s", ErrInvalidQuery, msg)
+	}
+	return err
+}
+
+type agencyOwners struct {
+	refs  map[string][]ecfr.CFRRef
+	names map[string]string
+}
+
+// agencyChapters flattens the stored agency tree into each agency's CFR
+// references and name, keyed by slug.
+func (s *Store) agencyChapters(ctx context.Context) (agencyOwners, error) {
+	roots, err := s.RootAgencies(ctx)
+	if err != nil {
+		return agencyOwners{}, err
+	}
+	owners := agencyOwners{refs: map[string][]ecfr.CFRRef{}, names: map[string]string{}}
+	var walk func(a ecfr.Agency)
+	walk = func(a ecfr.Agency) {
+		owners.refs[a.Slug] = append(owners.refs[a.Slug], a.CFRReferences...)
+		owners.names[a.Slug] = a.Name
+		for _, c := range a.Children {
+			walk(c)
+		}
+	}
+	for _, a := range roots {
+		walk(a)
+	}
+	return owners, nil
+}
+
+func (o agencyOwners) owning(title int, subtitle, chapter string) []string {
+	out := []string{}
+	for slug, refs := range o.refs {
+		for _, r := range refs {
+			if r.Covers(title, subtitle, chapter) {
+				out = append(out, slug)
+				break
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,136 @@
+package store
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ecfr-analytics/internal/ecfr"
+)
+
+func TestSearchSections(t *testing.T) {
+	st := newTestStore(t)
+	if !st.SearchAvailable() {
+		if _, err := st.Search(context.Background(), SearchQuery{Query: "x"}); !errors.Is(err, ErrSearchUnavailable) {
+			t.Fatalf("expected ErrSearchUnavailable, got %v", err)
+		}
+		t.Skip("sqlite built without FTS5; run with -tags sqlite_fts5")
+	}
+	ctx := context.Background()
+
+	if err := st.UpsertTitles(ctx, []ecfr.Title{{Number: 7, Name: "Agriculture", UpToDateAsOf: "2025-02-01"}}); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	if err := st.UpsertAgencies(ctx, []ecfr.Agency{
+		{Name: "Agency One", Slug: "one", CFRReferences: []ecfr.CFRRef{{Title: 7, Chapter: "I"}}},
+		{Name: "Agency Two", Slug: "two", CFRReferences: []ecfr.CFRRef{{Title: 7, Chapter: "II"}}},
+	}); err != nil {
+		t.Fatalf("upsert agencies: %v", err)
+	}
+
+	v1 := []byte(`<ECFR><DIV1 N="7" TYPE="TITLE">
+<DIV3 N="I" TYPE="CHAPTER"><DIV5 N="1" TYPE="PART">
+<DIV8 N="1.1" TYPE="SECTION"><HEAD>§ 1.1 Recordkeeping.</HEAD><P>Each handler must keep records for three years.</P></DIV8>
+<DIV8 N="1.2" TYPE="SECTION"><HEAD>§ 1.2 Reports.</HEAD><P>File an annual report.</P></DIV8>
+</DIV5></DIV3>
+<DIV3 N="II" TYPE="CHAPTER"><DIV5 N="200" TYPE="PART">
+<DIV8 N="200.1" TYPE="SECTION"><HEAD>§ 200.1 Scope.</HEAD><P>Records of sales are kept by the seller.</P></DIV8>
+</DIV5></DIV3>
+</DIV1></ECFR>`)
+	v2 := bytes.Replace(v1, []byte("three years"), []byte("five years"), 1)
+	for d, xml := range map[string][]byte{"2025-01-01": v1, "2025-02-01": v2} {
+		if err := st.SaveSnapshotFromReader(ctx, 7, d, bytes.NewReader(xml)); err != nil {
+			t.Fatalf("save snapshot: %v", err)
+		}
+	}
+	n, err := st.IndexPendingSections(ctx, nil)
+	if err != nil || n != 2 {
+		t.Fatalf("index pending: %d %v", n, err)
+	}
+	if n, err := st.IndexPendingSections(ctx, nil); err != nil || n != 0 {
+		t.Fatalf("expected nothing pending, got %d %v", n, err)
+	}
+	var stored int
+	if err := st.DB().QueryRow(`SELECT COUNT(*) FROM section_text`).Scan(&stored); err != nil || stored != 4 {
+		t.Fatalf("expected unchanged sections to be shared, got %d rows (%v)", stored, err)
+	}
+
+	hits, err := st.Search(ctx, SearchQuery{Query: "records"})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(hits) != 2 {
+		t.Fatalf("expected 2 hits, got %#v", hits)
+	}
+	for _, h := range hits {
+		if h.Date != "2025-02-01" {
+			t.Fatalf("expected latest snapshot, got %#v", h)
+		}
+	}
+	if hits[0].Identifier != "1.1" {
+		t.Fatalf("heading match should rank first: %#v", hits)
+	}
+	if len(hits[0].Agencies) != 1 || hits[0].Agencies[0] != "one" {
+		t.Fatalf("unexpected agencies: %#v", hits[0].Agencies)
+	}
+	if hits[0].SnippetHTML == hits[0].Snippet || !bytes.Contains([]byte(hits[0].SnippetHTML), []byte("<mark>")) {
+		t.Fatalf("expected highlighted snippet: %q", hits[0].SnippetHTML)
+	}
+
+	hits, err = st.Search(ctx, SearchQuery{Query: `"three years"`, Date: "2025-01-15"})
+	if err != nil || len(hits) != 1 || hits[0].Date != "2025-01-01" {
+		t.Fatalf("as-of phrase search: %#v %v", hits, err)
+	}
+	if hits, err := st.Search(ctx, SearchQuery{Query: `"three years"`}); err != nil || len(hits) != 0 {
+		t.Fatalf("old wording should not match latest: %#v %v", hits, err)
+	}
+	hits, err = st.Search(ctx, SearchQuery{Query: "records NOT handler", Agency: "two"})
+	if err != nil || len(hits) != 1 || hits[0].Identifier != "200.1" {
+		t.Fatalf("agency boolean search: %#v %v", hits, err)
+	}
+	if _, err := st.Search(ctx, SearchQuery{Query: "records", Agency: "nope"}); !errors.Is(err, ErrUnknownAgency) {
+		t.Fatalf("expected ErrUnknownAgency, got %v", err)
+	}
+	if _, err := st.Search(ctx, SearchQuery{Query: `"unbalanced`}); !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("expected ErrInvalidQuery, got %v", err)
+	}
+
+	// Agencies are indexed with the sections and follow the catalog.
+	if err := st.UpsertAgencies(ctx, []ecfr.Agency{
+		{Name: "Agency Three", Slug: "three", CFRReferences: []ecfr.CFRRef{{Title: 7, Chapter: "I"}}},
+	}); err != nil {
+		t.Fatalf("upsert agencies: %v", err)
+	}
+	if _, err := st.IndexPendingSections(ctx, nil); err != nil {
+		t.Fatalf("sync agencies: %v", err)
+	}
+	hits, err = st.Search(ctx, SearchQuery{Query: "records", Agency: "three"})
+	if err != nil || len(hits) != 1 || hits[0].Identifier != "1.1" || len(hits[0].Agencies) != 2 || hits[0].Agencies[1] != "three" {
+		t.Fatalf("expected the new agency to be indexed: %#v %v", hits, err)
+	}
+
+	// Indexing a snapshot again drops wording no snapshot contains any more.
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write(v2)
+	_ = zw.Close()
+	if err := os.WriteFile(filepath.Join(st.DataDir(), "xml", "title-7_2025-01-01.xml.gz"), gz.Bytes(), 0o644); err != nil {
+		t.Fatalf("rewrite snapshot: %v", err)
+	}
+	if err := st.IndexSnapshotSections(ctx, 7, "2025-01-01"); err != nil {
+		t.Fatalf("reindex: %v", err)
+	}
+	if _, err := st.IndexPendingSections(ctx, nil); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if err := st.DB().QueryRow(`SELECT COUNT(*) FROM section_text`).Scan(&stored); err != nil || stored != 3 {
+		t.Fatalf("expected the replaced wording to be pruned, got %d rows (%v)", stored, err)
+	}
+	if hits, err := st.Search(ctx, SearchQuery{Query: `"three years"`, Date: "2025-01-15"}); err != nil || len(hits) != 0 {
+		t.Fatalf("pruned wording should not match: %#v %v", hits, err)
+	}
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
 	"context"
@@ -10,6 +11,9 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"ecfr-analytics/internal/ecfr"
@@ -18,19 +22,50 @@ import (
 type Store struct {
 	db      *sql.DB
 	dataDir string
+	fts     bool
+	profile *ecfr.TextProfile
+	terms   *ecfr.RestrictionMatcher
 }
 
 func New(db *sql.DB, dataDir string) *Store {
-	return &Store{db: db, dataDir: dataDir}
+	return &Store{
+		db:      db,
+		dataDir: dataDir,
+		profile: ecfr.DefaultTextProfile,
+		terms:   ecfr.NewRestrictionMatcher(ecfr.DefaultRestrictionTerms),
+	}
+}
+
+// SetTextProfile changes the text profile snapshots are summarized with; nil
+// restores ecfr.DefaultTextProfile. Call it before any snapshot is saved or
+// metric computed; summaries counted with another profile are ignored and
+// metric values record the profile they were stored under.
+func (s *Store) SetTextProfile(p *ecfr.TextProfile) {
+	if p == nil {
+		p = ecfr.DefaultTextProfile
+	}
+	s.profile = p
 }
 
+func (s *Store) TextProfile() *ecfr.TextProfile { return s.profile }
+
+// SetRestrictionTerms replaces the terms behind restriction counts. Like
+// SetTextProfile, call it before any snapshot is saved or metric computed;
+// part counts made with other terms are recounted when next needed.
+func (s *Store) SetRestrictionTerms(terms []string) {
+	s.terms = ecfr.NewRestrictionMatcher(terms)
+}
+
+func (s *Store) RestrictionTerms() []string { return s.terms.Terms() }
+
 func (s *Store) InitSchema() error {
 	ddl := `
 CREATE TABLE IF NOT EXISTS agencies (
   slug TEXT PRIMARY KEY,
   name TEXT NOT NULL,
   json TEXT NOT NULL,
-  updated_at TEXT NOT NULL
+  updated_at TEXT NOT NULL,
+  parent_slug TEXT
 );
 
 CREATE TABLE IF NOT EXISTS titles (
@@ -56,23 +91,328 @@ CREATE TABLE IF NOT EXISTS agency_metrics (
   agency_slug TEXT NOT NULL,
   issue_date TEXT NOT NULL,
   metric TEXT NOT NULL,
+  scope TEXT NOT NULL DEFAULT 'own',
   value_num REAL,
   value_text TEXT,
   created_at TEXT NOT NULL,
-  UNIQUE(agency_slug, issue_date, metric),
+  text_profile TEXT NOT NULL DEFAULT '',
+  attribution TEXT NOT NULL DEFAULT '',
+  UNIQUE(agency_slug, issue_date, metric, scope, text_profile),
   FOREIGN KEY(agency_slug) REFERENCES agencies(slug)
 );
 
+CREATE TABLE IF NOT EXISTS refresh_runs (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  trigger TEXT NOT NULL,
+  status TEXT NOT NULL,
+  error TEXT,
+  started_at TEXT NOT NULL,
+  finished_at TEXT,
+  titles_checked INTEGER NOT NULL DEFAULT 0,
+  downloaded INTEGER NOT NULL DEFAULT 0,
+  failures_json TEXT NOT NULL,
+  report_json TEXT
+);
+
 CREATE TABLE IF NOT EXISTS app_state (
   key TEXT PRIMARY KEY,
   value TEXT NOT NULL,
   updated_at TEXT NOT NULL
 );
 `
-	_, err := s.db.Exec(ddl)
+	if _, err := s.db.Exec(ddl); err != nil {
+		return err
+	}
+	if err := s.migrateAgencies(); err != nil {
+		return err
+	}
+	if err := s.pruneLeafRollups(); err != nil {
+		return err
+	}
+	if err := s.initTextStats(); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(aggregatesDDL); err != nil {
+		return err
+	}
+	if err := s.migrateTextProfiles(); err != nil {
+		return err
+	}
+	if err := s.migrateChapterPositions(); err != nil {
+		return err
+	}
+	if err := s.migrateProfileKeys(); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(citationsDDL); err != nil {
+		return err
+	}
+	if err := s.migrateCitationRanges(); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(provenanceDDL); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(amendmentsDDL); err != nil {
+		return err
+	}
+	return s.initSearchSchema()
+}
+
+// migrateAgencies brings databases created before agency hierarchies up to
+// date: agencies gains parent_slug, and agency_metrics is rebuilt with a scope
+// column, existing rows becoming ScopeOwn values of legacyProfile.
+func (s *Store) migrateAgencies() error {
+	ok, err := s.hasColumn("agencies", "parent_slug")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if _, err := s.db.Exec(`ALTER TABLE agencies ADD COLUMN parent_slug TEXT`); err != nil {
+			return err
+		}
+	}
+	if ok, err = s.hasColumn("agency_metrics", "scope"); err != nil || ok {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = rebuildAgencyMetrics(tx, `
+INSERT INTO agency_metrics(id, agency_slug, issue_date, metric, value_num, value_text, created_at, text_profile)
+SELECT id, agency_slug, issue_date, metric, value_num, value_text, created_at, ? FROM agency_metrics_old`, legacyProfile())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// rebuildAgencyMetrics recreates agency_metrics with the current schema,
+// filling it from the old table, agency_metrics_old, with copy and args.
+func rebuildAgencyMetrics(tx *sql.Tx, copy string, args ...any) error {
+	for _, q := range []string{
+		`ALTER TABLE agency_metrics RENAME TO agency_metrics_old`,
+		`CREATE TABLE agency_metrics (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  agency_slug TEXT NOT NULL,
+  issue_date TEXT NOT NULL,
+  metric TEXT NOT NULL,
+  scope TEXT NOT NULL DEFAULT 'own',
+  value_num REAL,
+  value_text TEXT,
+  created_at TEXT NOT NULL,
+  text_profile TEXT NOT NULL DEFAULT '',
+  attribution TEXT NOT NULL DEFAULT '',
+  UNIQUE(agency_slug, issue_date, metric, scope, text_profile),
+  FOREIGN KEY(agency_slug) REFERENCES agencies(slug)
+)`,
+	} {
+		if _, err := tx.Exec(q); err != nil {
+			return fmt.Errorf("migrate agency_metrics: %w", err)
+		}
+	}
+	if _, err := tx.Exec(copy, args...); err != nil {
+		return fmt.Errorf("migrate agency_metrics: %w", err)
+	}
+	if _, err := tx.Exec(`DROP TABLE agency_metrics_old`); err != nil {
+		return fmt.Errorf("migrate agency_metrics: %w", err)
+	}
+	return nil
+}
+
+// legacyProfile is the text profile of metric values stored before values
+// recorded theirs, which were all counted with ecfr.DefaultTextProfile.
+func legacyProfile() string { return ecfr.DefaultTextProfile.String() }
+
+// pruneLeafRollups deletes rollup values of agencies without sub-agencies,
+// which earlier computations stored as copies of their own values.
+func (s *Store) pruneLeafRollups() error {
+	if _, err := s.db.Exec(`CREATE INDEX IF NOT EXISTS agencies_parent ON agencies(parent_slug)`); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`
+DELETE FROM agency_metrics
+WHERE scope=? AND NOT EXISTS (SELECT 1 FROM agencies c WHERE c.parent_slug = agency_metrics.agency_slug)
+`, ScopeRollup)
 	return err
 }
 
+// migrateTextProfiles adds text_profile to metric tables created before text
+// profiles, their values taking legacyProfile, and attribution to
+// agency_metrics.
+func (s *Store) migrateTextProfiles() error {
+	for _, table := range []string{"agency_metrics", "title_metrics", "chapter_metrics"} {
+		ok, err := s.hasColumn(table, "text_profile")
+		if err != nil {
+			return err
+		}
+		if ok {
+			continue
+		}
+		if _, err := s.db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN text_profile TEXT NOT NULL DEFAULT ''`); err != nil {
+			return fmt.Errorf("migrate %s: %w", table, err)
+		}
+		if _, err := s.db.Exec(`UPDATE `+table+` SET text_profile=?`, legacyProfile()); err != nil {
+			return fmt.Errorf("migrate %s: %w", table, err)
+		}
+	}
+	ok, err := s.hasColumn("agency_metrics", "attribution")
+	if err != nil || ok {
+		return err
+	}
+	// Values stored before the mode was recorded keep an empty one.
+	if _, err := s.db.Exec(`ALTER TABLE agency_metrics ADD COLUMN attribution TEXT NOT NULL DEFAULT ''`); err != nil {
+		return fmt.Errorf("migrate agency_metrics: %w", err)
+	}
+	return nil
+}
+
+// migrateProfileKeys adds text_profile to the key of agency_metrics, so that
+// values computed with different profiles are kept side by side. Databases
+// keyed without it may hold values stored under an empty profile; they take
+// legacyProfile in every metric table.
+func (s *Store) migrateProfileKeys() error {
+	var keyed int
+	err := s.db.QueryRow(`
+SELECT COUNT(*) FROM pragma_index_list('agency_metrics') l, pragma_index_info(l.name) i
+WHERE l."unique" = 1 AND l.origin = 'u' AND i.name = 'text_profile'
+`).Scan(&keyed)
+	if err != nil || keyed > 0 {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = rebuildAgencyMetrics(tx, `
+INSERT INTO agency_metrics(id, agency_slug, issue_date, metric, scope, value_num, value_text, created_at, text_profile, attribution)
+SELECT id, agency_slug, issue_date, metric, scope, value_num, value_text, created_at,
+  CASE WHEN text_profile = '' THEN ? ELSE text_profile END, attribution
+FROM agency_metrics_old`, legacyProfile())
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"title_metrics", "chapter_metrics"} {
+		if _, err := tx.Exec(`UPDATE `+table+` SET text_profile=? WHERE text_profile=''`, legacyProfile()); err != nil {
+			return fmt.Errorf("migrate %s: %w", table, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Store) hasColumn(table, column string) (bool, error) {
+	rows, err := s.db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// textStatsDDL creates the per-snapshot text summaries, which are caches
+// derived from the snapshots. content_indexed marks the snapshots whose
+// chapters and parts have been summarized, since a snapshot may have none.
+const textStatsDDL = `
+CREATE TABLE IF NOT EXISTS content_indexed (
+  title_number INTEGER NOT NULL,
+  issue_date TEXT NOT NULL,
+  text_profile TEXT NOT NULL,
+  terms_key TEXT NOT NULL DEFAULT '',
+  PRIMARY KEY(title_number, issue_date)
+);
+
+CREATE TABLE IF NOT EXISTS chapter_content (
+  title_number INTEGER NOT NULL,
+  issue_date TEXT NOT NULL,
+  chapter TEXT NOT NULL,
+  subtitle TEXT NOT NULL DEFAULT '',
+  position INTEGER NOT NULL DEFAULT 0,
+  checksum TEXT NOT NULL,
+  word_count INTEGER NOT NULL,
+  sentence_count INTEGER NOT NULL,
+  syllable_count INTEGER NOT NULL,
+  polysyllable_count INTEGER NOT NULL,
+  letter_count INTEGER NOT NULL,
+  text_profile TEXT NOT NULL,
+  PRIMARY KEY(title_number, issue_date, chapter),
+  FOREIGN KEY(title_number) REFERENCES titles(number)
+);
+
+CREATE TABLE IF NOT EXISTS part_content (
+  title_number INTEGER NOT NULL,
+  issue_date TEXT NOT NULL,
+  chapter TEXT NOT NULL,
+  part TEXT NOT NULL,
+  terms_key TEXT NOT NULL,
+  text_profile TEXT NOT NULL,
+  word_count INTEGER NOT NULL,
+  restriction_count INTEGER NOT NULL,
+  PRIMARY KEY(title_number, issue_date, chapter, part),
+  FOREIGN KEY(title_number) REFERENCES titles(number)
+);
+`
+
+// initTextStats creates chapter_content and part_content, dropping them first
+// if they were counted by an older ecfr.TextStatsVersion or predate text
+// profiles. Metrics computation refills them from the snapshots.
+func (s *Store) initTextStats() error {
+	ctx := context.Background()
+	version := strconv.Itoa(ecfr.TextStatsVersion)
+	stored, err := s.GetState(ctx, "chapter_stats_version")
+	if err != nil {
+		return err
+	}
+	profiled, err := s.hasColumn("chapter_content", "text_profile")
+	if err != nil {
+		return err
+	}
+	if stored != version || !profiled {
+		if _, err := s.db.Exec(`DROP TABLE IF EXISTS chapter_content; DROP TABLE IF EXISTS part_content; DROP TABLE IF EXISTS content_indexed`); err != nil {
+			return err
+		}
+	}
+	marked, err := s.hasColumn("content_indexed", "title_number")
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(textStatsDDL); err != nil {
+		return err
+	}
+	if !marked {
+		// Summaries stored before the markers existed are still valid; their
+		// part counts are redone on the next computation.
+		if _, err := s.db.Exec(`INSERT OR IGNORE INTO content_indexed(title_number, issue_date, text_profile)
+SELECT DISTINCT title_number, issue_date, text_profile FROM chapter_content`); err != nil {
+			return err
+		}
+	}
+	keyed, err := s.hasColumn("content_indexed", "terms_key")
+	if err != nil {
+		return err
+	}
+	if !keyed {
+		if _, err := s.db.Exec(`ALTER TABLE content_indexed ADD COLUMN terms_key TEXT NOT NULL DEFAULT ''`); err != nil {
+			return err
+		}
+	}
+	if stored == version {
+		return nil
+	}
+	return s.SetState(ctx, "chapter_stats_version", version)
+}
+
 func (s *Store) SetState(ctx context.Context, key, value string) error {
 	now := time.Now().Format(time.RFC3339)
 	_, err := s.db.ExecContext(ctx, `
@@ -101,18 +441,32 @@ func (s *Store) UpsertAgencies(ctx context.Context, agencies []ecfr.Agency) erro
 	defer tx.Rollback()
 
 	stmt, err := tx.PrepareContext(ctx, `
-INSERT INTO agencies(slug, name, json, updated_at)
-VALUES(?,?,?,?)
-ON CONFLICT(slug) DO UPDATE SET name=excluded.name, json=excluded.json, updated_at=excluded.updated_at
+INSERT INTO agencies(slug, name, json, updated_at, parent_slug)
+VALUES(?,?,?,?,?)
+ON CONFLICT(slug) DO UPDATE SET name=excluded.name, json=excluded.json, updated_at=excluded.updated_at, parent_slug=excluded.parent_slug
 `)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	for _, a := range agencies {
+	// Every agency in the tree gets a row so sub-agencies can hold metrics;
+	// each row's json keeps its own subtree.
+	var put func(a ecfr.Agency, parent *string) error
+	put = func(a ecfr.Agency, parent *string) error {
 		b, _ := json.Marshal(a)
-		if _, err := stmt.ExecContext(ctx, a.Slug, a.Name, string(b), now); err != nil {
+		if _, err := stmt.ExecContext(ctx, a.Slug, a.Name, string(b), now, parent); err != nil {
+			return err
+		}
+		for _, c := range a.Children {
+			if err := put(c, &a.Slug); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, a := range agencies {
+		if err := put(a, nil); err != nil {
 			return err
 		}
 	}
@@ -187,16 +541,35 @@ func (s *Store) SaveSnapshotFromReader(ctx context.Context, title int, date stri
 		_ = os.Remove(tmpPath)
 	}()
 
+	type scanResult struct {
+		chapters map[string]ecfr.ChapterStats
+		parts    []ecfr.PartStats
+		err      error
+	}
+	pr, pw := io.Pipe()
+	scanCh := make(chan scanResult, 1)
+	go func() {
+		chapters, parts, err := ecfr.ScanTitleContent(pr, s.profile, s.terms)
+		_, _ = io.Copy(io.Discard, pr)
+		scanCh <- scanResult{chapters, parts, err}
+	}()
+
 	gz := gzip.NewWriter(tmp)
 	const maxXMLSize = 300 << 20
-	n, err := io.Copy(gz, io.LimitReader(r, maxXMLSize+1))
+	n, err := io.Copy(gz, io.TeeReader(io.LimitReader(r, maxXMLSize+1), pw))
 	if err == nil && n > maxXMLSize {
 		err = fmt.Errorf("snapshot too large")
 	}
+	_ = pw.CloseWithError(err)
+	scan := <-scanCh
 	if err != nil {
 		_ = gz.Close()
 		return err
 	}
+	if scan.err != nil {
+		_ = gz.Close()
+		return fmt.Errorf("parse title %d (%s): %w", title, date, scan.err)
+	}
 	if err := gz.Close(); err != nil {
 		return err
 	}
@@ -214,24 +587,208 @@ func (s *Store) SaveSnapshotFromReader(ctx context.Context, title int, date stri
 INSERT INTO snapshots(title_number, issue_date, file_path, created_at)
 VALUES(?,?,?,?)
 `, title, date, path, time.Now().Format(time.RFC3339))
-	return err
+	if err != nil {
+		return err
+	}
+	return s.PutContent(ctx, title, date, scan.chapters, scan.parts)
+}
+
+// IndexSnapshotContent summarizes a stored snapshot's chapters and parts in
+// one pass and stores them, for snapshots saved before the current text
+// profile or restriction terms. It returns sql.ErrNoRows if the snapshot has
+// not been downloaded.
+func (s *Store) IndexSnapshotContent(ctx context.Context, title int, date string) (map[string]ecfr.ChapterStats, []ecfr.PartStats, error) {
+	rc, err := s.OpenSnapshot(ctx, title, date)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rc.Close()
+	chapters, parts, err := ecfr.ScanTitleContent(rc, s.profile, s.terms)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse title %d (%s): %w", title, date, err)
+	}
+	if err := s.PutContent(ctx, title, date, chapters, parts); err != nil {
+		return nil, nil, err
+	}
+	return chapters, parts, nil
+}
+
+// PutContent replaces a snapshot's chapter and part summaries, which must
+// have been counted with the store's text profile and restriction terms.
+func (s *Store) PutContent(ctx context.Context, title int, date string, chapters map[string]ecfr.ChapterStats, parts []ecfr.PartStats) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM chapter_content WHERE title_number=? AND issue_date=?`, title, date); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM part_content WHERE title_number=? AND issue_date=?`, title, date); err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, `
+INSERT INTO chapter_content(title_number, issue_date, chapter, subtitle, position, checksum, word_count, sentence_count, syllable_count, polysyllable_count, letter_count, text_profile)
+VALUES(?,?,?,?,?,?,?,?,?,?,?,?)
+`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	profile := s.profile.String()
+	for ch, cs := range chapters {
+		if _, err := stmt.ExecContext(ctx, title, date, ch, cs.Subtitle, cs.Position, cs.Checksum, cs.Words, cs.Sentences, cs.Syllables, cs.Polysyllables, cs.Letters, profile); err != nil {
+			return err
+		}
+	}
+	partStmt, err := tx.PrepareContext(ctx, `
+INSERT INTO part_content(title_number, issue_date, chapter, part, terms_key, text_profile, word_count, restriction_count)
+VALUES(?,?,?,?,?,?,?,?)
+`)
+	if err != nil {
+		return err
+	}
+	defer partStmt.Close()
+
+	termsKey := s.terms.Key()
+	for _, p := range parts {
+		if _, err := partStmt.ExecContext(ctx, title, date, p.Chapter, p.Part, termsKey, profile, p.Words, p.Restrictions); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO content_indexed(title_number, issue_date, text_profile, terms_key) VALUES(?,?,?,?)
+ON CONFLICT(title_number, issue_date) DO UPDATE SET text_profile=excluded.text_profile, terms_key=excluded.terms_key
+`, title, date, profile, termsKey); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ChapterContent returns the stored chapter summaries for a snapshot. ok is
+// false if the snapshot has not been indexed with the store's text profile;
+// an indexed snapshot may have no chapters.
+func (s *Store) ChapterContent(ctx context.Context, title int, date string) (chapters map[string]ecfr.ChapterStats, ok bool, err error) {
+	var n int
+	err = s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM content_indexed WHERE title_number=? AND issue_date=? AND text_profile=?`,
+		title, date, s.profile.String()).Scan(&n)
+	if err != nil || n == 0 {
+		return nil, false, err
+	}
+	rows, err := s.db.QueryContext(ctx, `
+SELECT chapter, subtitle, position, checksum, word_count, sentence_count, syllable_count, polysyllable_count, letter_count
+FROM chapter_content
+WHERE title_number=? AND issue_date=? AND text_profile=?
+`, title, date, s.profile.String())
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	out := map[string]ecfr.ChapterStats{}
+	for rows.Next() {
+		var ch string
+		var cs ecfr.ChapterStats
+		if err := rows.Scan(&ch, &cs.Subtitle, &cs.Position, &cs.Checksum, &cs.Words, &cs.Sentences, &cs.Syllables, &cs.Polysyllables, &cs.Letters); err != nil {
+			return nil, false, err
+		}
+		out[ch] = cs
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	return out, true, nil
+}
+
+// PartContent returns the stored part summaries for a snapshot. ok is false
+// if the snapshot has not been indexed with the store's text profile and
+// restriction terms.
+func (s *Store) PartContent(ctx context.Context, title int, date string) (parts []ecfr.PartStats, ok bool, err error) {
+	var n int
+	err = s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM content_indexed WHERE title_number=? AND issue_date=? AND text_profile=? AND terms_key=?`,
+		title, date, s.profile.String(), s.terms.Key()).Scan(&n)
+	if err != nil || n == 0 {
+		return nil, false, err
+	}
+	rows, err := s.db.QueryContext(ctx, `
+SELECT chapter, part, word_count, restriction_count FROM part_content
+WHERE title_number=? AND issue_date=?
+ORDER BY chapter, part
+`, title, date)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	out := []ecfr.PartStats{}
+	for rows.Next() {
+		var p ecfr.PartStats
+		if err := rows.Scan(&p.Chapter, &p.Part, &p.Words, &p.Restrictions); err != nil {
+			return nil, false, err
+		}
+		out = append(out, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	return out, true, nil
+}
+
+// RemovePartialSnapshots deletes temp files left by interrupted downloads. It
+// must not run while a download is in progress.
+func (s *Store) RemovePartialSnapshots() (int, error) {
+	matches, err := filepath.Glob(filepath.Join(s.dataDir, "xml", "*.tmp-*"))
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, m := range matches {
+		if err := os.Remove(m); err != nil && !os.IsNotExist(err) {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
 }
 
 func (s *Store) ReadSnapshotXML(ctx context.Context, title int, date string) ([]byte, error) {
+	rc, err := s.OpenSnapshot(ctx, title, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioReadAllLimit(rc, 200<<20)
+}
+
+func (s *Store) OpenSnapshot(ctx context.Context, title int, date string) (io.ReadCloser, error) {
 	var path string
 	if err := s.db.QueryRowContext(ctx, `SELECT file_path FROM snapshots WHERE title_number=? AND issue_date=?`, title, date).Scan(&path); err != nil {
 		return nil, err
 	}
-	b, err := os.ReadFile(path)
+	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
-	r, err := gzip.NewReader(bytes.NewReader(b))
+	gz, err := gzip.NewReader(bufio.NewReaderSize(f, 256<<10))
 	if err != nil {
+		_ = f.Close()
 		return nil, err
 	}
-	defer r.Close()
-	return ioReadAllLimit(r, 200<<20)
+	return &snapshotReader{Reader: gz, gz: gz, f: f}, nil
+}
+
+type snapshotReader struct {
+	io.Reader
+	gz *gzip.Reader
+	f  *os.File
+}
+
+func (r *snapshotReader) Close() error {
+	err := r.gz.Close()
+	if ferr := r.f.Close(); err == nil {
+		err = ferr
+	}
+	return err
 }
 
 func ioReadAllLimit(r interface{ Read([]byte) (int, error) }, limit int64) ([]byte, error) {
@@ -266,44 +823,105 @@ func ioReadAllLimit(r interface{ Read([]byte) (int, error) }, limit int64) ([]by
 	return buf.Bytes(), nil
 }
 
+// ListAgencies returns the agency hierarchy: top-level agencies by name, each
+// with its sub-agencies nested under "children" and linked back by "parent".
 func (s *Store) ListAgencies(ctx context.Context) ([]map[string]any, error) {
-	rows, err := s.db.QueryContext(ctx, `SELECT slug, name FROM agencies ORDER BY name`)
+	roots, err := s.RootAgencies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var node func(a ecfr.Agency, parent any) map[string]any
+	node = func(a ecfr.Agency, parent any) map[string]any {
+		children := make([]map[string]any, 0, len(a.Children))
+		for _, c := range a.Children {
+			children = append(children, node(c, a.Slug))
+		}
+		sort.Slice(children, func(i, j int) bool { return children[i]["name"].(string) < children[j]["name"].(string) })
+		return map[string]any{"slug": a.Slug, "name": a.Name, "parent": parent, "children": children}
+	}
+	out := make([]map[string]any, 0, len(roots))
+	for _, a := range roots {
+		out = append(out, node(a, nil))
+	}
+	return out, nil
+}
+
+// RootAgencies returns the top-level agencies by name, sub-agencies nested in
+// Children.
+func (s *Store) RootAgencies(ctx context.Context) ([]ecfr.Agency, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT name, json FROM agencies WHERE parent_slug IS NULL ORDER BY name`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var out []map[string]any
+	var out []ecfr.Agency
 	for rows.Next() {
-		var slug, name string
-		if err := rows.Scan(&slug, &name); err != nil {
+		var name, raw string
+		if err := rows.Scan(&name, &raw); err != nil {
 			return nil, err
 		}
-		out = append(out, map[string]any{"slug": slug, "name": name})
+		var a ecfr.Agency
+		if err := json.Unmarshal([]byte(raw), &a); err != nil {
+			return nil, fmt.Errorf("agency %s: %w", name, err)
+		}
+		out = append(out, a)
 	}
-	return out, nil
+	return out, rows.Err()
+}
+
+// Metric scopes: ScopeOwn covers an agency's own CFR references, ScopeRollup
+// adds those of all its sub-agencies, counting each chapter once.
+const (
+	ScopeOwn    = "own"
+	ScopeRollup = "rollup"
+)
+
+func ValidScope(scope string) bool { return scope == ScopeOwn || scope == ScopeRollup }
+
+// scopeCond matches the agency_metrics rows (as m) holding a scope's values,
+// given scopeArgs. Agencies without sub-agencies store no rollup; their own
+// values stand in for it.
+const scopeCond = `m.scope = CASE WHEN EXISTS (SELECT 1 FROM agencies c WHERE c.parent_slug = m.agency_slug) THEN ? ELSE ? END`
+
+func scopeArgs(scope string) []any {
+	if scope == ScopeRollup {
+		return []any{ScopeRollup, ScopeOwn}
+	}
+	return []any{scope, scope}
 }
 
-func (s *Store) PutAgencyMetric(ctx context.Context, slug, date, metric string, num *float64, text *string) error {
+// PutAgencyMetric stores one agency metric value, recording the store's text
+// profile and the attribution mode it was computed under with it.
+func (s *Store) PutAgencyMetric(ctx context.Context, slug, date, metric, scope, attribution string, num *float64, text *string) error {
 	_, err := s.db.ExecContext(ctx, `
-INSERT INTO agency_metrics(agency_slug, issue_date, metric, value_num, value_text, created_at)
-VALUES(?,?,?,?,?,?)
-ON CONFLICT(agency_slug, issue_date, metric) DO UPDATE SET value_num=excluded.value_num, value_text=excluded.value_text
-`, slug, date, metric, num, text, time.Now().Format(time.RFC3339))
+INSERT INTO agency_metrics(agency_slug, issue_date, metric, scope, value_num, value_text, created_at, text_profile, attribution)
+VALUES(?,?,?,?,?,?,?,?,?)
+ON CONFLICT(agency_slug, issue_date, metric, scope, text_profile) DO UPDATE SET value_num=excluded.value_num,
+  value_text=excluded.value_text, attribution=excluded.attribution
+`, slug, date, metric, scope, num, text, time.Now().Format(time.RFC3339), s.profile.String(), attribution)
 	return err
 }
 
-func (s *Store) LatestAgencyMetric(ctx context.Context, metric string) ([]map[string]any, error) {
+// LatestAgencyMetric returns each agency's latest value of metric computed
+// with the store's text profile, with the change from its previous value
+// under that profile.
+func (s *Store) LatestAgencyMetric(ctx context.Context, metric, scope string) ([]map[string]any, error) {
 	q := `
 SELECT
   m.agency_slug,
   a.name,
+  a.parent_slug,
   m.issue_date,
   m.value_num,
   m.value_text,
+  m.text_profile,
+  m.attribution,
   (SELECT m2.value_num
      FROM agency_metrics m2
     WHERE m2.agency_slug=m.agency_slug
       AND m2.metric=m.metric
+      AND m2.scope=m.scope
+      AND m2.text_profile=m.text_profile
       AND m2.issue_date < m.issue_date
     ORDER BY m2.issue_date DESC
     LIMIT 1) AS prev_num,
@@ -311,16 +929,21 @@ SELECT
      FROM agency_metrics m2
     WHERE m2.agency_slug=m.agency_slug
       AND m2.metric=m.metric
+      AND m2.scope=m.scope
+      AND m2.text_profile=m.text_profile
       AND m2.issue_date < m.issue_date
     ORDER BY m2.issue_date DESC
     LIMIT 1) AS prev_text
 FROM agency_metrics m
 JOIN agencies a ON a.slug = m.agency_slug
-WHERE m.metric = ?
-  AND m.issue_date = (SELECT MAX(issue_date) FROM agency_metrics m2 WHERE m2.agency_slug=m.agency_slug AND m2.metric=m.metric)
+WHERE m.metric = ? AND ` + scopeCond + `
+  AND m.text_profile = ?
+  AND m.issue_date = (SELECT MAX(issue_date) FROM agency_metrics m2
+                      WHERE m2.agency_slug=m.agency_slug AND m2.metric=m.metric AND m2.scope=m.scope AND m2.text_profile=m.text_profile)
 ORDER BY a.name
 `
-	rows, err := s.db.QueryContext(ctx, q, metric)
+	args := append([]any{metric}, scopeArgs(scope)...)
+	rows, err := s.db.QueryContext(ctx, q, append(args, s.profile.String())...)
 	if err != nil {
 		return nil, err
 	}
@@ -328,12 +951,17 @@ ORDER BY a.name
 	var out []map[string]any
 	for rows.Next() {
 		var slug, name, date string
+		var parent sql.NullString
 		var num, prevNum sql.NullFloat64
 		var txt, prevTxt sql.NullString
-		if err := rows.Scan(&slug, &name, &date, &num, &txt, &prevNum, &prevTxt); err != nil {
+		var profile, attribution string
+		if err := rows.Scan(&slug, &name, &parent, &date, &num, &txt, &profile, &attribution, &prevNum, &prevTxt); err != nil {
 			return nil, err
 		}
-		o := map[string]any{"slug": slug, "name": name, "date": date}
+		o := map[string]any{"slug": slug, "name": name, "parent": nil, "date": date, "text_profile": profile, "attribution": attribution}
+		if parent.Valid {
+			o["parent"] = parent.String
+		}
 		if num.Valid {
 			o["value"] = num.Float64
 			if prevNum.Valid {
@@ -367,11 +995,11 @@ func (s *Store) AgencyMetricSeries(ctx context.Context, slug, metric string, day
 	q := `
 SELECT issue_date, value_num, value_text
 FROM agency_metrics
-WHERE agency_slug=? AND metric=?
+WHERE agency_slug=? AND metric=? AND scope=? AND text_profile=?
 ORDER BY issue_date DESC
 LIMIT ?
 `
-	rows, err := s.db.QueryContext(ctx, q, slug, metric, days)
+	rows, err := s.db.QueryContext(ctx, q, slug, metric, ScopeOwn, s.profile.String(), days)
 	if err != nil {
 		return nil, err
 	}
@@ -397,8 +1025,90 @@ LIMIT ?
 	return out, nil
 }
 
+type SeriesRange struct {
+	From  string
+	To    string
+	Limit int
+	// Scope defaults to ScopeOwn.
+	Scope string
+	// Profile selects values computed with a text profile, in its canonical
+	// form. It defaults to the store's, so a series never mixes profiles.
+	Profile string
+}
+
+func (s *Store) AgencyMetricSeriesRange(ctx context.Context, slug, metric string, rng SeriesRange) ([]map[string]any, error) {
+	q := `
+SELECT issue_date, value_num, value_text, text_profile, attribution
+FROM agency_metrics m
+WHERE agency_slug=? AND metric=? AND ` + scopeCond + `
+  AND text_profile=?
+  AND (? = '' OR issue_date >= ?)
+  AND (? = '' OR issue_date <= ?)
+ORDER BY issue_date DESC
+LIMIT ?
+`
+	limit := rng.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	scope := rng.Scope
+	if scope == "" {
+		scope = ScopeOwn
+	}
+	profile := rng.Profile
+	if profile == "" {
+		profile = s.profile.String()
+	}
+	args := append([]any{slug, metric}, scopeArgs(scope)...)
+	rows, err := s.db.QueryContext(ctx, q, append(args, profile, rng.From, rng.From, rng.To, rng.To, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []map[string]any{}
+	for rows.Next() {
+		var date string
+		var num sql.NullFloat64
+		var txt sql.NullString
+		var profile, attribution string
+		if err := rows.Scan(&date, &num, &txt, &profile, &attribution); err != nil {
+			return nil, err
+		}
+		o := map[string]any{"date": date, "text_profile": profile, "attribution": attribution}
+		if num.Valid {
+			o["value"] = num.Float64
+		} else if txt.Valid {
+			o["value"] = txt.String
+		} else {
+			o["value"] = nil
+		}
+		out = append(out, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, nil
+}
+
+func (s *Store) AgencyMetricsSeries(ctx context.Context, slug string, metrics []string, rng SeriesRange) (map[string][]map[string]any, error) {
+	out := make(map[string][]map[string]any, len(metrics))
+	for _, m := range metrics {
+		points, err := s.AgencyMetricSeriesRange(ctx, slug, m, rng)
+		if err != nil {
+			return nil, err
+		}
+		out[m] = points
+	}
+	return out, nil
+}
+
 func (s *Store) DB() *sql.DB { return s.db }
 
+func (s *Store) DataDir() string { return s.dataDir }
+
 func (s *Store) PreviousSnapshotDate(ctx context.Context, title int, currentDate string) (string, bool) {
 	q := `SELECT issue_date FROM snapshots WHERE title_number=? AND issue_date < ? ORDER BY issue_date DESC LIMIT 1`
 	var d string
@@ -407,3 +1117,107 @@ func (s *Store) PreviousSnapshotDate(ctx context.Context, title int, currentDate
 	}
 	return d, true
 }
+
+func (s *Store) SnapshotDateOnOrBefore(ctx context.Context, title int, date string) (string, bool) {
+	q := `SELECT issue_date FROM snapshots WHERE title_number=? AND issue_date <= ? ORDER BY issue_date DESC LIMIT 1`
+	var d string
+	if err := s.db.QueryRowContext(ctx, q, title, date).Scan(&d); err != nil {
+		return "", false
+	}
+	return d, true
+}
+
+func (s *Store) SnapshotDates(ctx context.Context, title int) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT issue_date FROM snapshots WHERE title_number=? ORDER BY issue_date`, title)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []string{}
+	for rows.Next() {
+		var d string
+		if err := rows.Scan(&d); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// MetricRow is one stored agency metric value and the text profile and
+// attribution mode it was computed with.
+type MetricRow struct {
+	Slug        string
+	Name        string
+	Date        string
+	Metric      string
+	Num         *float64
+	Text        *string
+	TextProfile string
+	Attribution string
+}
+
+// ExportQuery selects agency metric values; empty From and To are open ends.
+// Like SeriesRange.Profile, Profile defaults to the store's text profile.
+type ExportQuery struct {
+	Metrics []string
+	Scope   string
+	From    string
+	To      string
+	Profile string
+}
+
+// EachAgencyMetric calls fn with every value matching q, ordered by agency
+// slug, date and metric, reading rows as fn consumes them. It stops at the
+// first error from fn. The read stays open while fn runs, so a slow fn only
+// leaves writers unblocked on a database in WAL mode.
+func (s *Store) EachAgencyMetric(ctx context.Context, q ExportQuery, fn func(MetricRow) error) error {
+	if len(q.Metrics) == 0 {
+		return nil
+	}
+	scope := q.Scope
+	if scope == "" {
+		scope = ScopeOwn
+	}
+	profile := q.Profile
+	if profile == "" {
+		profile = s.profile.String()
+	}
+	args := append(scopeArgs(scope), profile, q.From, q.From, q.To, q.To)
+	for _, m := range q.Metrics {
+		args = append(args, m)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+SELECT m.agency_slug, a.name, m.issue_date, m.metric, m.value_num, m.value_text, m.text_profile, m.attribution
+FROM agency_metrics m
+JOIN agencies a ON a.slug = m.agency_slug
+WHERE `+scopeCond+`
+  AND m.text_profile = ?
+  AND (? = '' OR m.issue_date >= ?)
+  AND (? = '' OR m.issue_date <= ?)
+  AND m.metric IN (?`+strings.Repeat(",?", len(q.Metrics)-1)+`)
+ORDER BY m.agency_slug, m.issue_date, m.metric
+`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r MetricRow
+		var num sql.NullFloat64
+		var txt sql.NullString
+		if err := rows.Scan(&r.Slug, &r.Name, &r.Date, &r.Metric, &num, &txt, &r.TextProfile, &r.Attribution); err != nil {
+			return err
+		}
+		if num.Valid {
+			r.Num = &num.Float64
+		}
+		if txt.Valid {
+			r.Text = &txt.String
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
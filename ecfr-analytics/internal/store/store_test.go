@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"testing"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -72,6 +74,161 @@ func TestSnapshotRoundTrip(t *testing.T) {
 	if !bytes.Contains(out, []byte("Hello world")) {
 		t.Fatalf("unexpected snapshot content: %q", string(out))
 	}
+
+	rc, err := st.OpenSnapshot(ctx, 1, "2025-01-02")
+	if err != nil {
+		t.Fatalf("open snapshot: %v", err)
+	}
+	streamed, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("stream snapshot: %v", err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatalf("close snapshot: %v", err)
+	}
+	if !bytes.Equal(streamed, out) {
+		t.Fatalf("streamed content differs: %q", string(streamed))
+	}
+}
+
+func TestSnapshotIndexesChapterContent(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	if err := st.UpsertTitles(ctx, []ecfr.Title{{Number: 1, Name: "Title 1", UpToDateAsOf: "2025-01-02", Reserved: false}}); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	xml := []byte(`<ROOT><DIV1 TYPE="CHAPTER" N="I"><P>Hello world.</P></DIV1><DIV1 TYPE="CHAPTER" N="II"><P>One two three.</P></DIV1></ROOT>`)
+	if err := st.SaveSnapshotFromReader(ctx, 1, "2025-01-02", bytes.NewReader(xml)); err != nil {
+		t.Fatalf("save snapshot: %v", err)
+	}
+	chapters, ok, err := st.ChapterContent(ctx, 1, "2025-01-02")
+	if err != nil || !ok {
+		t.Fatalf("chapter content: %v %v", ok, err)
+	}
+	if len(chapters) != 2 || chapters["I"].Words != 2 || chapters["II"].Words != 3 || chapters["II"].Sentences != 1 {
+		t.Fatalf("unexpected chapter content: %#v", chapters)
+	}
+	if chapters["II"].Syllables != 3 || chapters["II"].Letters != 11 {
+		t.Fatalf("unexpected readability counts: %#v", chapters["II"])
+	}
+	if chapters["I"].Checksum != ecfr.ChecksumHex("Hello world. ") {
+		t.Fatalf("unexpected checksum: %s", chapters["I"].Checksum)
+	}
+
+	bad := []byte(`<ROOT><DIV1 TYPE="CHAPTER" N="I"><P>Trunc`)
+	if err := st.SaveSnapshotFromReader(ctx, 1, "2025-01-03", bytes.NewReader(bad)); err == nil {
+		t.Fatalf("expected truncated snapshot to be rejected")
+	}
+	if ok, _ := st.SnapshotExists(ctx, 1, "2025-01-03"); ok {
+		t.Fatalf("truncated snapshot should not be recorded")
+	}
+	if _, ok, err := st.ChapterContent(ctx, 1, "2025-01-03"); err != nil || ok {
+		t.Fatalf("expected no chapter content for a missing snapshot: %v %v", ok, err)
+	}
+
+	empty := []byte(`<ROOT><DIV1 TYPE="TITLE" N="1"></DIV1></ROOT>`)
+	if err := st.SaveSnapshotFromReader(ctx, 1, "2025-01-04", bytes.NewReader(empty)); err != nil {
+		t.Fatalf("save empty snapshot: %v", err)
+	}
+	if chapters, ok, err := st.ChapterContent(ctx, 1, "2025-01-04"); err != nil || !ok || len(chapters) != 0 {
+		t.Fatalf("expected an indexed snapshot without chapters: %#v %v %v", chapters, ok, err)
+	}
+}
+
+func TestChapterContentResetOnStatsVersion(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+	if err := st.UpsertTitles(ctx, []ecfr.Title{{Number: 1, Name: "Title 1", UpToDateAsOf: "2025-01-02"}}); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	if err := st.PutContent(ctx, 1, "2025-01-02", map[string]ecfr.ChapterStats{"I": {Words: 2, Checksum: "x"}}, nil); err != nil {
+		t.Fatalf("put content: %v", err)
+	}
+
+	if err := st.InitSchema(); err != nil {
+		t.Fatalf("re-init schema: %v", err)
+	}
+	if chapters, _, _ := st.ChapterContent(ctx, 1, "2025-01-02"); len(chapters) != 1 {
+		t.Fatalf("same stats version should keep chapter content: %#v", chapters)
+	}
+
+	if err := st.SetState(ctx, "chapter_stats_version", "1"); err != nil {
+		t.Fatalf("set state: %v", err)
+	}
+	if err := st.InitSchema(); err != nil {
+		t.Fatalf("re-init schema: %v", err)
+	}
+	if chapters, ok, _ := st.ChapterContent(ctx, 1, "2025-01-02"); ok || len(chapters) != 0 {
+		t.Fatalf("old stats version should clear chapter content: %#v", chapters)
+	}
+	if v, _ := st.GetState(ctx, "chapter_stats_version"); v != strconv.Itoa(ecfr.TextStatsVersion) {
+		t.Fatalf("stats version not recorded: %q", v)
+	}
+}
+
+func TestPartContentKeyedByTerms(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	if err := st.UpsertTitles(ctx, []ecfr.Title{{Number: 1, Name: "Title 1", UpToDateAsOf: "2025-01-02"}}); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	chapters := map[string]ecfr.ChapterStats{"I": {Words: 13, Checksum: "x"}}
+	parts := []ecfr.PartStats{{Chapter: "I", Part: "1", Words: 10, Restrictions: 2}, {Chapter: "I", Part: "", Words: 3}}
+	if err := st.PutContent(ctx, 1, "2025-01-02", chapters, parts); err != nil {
+		t.Fatalf("put content: %v", err)
+	}
+	got, ok, err := st.PartContent(ctx, 1, "2025-01-02")
+	if err != nil || !ok || len(got) != 2 || got[0].Part != "" || got[1].Restrictions != 2 {
+		t.Fatalf("unexpected part content: %#v %v %v", got, ok, err)
+	}
+
+	st.SetRestrictionTerms([]string{"should"})
+	if got, ok, err := st.PartContent(ctx, 1, "2025-01-02"); err != nil || ok || got != nil {
+		t.Fatalf("expected no parts for other terms: %#v %v", got, err)
+	}
+	if _, ok, _ := st.ChapterContent(ctx, 1, "2025-01-02"); !ok {
+		t.Fatal("other terms should keep the chapter summaries")
+	}
+	if err := st.PutContent(ctx, 1, "2025-01-02", chapters, parts[:1]); err != nil {
+		t.Fatalf("replace content: %v", err)
+	}
+	if got, ok, _ := st.PartContent(ctx, 1, "2025-01-02"); !ok || len(got) != 1 {
+		t.Fatalf("expected stale counts to be replaced: %#v", got)
+	}
+}
+
+func TestChapterContentKeyedByProfile(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	if err := st.UpsertTitles(ctx, []ecfr.Title{{Number: 1, Name: "Title 1", UpToDateAsOf: "2025-01-02"}}); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	if err := st.UpsertAgencies(ctx, []ecfr.Agency{{Name: "Agency A", Slug: "a"}}); err != nil {
+		t.Fatalf("upsert agencies: %v", err)
+	}
+	if err := st.PutContent(ctx, 1, "2025-01-02", map[string]ecfr.ChapterStats{"I": {Words: 2, Checksum: "x"}}, nil); err != nil {
+		t.Fatalf("put content: %v", err)
+	}
+	profile, err := ecfr.ParseTextProfile("-headings")
+	if err != nil {
+		t.Fatalf("parse profile: %v", err)
+	}
+	st.SetTextProfile(profile)
+	if chapters, ok, err := st.ChapterContent(ctx, 1, "2025-01-02"); err != nil || ok || len(chapters) != 0 {
+		t.Fatalf("expected no chapters for another profile: %#v %v", chapters, err)
+	}
+
+	words := 3.0
+	if err := st.PutAgencyMetric(ctx, "a", "2025-01-02", "word_count", ScopeOwn, "full", &words, nil); err != nil {
+		t.Fatalf("put metric: %v", err)
+	}
+	rows, err := st.LatestAgencyMetric(ctx, "word_count", ScopeOwn)
+	if err != nil || len(rows) != 1 || rows[0]["text_profile"] != profile.String() {
+		t.Fatalf("expected the profile to be recorded: %#v %v", rows, err)
+	}
 }
 
 func TestLatestAgencyMetricDelta(t *testing.T) {
@@ -85,14 +242,14 @@ func TestLatestAgencyMetricDelta(t *testing.T) {
 
 	v1 := 10.0
 	v2 := 12.5
-	if err := st.PutAgencyMetric(ctx, "dot", "2025-01-01", "word_count", &v1, nil); err != nil {
+	if err := st.PutAgencyMetric(ctx, "dot", "2025-01-01", "word_count", ScopeOwn, "full", &v1, nil); err != nil {
 		t.Fatalf("put metric v1: %v", err)
 	}
-	if err := st.PutAgencyMetric(ctx, "dot", "2025-01-02", "word_count", &v2, nil); err != nil {
+	if err := st.PutAgencyMetric(ctx, "dot", "2025-01-02", "word_count", ScopeOwn, "full", &v2, nil); err != nil {
 		t.Fatalf("put metric v2: %v", err)
 	}
 
-	rows, err := st.LatestAgencyMetric(ctx, "word_count")
+	rows, err := st.LatestAgencyMetric(ctx, "word_count", ScopeOwn)
 	if err != nil {
 		t.Fatalf("latest metric: %v", err)
 	}
@@ -105,6 +262,184 @@ func TestLatestAgencyMetricDelta(t *testing.T) {
 	if rows[0]["delta"].(float64) != v2-v1 {
 		t.Fatalf("unexpected delta: %v", rows[0]["delta"])
 	}
+
+	// A value computed with another profile is kept beside the first and
+	// compared only with values of its own profile.
+	profile, err := ecfr.ParseTextProfile("-headings")
+	if err != nil {
+		t.Fatalf("parse profile: %v", err)
+	}
+	st.SetTextProfile(profile)
+	v3 := 20.0
+	if err := st.PutAgencyMetric(ctx, "dot", "2025-01-02", "word_count", ScopeOwn, "full", &v3, nil); err != nil {
+		t.Fatalf("put metric v3: %v", err)
+	}
+	rows, err = st.LatestAgencyMetric(ctx, "word_count", ScopeOwn)
+	if err != nil || len(rows) != 1 || rows[0]["value"].(float64) != v3 || rows[0]["delta"] != nil {
+		t.Fatalf("expected no delta across profiles: %v %v", rows, err)
+	}
+	st.SetTextProfile(nil)
+	rows, err = st.LatestAgencyMetric(ctx, "word_count", ScopeOwn)
+	if err != nil || len(rows) != 1 || rows[0]["value"].(float64) != v2 {
+		t.Fatalf("expected the default profile's value to be kept: %v %v", rows, err)
+	}
+}
+
+func TestAgencyHierarchy(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	ag := []ecfr.Agency{
+		{Slug: "usda", Name: "Agriculture Department", Children: []ecfr.Agency{
+			{Slug: "fs", Name: "Forest Service"},
+			{Slug: "ams", Name: "Agricultural Marketing Service"},
+		}},
+		{Slug: "epa", Name: "Environmental Protection Agency"},
+	}
+	if err := st.UpsertAgencies(ctx, ag); err != nil {
+		t.Fatalf("upsert agencies: %v", err)
+	}
+	tree, err := st.ListAgencies(ctx)
+	if err != nil {
+		t.Fatalf("list agencies: %v", err)
+	}
+	if len(tree) != 2 || tree[0]["slug"] != "usda" || tree[0]["parent"] != nil {
+		t.Fatalf("unexpected roots: %#v", tree)
+	}
+	kids := tree[0]["children"].([]map[string]any)
+	if len(kids) != 2 || kids[0]["slug"] != "ams" || kids[0]["parent"] != "usda" {
+		t.Fatalf("unexpected children: %#v", kids)
+	}
+
+	own, rollup := 1.0, 3.0
+	if err := st.PutAgencyMetric(ctx, "fs", "2025-01-01", "word_count", ScopeOwn, "full", &own, nil); err != nil {
+		t.Fatalf("sub-agency metric: %v", err)
+	}
+	if err := st.PutAgencyMetric(ctx, "usda", "2025-01-01", "word_count", ScopeRollup, "full", &rollup, nil); err != nil {
+		t.Fatalf("rollup metric: %v", err)
+	}
+	rows, err := st.LatestAgencyMetric(ctx, "word_count", ScopeRollup)
+	if err != nil || len(rows) != 2 || rows[0]["slug"] != "usda" || rows[0]["value"].(float64) != rollup {
+		t.Fatalf("unexpected rollup rows: %v %v", rows, err)
+	}
+	// A sub-agency without sub-agencies of its own rolls up to its own values.
+	if rows[1]["slug"] != "fs" || rows[1]["value"].(float64) != own || rows[1]["parent"] != "usda" {
+		t.Fatalf("unexpected leaf rollup: %v", rows[1])
+	}
+	if err := st.PutAgencyMetric(ctx, "fs", "2025-01-01", "word_count", ScopeRollup, "full", &rollup, nil); err != nil {
+		t.Fatalf("leaf rollup metric: %v", err)
+	}
+	if err := st.InitSchema(); err != nil {
+		t.Fatalf("re-init schema: %v", err)
+	}
+	var leafRollups int
+	if err := st.db.QueryRow(`SELECT COUNT(*) FROM agency_metrics WHERE agency_slug='fs' AND scope=?`, ScopeRollup).Scan(&leafRollups); err != nil || leafRollups != 0 {
+		t.Fatalf("expected leaf rollups to be pruned: %d %v", leafRollups, err)
+	}
+	series, err := st.AgencyMetricSeriesRange(ctx, "fs", "word_count", SeriesRange{})
+	if err != nil || len(series) != 1 || series[0]["value"].(float64) != own {
+		t.Fatalf("series should default to own scope: %v %v", series, err)
+	}
+}
+
+func TestMigrateAgencyMetricsScope(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "old.sqlite")+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	_, err = db.Exec(`
+CREATE TABLE agencies (slug TEXT PRIMARY KEY, name TEXT NOT NULL, json TEXT NOT NULL, updated_at TEXT NOT NULL);
+CREATE TABLE agency_metrics (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  agency_slug TEXT NOT NULL,
+  issue_date TEXT NOT NULL,
+  metric TEXT NOT NULL,
+  value_num REAL,
+  value_text TEXT,
+  created_at TEXT NOT NULL,
+  UNIQUE(agency_slug, issue_date, metric),
+  FOREIGN KEY(agency_slug) REFERENCES agencies(slug)
+);
+INSERT INTO agencies VALUES('dot', 'Department of Testing', '{"slug":"dot","name":"Department of Testing"}', '');
+INSERT INTO agency_metrics(agency_slug, issue_date, metric, value_num, created_at) VALUES('dot', '2025-01-01', 'word_count', 7, '');
+`)
+	if err != nil {
+		t.Fatalf("old schema: %v", err)
+	}
+	st := New(db, dir)
+	if err := st.InitSchema(); err != nil {
+		t.Fatalf("init schema: %v", err)
+	}
+	ctx := context.Background()
+	rows, err := st.LatestAgencyMetric(ctx, "word_count", ScopeOwn)
+	if err != nil || len(rows) != 1 || rows[0]["value"].(float64) != 7 {
+		t.Fatalf("existing metrics should become own scope: %v %v", rows, err)
+	}
+	v := 9.0
+	if err := st.PutAgencyMetric(ctx, "dot", "2025-01-01", "word_count", ScopeRollup, "full", &v, nil); err != nil {
+		t.Fatalf("put rollup after migration: %v", err)
+	}
+	if tree, err := st.ListAgencies(ctx); err != nil || len(tree) != 1 {
+		t.Fatalf("list agencies after migration: %v %v", tree, err)
+	}
+}
+
+func TestMigrateProfileKeys(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "old.sqlite")+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	_, err = db.Exec(`
+CREATE TABLE agencies (slug TEXT PRIMARY KEY, name TEXT NOT NULL, json TEXT NOT NULL, updated_at TEXT NOT NULL, parent_slug TEXT);
+CREATE TABLE agency_metrics (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  agency_slug TEXT NOT NULL,
+  issue_date TEXT NOT NULL,
+  metric TEXT NOT NULL,
+  scope TEXT NOT NULL DEFAULT 'own',
+  value_num REAL,
+  value_text TEXT,
+  created_at TEXT NOT NULL,
+  text_profile TEXT NOT NULL DEFAULT '',
+  attribution TEXT NOT NULL DEFAULT '',
+  UNIQUE(agency_slug, issue_date, metric, scope),
+  FOREIGN KEY(agency_slug) REFERENCES agencies(slug)
+);
+INSERT INTO agencies VALUES('dot', 'Department of Testing', '{"slug":"dot","name":"Department of Testing"}', '', NULL);
+INSERT INTO agency_metrics(agency_slug, issue_date, metric, value_num, created_at) VALUES('dot', '2025-01-01', 'word_count', 7, '');
+`)
+	if err != nil {
+		t.Fatalf("old schema: %v", err)
+	}
+	st := New(db, dir)
+	if err := st.InitSchema(); err != nil {
+		t.Fatalf("init schema: %v", err)
+	}
+	ctx := context.Background()
+	v := 9.0
+	if err := st.PutAgencyMetric(ctx, "dot", "2025-02-01", "word_count", ScopeOwn, "full", &v, nil); err != nil {
+		t.Fatalf("put metric: %v", err)
+	}
+	rows, err := st.AgencyMetricSeriesRange(ctx, "dot", "word_count", SeriesRange{})
+	if err != nil || len(rows) != 2 || rows[0]["text_profile"] != ecfr.DefaultTextProfile.String() {
+		t.Fatalf("expected values stored without a profile in the default series: %v %v", rows, err)
+	}
+	profile, err := ecfr.ParseTextProfile("-headings")
+	if err != nil {
+		t.Fatalf("parse profile: %v", err)
+	}
+	st.SetTextProfile(profile)
+	if err := st.PutAgencyMetric(ctx, "dot", "2025-02-01", "word_count", ScopeOwn, "full", &v, nil); err != nil {
+		t.Fatalf("put metric with another profile: %v", err)
+	}
+	var n int
+	if err := st.db.QueryRow(`SELECT COUNT(*) FROM agency_metrics`).Scan(&n); err != nil || n != 3 {
+		t.Fatalf("expected values of both profiles to be kept: %d %v", n, err)
+	}
 }
 
 func TestLatestAgencyMetricTextChange(t *testing.T) {
@@ -117,14 +452,14 @@ func TestLatestAgencyMetricTextChange(t *testing.T) {
 	}
 	a := "abc"
 	b := "def"
-	if err := st.PutAgencyMetric(ctx, "doj", "2025-01-01", "checksum", nil, &a); err != nil {
+	if err := st.PutAgencyMetric(ctx, "doj", "2025-01-01", "checksum", ScopeOwn, "full", nil, &a); err != nil {
 		t.Fatalf("put metric a: %v", err)
 	}
-	if err := st.PutAgencyMetric(ctx, "doj", "2025-01-02", "checksum", nil, &b); err != nil {
+	if err := st.PutAgencyMetric(ctx, "doj", "2025-01-02", "checksum", ScopeOwn, "full", nil, &b); err != nil {
 		t.Fatalf("put metric b: %v", err)
 	}
 
-	rows, err := st.LatestAgencyMetric(ctx, "checksum")
+	rows, err := st.LatestAgencyMetric(ctx, "checksum", ScopeOwn)
 	if err != nil {
 		t.Fatalf("latest metric: %v", err)
 	}
@@ -146,10 +481,10 @@ func TestAgencyMetricSeries(t *testing.T) {
 	}
 	v1 := 1.0
 	v2 := 2.0
-	if err := st.PutAgencyMetric(ctx, "nsa", "2025-01-01", "word_count", &v1, nil); err != nil {
+	if err := st.PutAgencyMetric(ctx, "nsa", "2025-01-01", "word_count", ScopeOwn, "full", &v1, nil); err != nil {
 		t.Fatalf("put metric v1: %v", err)
 	}
-	if err := st.PutAgencyMetric(ctx, "nsa", "2025-01-02", "word_count", &v2, nil); err != nil {
+	if err := st.PutAgencyMetric(ctx, "nsa", "2025-01-02", "word_count", ScopeOwn, "full", &v2, nil); err != nil {
 		t.Fatalf("put metric v2: %v", err)
 	}
 
@@ -162,6 +497,68 @@ func TestAgencyMetricSeries(t *testing.T) {
 	}
 }
 
+func TestAgencyMetricSeriesRange(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	ag := []ecfr.Agency{{Slug: "nsa", Name: "Numbers"}}
+	if err := st.UpsertAgencies(ctx, ag); err != nil {
+		t.Fatalf("upsert agencies: %v", err)
+	}
+	for i, d := range []string{"2025-01-01", "2025-02-01", "2025-03-01", "2025-04-01"} {
+		v := float64(i + 1)
+		if err := st.PutAgencyMetric(ctx, "nsa", d, "word_count", ScopeOwn, "full", &v, nil); err != nil {
+			t.Fatalf("put metric %s: %v", d, err)
+		}
+	}
+
+	rows, err := st.AgencyMetricSeriesRange(ctx, "nsa", "word_count", SeriesRange{From: "2025-02-01", To: "2025-04-01"})
+	if err != nil {
+		t.Fatalf("metric series range: %v", err)
+	}
+	if len(rows) != 3 || rows[0]["date"] != "2025-02-01" || rows[2]["date"] != "2025-04-01" {
+		t.Fatalf("unexpected range rows: %#v", rows)
+	}
+
+	rows, err = st.AgencyMetricSeriesRange(ctx, "nsa", "word_count", SeriesRange{Limit: 2})
+	if err != nil {
+		t.Fatalf("metric series limit: %v", err)
+	}
+	if len(rows) != 2 || rows[0]["date"] != "2025-03-01" || rows[1]["value"].(float64) != 4 {
+		t.Fatalf("unexpected limited rows: %#v", rows)
+	}
+
+	multi, err := st.AgencyMetricsSeries(ctx, "nsa", []string{"word_count", "churn"}, SeriesRange{})
+	if err != nil {
+		t.Fatalf("metrics series: %v", err)
+	}
+	if len(multi["word_count"]) != 4 || len(multi["churn"]) != 0 {
+		t.Fatalf("unexpected multi series: %#v", multi)
+	}
+
+	// A value computed with another profile stays out of the default series.
+	profile, err := ecfr.ParseTextProfile("-headings")
+	if err != nil {
+		t.Fatalf("parse profile: %v", err)
+	}
+	st.SetTextProfile(profile)
+	v := 9.0
+	if err := st.PutAgencyMetric(ctx, "nsa", "2025-05-01", "word_count", ScopeOwn, "full", &v, nil); err != nil {
+		t.Fatalf("put metric: %v", err)
+	}
+	st.SetTextProfile(nil)
+	if st.TextProfile() != ecfr.DefaultTextProfile {
+		t.Fatal("expected nil to restore the default profile")
+	}
+	if rows, err := st.AgencyMetricSeriesRange(ctx, "nsa", "word_count", SeriesRange{}); err != nil || len(rows) != 4 {
+		t.Fatalf("expected the default profile's values only: %#v %v", rows, err)
+	}
+	rows, err = st.AgencyMetricSeriesRange(ctx, "nsa", "word_count", SeriesRange{Profile: profile.String()})
+	if err != nil || len(rows) != 1 || rows[0]["value"].(float64) != 9 {
+		t.Fatalf("unexpected rows for another profile: %#v %v", rows, err)
+	}
+}
+
 func TestPreviousSnapshotDate(t *testing.T) {
 	st := newTestStore(t)
 	ctx := context.Background()
@@ -184,3 +581,34 @@ func TestPreviousSnapshotDate(t *testing.T) {
 		t.Fatalf("unexpected previous date: %q", prev)
 	}
 }
+
+func TestSnapshotDateOnOrBefore(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	if err := st.UpsertTitles(ctx, []ecfr.Title{{Number: 3, Name: "Title 3", UpToDateAsOf: "2025-03-01", Reserved: false}}); err != nil {
+		t.Fatalf("upsert titles: %v", err)
+	}
+	xml := []byte(`<ROOT><DIV1 TYPE="CHAPTER" N="I"><P>Hi.</P></DIV1></ROOT>`)
+	for _, d := range []string{"2025-01-01", "2025-03-01"} {
+		if err := st.SaveSnapshotFromReader(ctx, 3, d, bytes.NewReader(xml)); err != nil {
+			t.Fatalf("save snapshot: %v", err)
+		}
+	}
+	if d, ok := st.SnapshotDateOnOrBefore(ctx, 3, "2025-02-15"); !ok || d != "2025-01-01" {
+		t.Fatalf("unexpected as-of date: %q %v", d, ok)
+	}
+	if d, ok := st.SnapshotDateOnOrBefore(ctx, 3, "2025-03-01"); !ok || d != "2025-03-01" {
+		t.Fatalf("unexpected exact as-of date: %q %v", d, ok)
+	}
+	if _, ok := st.SnapshotDateOnOrBefore(ctx, 3, "2024-12-31"); ok {
+		t.Fatalf("expected no snapshot before first date")
+	}
+	dates, err := st.SnapshotDates(ctx, 3)
+	if err != nil {
+		t.Fatalf("snapshot dates: %v", err)
+	}
+	if len(dates) != 2 || dates[0] != "2025-01-01" || dates[1] != "2025-03-01" {
+		t.Fatalf("unexpected snapshot dates: %v", dates)
+	}
+}
@@ -1,6 +1,9 @@
 const API = (path) => path;
 
 const metricsCache = new Map();
+let metricCatalog = [];
+const agencyIndex = new Map();
+let drillSlug = "";
 
 const numberFmt = new Intl.NumberFormat("en-US");
 const themeKey = "ecfr-theme";
@@ -33,18 +36,23 @@ function fmtScore(value) {
   return value.toFixed(1);
 }
 
+function metricInfo(metric) {
+  return metricCatalog.find((m) => m.name === metric) ?? { name: metric, kind: "number" };
+}
+
 function formatValue(metric, value) {
-  switch (metric) {
-    case "word_count":
-      return fmtNumber(value);
-    case "words_per_chapter":
-      return fmtNumber(value);
-    case "churn":
+  const info = metricInfo(metric);
+  if (info.kind === "text") return String(value ?? "--");
+  switch (info.unit) {
+    case "ratio":
       return fmtPercent(value);
-    case "readability":
+    case "score":
+    case "grade":
+    case "per 1k words":
+    case "years":
       return fmtScore(value);
     default:
-      return String(value ?? "--");
+      return fmtNumber(value);
   }
 }
 
@@ -58,10 +66,11 @@ function setText(id, value) {
   if (el) el.textContent = value;
 }
 
-async function loadLatest(metric) {
-  if (metricsCache.has(metric)) return metricsCache.get(metric);
-  const rows = await jget(`/api/metrics/latest?metric=${encodeURIComponent(metric)}`);
-  metricsCache.set(metric, rows);
+async function loadLatest(metric, scope = "own") {
+  const key = `${scope}:${metric}`;
+  if (metricsCache.has(key)) return metricsCache.get(key);
+  const rows = await jget(`/api/metrics/latest?metric=${encodeURIComponent(metric)}&scope=${scope}`);
+  metricsCache.set(key, rows);
   return rows;
 }
 
@@ -76,13 +85,38 @@ async function loadAllLatest() {
     loadLatest("churn"),
     loadLatest("readability"),
     loadLatest("words_per_chapter"),
-    loadLatest("checksum"),
+    loadLatest("content_checksum"),
   ]);
 }
 
+async function loadMetricCatalog() {
+  metricCatalog = await jget("/api/metrics");
+  const select = document.getElementById("reviewMetricSelect");
+  const current = select.value;
+  select.innerHTML = "";
+  for (const m of metricCatalog) {
+    const opt = new Option(m.label, m.name);
+    opt.title = m.description;
+    select.add(opt);
+  }
+  if (metricCatalog.some((m) => m.name === current)) select.value = current;
+}
+
 async function loadAgencies() {
-  const agencies = await jget("/api/agencies");
-  setText("statAgencies", numberFmt.format(agencies.length));
+  const tree = await jget("/api/agencies");
+  agencyIndex.clear();
+  const walk = (node) => {
+    agencyIndex.set(node.slug, node);
+    node.children.forEach(walk);
+  };
+  tree.forEach(walk);
+  setText("statAgencies", numberFmt.format(agencyIndex.size));
+}
+
+function drillInto(slug) {
+  drillSlug = slug;
+  document.getElementById("reviewSearch").value = "";
+  loadReviewTable();
 }
 
 function sumMetric(rows) {
@@ -106,7 +140,7 @@ async function updateSummary() {
   const readRows = await loadLatest("readability");
   const wpcRows = await loadLatest("words_per_chapter");
 
-  setText("statTotalWords", fmtNumber(sumMetric(wcRows)));
+  await updateWordTotals(wcRows);
   setText("statReadability", fmtScore(avgMetric(readRows)));
   setText("statLatestDate", latestDate(wcRows));
   setText("statChurn", fmtPercent(avgMetric(churnRows)));
@@ -114,6 +148,26 @@ async function updateSummary() {
   setText("statCoverage", numberFmt.format(wcRows.length));
 }
 
+// updateWordTotals shows the whole-CFR word count and how the agencies' own
+// word counts add up to it under the server's attribution mode.
+async function updateWordTotals(wcRows) {
+  const agencyWords = sumMetric(wcRows);
+  let shared;
+  try {
+    shared = await jget("/api/shared_chapters");
+  } catch (e) {
+    setText("statTotalWords", fmtNumber(agencyWords));
+    setText("statWordsReconcile", "");
+    return;
+  }
+  const t = shared.totals;
+  setText("statTotalWords", fmtNumber(t.cfr_words));
+  const parts = [`${fmtNumber(agencyWords)} attributed to agencies (${shared.mode})`];
+  parts.push(`${fmtNumber(t.shared_words)} in shared chapters`);
+  parts.push(`${fmtNumber(t.unreferenced_words)} unreferenced`);
+  setText("statWordsReconcile", parts.join(" · "));
+}
+
 async function updateLastRefresh() {
   const value = await loadState("last_refresh");
   setText("lastRefresh", value || "--");
@@ -158,11 +212,18 @@ async function renderInsights() {
 
 async function loadReviewTable() {
   const metric = document.getElementById("reviewMetricSelect").value;
+  const scope = document.getElementById("reviewScopeSelect").value;
   const search = document.getElementById("reviewSearch").value.trim().toLowerCase();
-  const rows = await loadLatest(metric);
+  const rows = await loadLatest(metric, scope);
+  const exportQuery = new URLSearchParams({ metrics: metric, scope, format: "csv" });
+  document.getElementById("reviewExport").href = API(`/api/export?${exportQuery}`);
+  const drillNode = agencyIndex.get(drillSlug);
+  document.getElementById("reviewCrumb").classList.toggle("hidden", !drillNode);
+  setText("reviewCrumbName", drillNode?.name ?? "");
   const changeHeader = document.getElementById("reviewChangeHeader");
   const valueHeader = document.getElementById("reviewValueHeader");
-  const hideChange = metric === "checksum";
+  const isText = metricInfo(metric).kind === "text";
+  const hideChange = isText;
   if (changeHeader) {
     changeHeader.classList.toggle("hidden", hideChange);
   }
@@ -171,8 +232,11 @@ async function loadReviewTable() {
   }
 
   let filtered = rows;
+  if (drillNode) {
+    filtered = rows.filter((r) => r.parent === drillSlug);
+  }
   if (search) {
-    filtered = rows.filter((r) => r.name.toLowerCase().includes(search));
+    filtered = filtered.filter((r) => r.name.toLowerCase().includes(search));
   }
 
   const numeric = filtered.filter((r) => typeof r.value === "number");
@@ -181,18 +245,19 @@ async function loadReviewTable() {
   numeric.sort((a, b) => b.value - a.value);
   nonNumeric.sort((a, b) => a.name.localeCompare(b.name));
 
-  const ordered = [...numeric, ...nonNumeric].slice(0, 200);
+  let ordered = [...numeric, ...nonNumeric].slice(0, 200);
+  const self = drillNode && rows.find((r) => r.slug === drillSlug);
+  if (self) ordered = [self, ...ordered];
 
   const tbody = document.getElementById("reviewTable");
   tbody.innerHTML = "";
   for (const r of ordered) {
     const tr = document.createElement("tr");
-    const isChecksum = metric === "checksum";
-    const value = isChecksum
+    const value = isText
       ? `<code>${escapeHtml(String(r.value ?? ""))}</code>`
       : `<span class="highlight-green">${escapeHtml(formatValue(metric, r.value))}</span>`;
     let changeHtml = "";
-    if (!isChecksum) {
+    if (!isText) {
       changeHtml = `<span class="change-dash">—</span>`;
       if (typeof r.delta === "number") {
         if (r.delta > 0) {
@@ -209,21 +274,110 @@ async function loadReviewTable() {
       }
     }
     const changeCell = `<td class="${hideChange ? "hidden" : ""}">${changeHtml}</td>`;
-    tr.innerHTML = `<td>${escapeHtml(r.name)}</td><td>${escapeHtml(r.date)}</td><td>${value}</td>${changeCell}`;
+    const children = agencyIndex.get(r.slug)?.children ?? [];
+    let nameHtml = escapeHtml(r.name);
+    if (children.length && r.slug !== drillSlug) {
+      nameHtml = `<button class="link-button" type="button" data-drill="${escapeHtml(r.slug)}">${nameHtml}</button> <span class="subtle">${children.length} sub-agencies</span>`;
+    }
+    if (drillNode && r.slug !== drillSlug) tr.className = "child-row";
+    tr.innerHTML = `<td>${nameHtml}</td><td>${escapeHtml(r.date)}</td><td>${value}</td>${changeCell}`;
     tbody.appendChild(tr);
   }
 }
 
+function describeJob(job) {
+  if (job.phase === "download" && job.total) return `downloading ${job.done}/${job.total}`;
+  if (job.phase === "index" && job.total) return `indexing ${job.done}/${job.total}`;
+  if (job.phase === "citations" && job.total) return `extracting citations ${job.done}/${job.total}`;
+  if (job.phase === "done") return job.status === "ok" ? "" : `failed: ${job.error ?? ""}`;
+  return job.phase;
+}
+
+function watchRefreshJob(id) {
+  return new Promise((resolve, reject) => {
+    const source = new EventSource(API(`/api/refresh/jobs/${id}/events`));
+    source.addEventListener("progress", (ev) => {
+      setText("refreshStatus", describeJob(JSON.parse(ev.data)));
+    });
+    source.addEventListener("done", (ev) => {
+      source.close();
+      const job = JSON.parse(ev.data);
+      setText("refreshStatus", describeJob(job));
+      if (job.status === "ok") resolve(job);
+      else reject(new Error(job.error));
+    });
+    source.onerror = () => {
+      source.close();
+      reject(new Error("lost refresh progress stream"));
+    };
+  });
+}
+
 async function refresh() {
   try {
-    const r = await jpost("/api/refresh");
-    metricsCache.clear();
-    await loadAllLatest();
-    await updateSummary();
-    await renderInsights();
-    await loadReviewTable();
+    const { job } = await jpost("/api/refresh");
+    await watchRefreshJob(job.id);
+    await refreshFromServer();
+  } catch (e) {
+  }
+}
+
+async function loadDiffDates() {
+  const title = document.getElementById("diffTitle").value;
+  const fromSel = document.getElementById("diffFrom");
+  const toSel = document.getElementById("diffTo");
+  fromSel.innerHTML = "";
+  toSel.innerHTML = "";
+  if (!title) return;
+  try {
+    const { dates } = await jget(`/api/titles/${encodeURIComponent(title)}/snapshots`);
+    for (const d of dates) {
+      fromSel.add(new Option(d, d));
+      toSel.add(new Option(d, d));
+    }
+    if (dates.length > 1) fromSel.value = dates[dates.length - 2];
+    if (dates.length) toSel.value = dates[dates.length - 1];
+    setText("diffSummary", dates.length < 2 ? "Fewer than two snapshots stored for this title." : "");
+  } catch (e) {
+    setText("diffSummary", e.message);
+  }
+}
+
+function renderOps(ops) {
+  return (ops ?? [])
+    .map((op) => {
+      const text = escapeHtml(op.text);
+      if (op.op === "+") return `<ins>${text}</ins>`;
+      if (op.op === "-") return `<del>${text}</del>`;
+      return text;
+    })
+    .join(" ");
+}
 
+async function runDiff() {
+  const title = document.getElementById("diffTitle").value;
+  const from = document.getElementById("diffFrom").value;
+  const to = document.getElementById("diffTo").value;
+  const list = document.getElementById("diffResults");
+  list.innerHTML = "";
+  if (!title) return;
+  try {
+    const q = new URLSearchParams({ from, to, limit: 200 });
+    const diff = await jget(`/api/titles/${encodeURIComponent(title)}/diff?${q}`);
+    const c = diff.counts;
+    const shown = diff.total > diff.changes.length ? ` (first ${diff.changes.length} shown)` : "";
+    setText("diffSummary", `${diff.from} → ${diff.to}: ${c.added} added, ${c.removed} removed, ${c.modified} modified${shown}`);
+    for (const ch of diff.changes) {
+      const li = document.createElement("li");
+      li.className = "diff-item";
+      const label = ch.type === "SECTION" ? `§ ${ch.identifier}` : ch.identifier;
+      li.innerHTML =
+        `<h3>${escapeHtml(label)} <span class="subtle">${escapeHtml(ch.change)} +${ch.words_added} −${ch.words_removed}</span></h3>` +
+        `<div class="diff-text">${renderOps(ch.ops)}</div>`;
+      list.appendChild(li);
+    }
   } catch (e) {
+    setText("diffSummary", e.message);
   }
 }
 
@@ -262,6 +416,7 @@ function syncThemeFromSystem() {
 
 async function refreshFromServer() {
   metricsCache.clear();
+  await loadAgencies();
   await loadAllLatest();
   await updateSummary();
   await renderInsights();
@@ -271,13 +426,21 @@ async function refreshFromServer() {
 
 document.getElementById("reviewMetricSelect").addEventListener("change", loadReviewTable);
 document.getElementById("reviewSearch").addEventListener("input", loadReviewTable);
+document.getElementById("reviewScopeSelect").addEventListener("change", loadReviewTable);
+document.getElementById("reviewCrumbBack").addEventListener("click", () => drillInto(""));
+document.getElementById("reviewTable").addEventListener("click", (ev) => {
+  const btn = ev.target.closest("[data-drill]");
+  if (btn) drillInto(btn.dataset.drill);
+});
+document.getElementById("diffTitle").addEventListener("change", loadDiffDates);
+document.getElementById("diffRun").addEventListener("click", runDiff);
 
 (async function init() {
   localStorage.removeItem(themeKey);
   applyTheme(loadThemePreference());
   themeQuery.addEventListener("change", syncThemeFromSystem);
 
-  await loadAgencies();
+  await loadMetricCatalog();
   await refreshFromServer();
   setInterval(() => {
     refreshFromServer().catch(() => {});